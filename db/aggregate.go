@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql/driver"
+	"reflect"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+type (
+	// aggregateScanner scans JSON (for example, result of json_agg() or
+	// json_build_object()) into a field of any type.
+	aggregateScanner struct {
+		target reflect.Value
+	}
+)
+
+func (s aggregateScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		s.target.Set(reflect.Zero(s.target.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default: // pgx decodes json into maps or slices
+		var err error
+		data, err = JSONMarshal(v)
+		if err != nil {
+			return err
+		}
+	}
+	value := reflect.New(s.target.Type())
+	if err := JSONUnmarshal(data, value.Interface()); err != nil {
+		return err
+	}
+	s.target.Set(value.Elem())
+	return nil
+}
+
+// aggregateValue returns JSON of the value, nil is returned as it is.
+func aggregateValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+	data, err := JSONMarshal(value)
+	if err != nil {
+		return value
+	}
+	return string(data)
+}
+
+// isComplexType returns true if the type (or type of the pointer) is struct,
+// map or slice which can't be scanned or converted by the driver, values of
+// the type are stored as JSON. Types implementing sql.Scanner or
+// driver.Valuer, time.Time, []byte and slices of scalar elements (like
+// []string or []int64, which are usually stored in array columns) are not
+// complex.
+func isComplexType(rt reflect.Type) bool {
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice:
+	default:
+		return false
+	}
+	if rt.Implements(valuerType) || reflect.PtrTo(rt).Implements(valuerType) || isScannable(rt) {
+		return false
+	}
+	if rt.Kind() == reflect.Slice {
+		elem := rt.Elem()
+		return elem.Kind() == reflect.Interface || isComplexType(elem)
+	}
+	return true
+}
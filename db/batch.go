@@ -0,0 +1,53 @@
+package db
+
+type (
+	// Batch collects rows for one multi-row INSERT statement, created by
+	// NewBatch(). It can be reused with Reset() to insert many batches in a
+	// loop without allocating new slices for the rows.
+	//  batch := m.NewBatch(1000)
+	//  for _, chunk := range chunks {
+	//  	batch.Reset()
+	//  	for _, item := range chunk {
+	//  		batch.Add(m.Changes(db.RawChanges{"Name": item.Name}))
+	//  	}
+	//  	batch.Insert().MustExecute()
+	//  }
+	Batch struct {
+		model *Model
+		rows  [][]Changes
+	}
+)
+
+// NewBatch creates a Batch of the Model, capacity is the expected number of
+// rows of each batch.
+func (m Model) NewBatch(capacity int) *Batch {
+	return &Batch{model: &m, rows: make([][]Changes, 0, capacity)}
+}
+
+// Add adds a row (a list of changes) to the batch.
+func (b *Batch) Add(lotsOfChanges ...Changes) *Batch {
+	b.rows = append(b.rows, lotsOfChanges)
+	return b
+}
+
+// Len returns number of rows in the batch.
+func (b *Batch) Len() int {
+	return len(b.rows)
+}
+
+// Reset removes all rows from the batch but keeps the capacity, so the
+// batch can be reused. Statements created by Insert() are not affected.
+func (b *Batch) Reset() *Batch {
+	for i := range b.rows {
+		b.rows[i] = nil // allow changes to be garbage collected
+	}
+	b.rows = b.rows[:0]
+	return b
+}
+
+// Insert creates an INSERT statement of all rows in the batch, see
+// BatchInsert(). The optional argument is added after the VALUES clause,
+// for example, "RETURNING id".
+func (b *Batch) Insert(args ...string) SQLWithValues {
+	return b.model.BatchInsert(b.rows...)(args...)
+}
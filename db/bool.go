@@ -0,0 +1,69 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+)
+
+type (
+	// boolIntScanner scans integer (0 or not) into bool or *bool.
+	boolIntScanner struct {
+		target reflect.Value
+	}
+)
+
+func (s boolIntScanner) Scan(src interface{}) error {
+	var b bool
+	switch v := src.(type) {
+	case nil:
+		s.target.Set(reflect.Zero(s.target.Type()))
+		return nil
+	case int64:
+		b = v != 0
+	case int32:
+		b = v != 0
+	case int16:
+		b = v != 0
+	case bool:
+		b = v
+	case []byte, string:
+		var text string
+		if t, ok := v.([]byte); ok {
+			text = string(t)
+		} else {
+			text = v.(string)
+		}
+		i, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return err
+		}
+		b = i != 0
+	default:
+		return ErrTypeAssertionFailed
+	}
+	if s.target.Kind() == reflect.Ptr {
+		s.target.Set(reflect.New(s.target.Type().Elem()))
+		s.target.Elem().SetBool(b)
+	} else {
+		s.target.SetBool(b)
+	}
+	return nil
+}
+
+// boolIntValue returns 1 for true and 0 for false (or pointer of it), nil
+// pointer is returned as nil. Other values are returned as they are.
+func boolIntValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case *bool:
+		if v == nil {
+			return nil
+		}
+		return boolIntValue(*v)
+	}
+	return value
+}
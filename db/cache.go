@@ -0,0 +1,277 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// queryCache caches results of SELECT statements of a Model, see
+	// SetQueryCache().
+	queryCache struct {
+		ttl     time.Duration
+		mu      sync.Mutex
+		entries map[[sha256.Size]byte]cacheEntry
+		swept   time.Time
+	}
+
+	cacheEntry struct {
+		expires time.Time
+		n       int
+		values  []reflect.Value
+	}
+)
+
+// SetQueryCache enables the in-memory cache of the Model with the TTL, so
+// identical SELECT statements (same SQL and arguments) executed by Query(),
+// QueryRow(), etc. within the TTL return the cached results without
+// querying the database. Arguments of pointers and driver.Valuer are
+// compared by the values they point to or return, statements with
+// arguments still containing pointers (like structs with pointer fields)
+// are not cached. Statements in transactions (or on a connection which is a
+// transaction) are not cached either. The cache is cleared after any
+// statement which may change rows (INSERT, UPDATE, DELETE, TRUNCATE, MERGE
+// or WITH with any of them) of the Model (or its copies like ScopedBy()) is
+// executed, but changes by other Models, other processes or triggers are not
+// noticed, so results can be stale for up to the TTL. Only
+// use it for rarely-changing data like lookup tables. Expired results are
+// removed periodically. Slices and maps are copied from the cache, but
+// values they contain (like pointers or nested maps) are shared, don't
+// change them. The cache is safe for concurrent use. Use 0 to disable the
+// cache.
+//  countries := db.NewModel(models.Country{}, conn)
+//  countries.SetQueryCache(10 * time.Minute)
+func (m *Model) SetQueryCache(ttl time.Duration) *Model {
+	if ttl <= 0 {
+		m.cache = nil
+	} else {
+		m.cache = &queryCache{ttl: ttl, entries: map[[sha256.Size]byte]cacheEntry{}}
+	}
+	return m
+}
+
+// cacheKey returns the cache key of the statement, ok is false if the
+// statement can't be cached.
+func (s SQLWithValues) cacheKey() (key [sha256.Size]byte, ok bool) {
+	if s.model.cache == nil || s.verb() != "SELECT" {
+		return
+	}
+	if _, isTx := s.model.connection.(Tx); isTx {
+		return
+	}
+	values := make([]interface{}, len(s.values))
+	for i, value := range s.values {
+		if values[i], ok = cacheValue(value); !ok {
+			return
+		}
+	}
+	return sha256.Sum256([]byte(fmt.Sprintf("%s\x00%#v", s.sql, values))), true
+}
+
+// cacheValue returns the value that pointers point to or driver.Valuer
+// returns, ok is false if the value still contains pointers, which can't be
+// compared by their text representation.
+func cacheValue(value interface{}) (interface{}, bool) {
+	for value != nil {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Ptr && rv.IsNil() {
+			return nil, true
+		}
+		if valuer, ok := value.(driver.Valuer); ok {
+			v, err := valuer.Value()
+			if err != nil {
+				return nil, false
+			}
+			if t, ok := v.(time.Time); ok {
+				return t.Format(time.RFC3339Nano), true
+			}
+			value = v
+			continue
+		}
+		if t, ok := value.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), true
+		}
+		if rv.Kind() != reflect.Ptr {
+			break
+		}
+		value = rv.Elem().Interface()
+	}
+	if value != nil && hasPointer(reflect.ValueOf(value)) {
+		return nil, false
+	}
+	return value, true
+}
+
+// hasPointer returns true if the value is or contains any non-nil pointer,
+// channel or function.
+func hasPointer(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return !rv.IsNil()
+	case reflect.Interface:
+		return !rv.IsNil() && hasPointer(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if hasPointer(rv.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if hasPointer(iter.Key()) || hasPointer(iter.Value()) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			if hasPointer(rv.Field(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// get puts the cached results into the targets, returns false if the
+// results are not cached or expired.
+func (c *queryCache) get(key [sha256.Size]byte, targets ...interface{}) (n int, ok bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok || len(entry.values) != len(targets) {
+		return 0, false
+	}
+	for i, target := range targets {
+		rv := reflect.ValueOf(target)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Type() != entry.values[i].Type() {
+			return 0, false
+		}
+	}
+	for i, target := range targets {
+		reflect.ValueOf(target).Elem().Set(copyValue(entry.values[i]))
+	}
+	return entry.n, true
+}
+
+// set caches copies of the values the targets point to.
+func (c *queryCache) set(key [sha256.Size]byte, n int, targets ...interface{}) {
+	values := make([]reflect.Value, 0, len(targets))
+	for _, target := range targets {
+		rv := reflect.ValueOf(target)
+		if rv.Kind() != reflect.Ptr || rv.IsNil() {
+			return
+		}
+		values = append(values, copyValue(rv.Elem()))
+	}
+	now := time.Now()
+	c.mu.Lock()
+	if now.Sub(c.swept) >= c.ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.swept = now
+	}
+	c.entries[key] = cacheEntry{expires: now.Add(c.ttl), n: n, values: values}
+	c.mu.Unlock()
+}
+
+// writes returns true if the statement may change rows, which is INSERT,
+// UPDATE, DELETE, TRUNCATE, MERGE or WITH having any of them (writable CTE).
+// FOR UPDATE (and FOR NO KEY UPDATE) of SELECT doesn't change rows.
+func (s SQLWithValues) writes() bool {
+	verb := s.verb()
+	switch verb {
+	case "INSERT", "UPDATE", "DELETE", "TRUNCATE", "MERGE":
+		return true
+	}
+	if verb != "WITH" {
+		return false
+	}
+	var quote byte
+	var prev string
+	for i := 0; i < len(s.sql); i++ {
+		c := s.sql[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' || c == '"' {
+			quote = c
+			continue
+		}
+		if !isWordChar(c) || (i > 0 && isWordChar(s.sql[i-1])) {
+			continue
+		}
+		j := i
+		for j < len(s.sql) && isWordChar(s.sql[j]) {
+			j += 1
+		}
+		word := strings.ToUpper(s.sql[i:j])
+		switch word {
+		case "INSERT", "DELETE", "TRUNCATE", "MERGE":
+			return true
+		case "UPDATE":
+			if prev != "FOR" && prev != "KEY" {
+				return true
+			}
+		}
+		prev = word
+	}
+	return false
+}
+
+// clearQueryCache removes all cached results of the Model if the query cache
+// is enabled.
+func (m Model) clearQueryCache() {
+	if m.cache != nil {
+		m.cache.clear()
+	}
+}
+
+// clear removes all cached results.
+func (c *queryCache) clear() {
+	c.mu.Lock()
+	c.entries = map[[sha256.Size]byte]cacheEntry{}
+	c.mu.Unlock()
+}
+
+// copyValue returns a copy of the value, slices and maps are copied (but
+// not their elements), so the cached results can't be changed by callers.
+func copyValue(rv reflect.Value) reflect.Value {
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.IsNil() {
+			return reflect.Zero(rv.Type())
+		}
+		out := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(out, rv)
+		return out
+	case reflect.Map:
+		if rv.IsNil() {
+			return reflect.Zero(rv.Type())
+		}
+		out := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), iter.Value())
+		}
+		return out
+	}
+	out := reflect.New(rv.Type()).Elem()
+	out.Set(rv)
+	return out
+}
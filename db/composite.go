@@ -0,0 +1,282 @@
+package db
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidComposite = errors.New("invalid composite value")
+)
+
+type (
+	// compositeScanner scans text representation of composite type like
+	// (foo,"bar baz",) into a struct (or pointer of struct) in order of
+	// the exported fields of the struct.
+	compositeScanner struct {
+		target reflect.Value
+	}
+)
+
+func (c compositeScanner) Scan(src interface{}) error {
+	var text string
+	switch s := src.(type) {
+	case nil:
+		c.target.Set(reflect.Zero(c.target.Type()))
+		return nil
+	case []byte:
+		text = string(s)
+	case string:
+		text = s
+	default:
+		return ErrTypeAssertionFailed
+	}
+	elements, err := parseComposite(text)
+	if err != nil {
+		return err
+	}
+	target := c.target
+	if target.Kind() == reflect.Ptr {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	if target.Kind() != reflect.Struct {
+		return ErrTypeAssertionFailed
+	}
+	i := 0
+	for j := 0; j < target.NumField(); j++ {
+		if target.Type().Field(j).PkgPath != "" {
+			continue
+		}
+		if i >= len(elements) {
+			break
+		}
+		if err := setFromText(target.Field(j), elements[i]); err != nil {
+			return err
+		}
+		i += 1
+	}
+	return nil
+}
+
+// parseComposite parses text representation of composite type, nil is used
+// for NULL elements.
+func parseComposite(text string) (elements []*string, err error) {
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		err = ErrInvalidComposite
+		return
+	}
+	text = text[1 : len(text)-1]
+	var b strings.Builder
+	quoted, inQuotes := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inQuotes && c == '"' && i+1 < len(text) && text[i+1] == '"':
+			b.WriteByte('"')
+			i += 1
+		case c == '"':
+			inQuotes = !inQuotes
+			quoted = true
+		case c == '\\' && i+1 < len(text):
+			b.WriteByte(text[i+1])
+			i += 1
+		case c == ',' && !inQuotes:
+			elements = append(elements, compositeElement(b.String(), quoted))
+			b.Reset()
+			quoted = false
+		default:
+			b.WriteByte(c)
+		}
+	}
+	if inQuotes {
+		err = ErrInvalidComposite
+		return
+	}
+	elements = append(elements, compositeElement(b.String(), quoted))
+	return
+}
+
+func compositeElement(s string, quoted bool) *string {
+	if s == "" && !quoted {
+		return nil
+	}
+	return &s
+}
+
+// compositeValue returns text representation of composite type of a struct
+// (or pointer of struct), for example: ("foo","bar baz",). Other values are
+// returned as they are.
+func compositeValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct || isScannable(rv.Type()) {
+		return value
+	}
+	elements := []string{}
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Type().Field(i).PkgPath != "" {
+			continue
+		}
+		text := textOf(rv.Field(i))
+		if text == nil {
+			elements = append(elements, "")
+			continue
+		}
+		s := strings.ReplaceAll(*text, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		elements = append(elements, `"`+s+`"`)
+	}
+	return "(" + strings.Join(elements, ",") + ")"
+}
+
+// textOf returns text representation of a value, nil for NULL. []byte is in
+// hex format of bytea like \x0102, other slices and arrays are in text
+// representation of arrays like {"1","2"}.
+func textOf(rv reflect.Value) *string {
+	if rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	var s string
+	switch v := rv.Interface().(type) {
+	case driver.Valuer:
+		value, err := v.Value()
+		if err != nil || value == nil {
+			return nil
+		}
+		if b, ok := value.([]byte); ok {
+			s = string(b)
+		} else {
+			return textOf(reflect.ValueOf(value))
+		}
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			if rv.IsNil() {
+				return nil
+			}
+			s = `\x` + hex.EncodeToString(rv.Bytes())
+		} else if isArray(rv) {
+			return arrayText(rv)
+		} else {
+			s = fmt.Sprint(v)
+		}
+	}
+	return &s
+}
+
+// isArray returns true if the value is a slice (except []byte) or an array.
+func isArray(rv reflect.Value) bool {
+	if rv.Kind() == reflect.Slice {
+		return rv.Type().Elem().Kind() != reflect.Uint8
+	}
+	return rv.Kind() == reflect.Array
+}
+
+// arrayText returns text representation of array of a slice or an array,
+// for example: {"a","b \"c\"",NULL}.
+func arrayText(rv reflect.Value) *string {
+	if rv.Kind() == reflect.Slice && rv.IsNil() {
+		return nil
+	}
+	elements := []string{}
+	for i := 0; i < rv.Len(); i++ {
+		elem := rv.Index(i)
+		text := textOf(elem)
+		if text == nil {
+			elements = append(elements, "NULL")
+			continue
+		}
+		if isArray(elem) {
+			elements = append(elements, *text)
+			continue
+		}
+		s := strings.ReplaceAll(*text, `\`, `\\`)
+		s = strings.ReplaceAll(s, `"`, `\"`)
+		elements = append(elements, `"`+s+`"`)
+	}
+	s := "{" + strings.Join(elements, ",") + "}"
+	return &s
+}
+
+// setFromText sets value of text representation to a struct field.
+func setFromText(f reflect.Value, text *string) error {
+	if text == nil {
+		f.Set(reflect.Zero(f.Type()))
+		return nil
+	}
+	if f.Kind() == reflect.Ptr {
+		f.Set(reflect.New(f.Type().Elem()))
+		f = f.Elem()
+	}
+	if scanner, ok := f.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(*text)
+	}
+	switch f.Interface().(type) {
+	case time.Time:
+		for _, layout := range []string{
+			"2006-01-02 15:04:05.999999999-07",
+			"2006-01-02 15:04:05.999999999-07:00",
+			"2006-01-02 15:04:05.999999999",
+			time.RFC3339Nano,
+			"2006-01-02",
+		} {
+			if t, err := time.Parse(layout, *text); err == nil {
+				f.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return ErrInvalidComposite
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(*text)
+	case reflect.Bool:
+		f.SetBool(*text == "t" || *text == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(*text, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(*text, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(*text, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return ErrTypeAssertionFailed
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+var (
+	ErrCopyNotSupported = errors.New("copy is not supported by the connection")
+)
+
+// CopyFrom inserts objects (structs or pointers of structs of the Model, or
+// one slice of them) into the table with the COPY FROM protocol, which is
+// much faster than INSERT for large number of rows. Only values of the
+// columns (struct field names, column names or jsonb column names) are
+// copied, other columns use their default values. Returns number of rows
+// copied. The connection must implement CopyFrom (like pgx), otherwise
+// ErrCopyNotSupported is returned. Hooks registered by OnBeforeInsert() and
+// scope are not applied.
+//  // COPY users (name, meta) FROM STDIN
+//  count, err := m.CopyFrom([]string{"Name", "meta"}, users)
+func (m Model) CopyFrom(columns []string, objects ...interface{}) (count int64, err error) {
+	if m.connection == nil {
+		err = ErrNoConnection
+		return
+	}
+	c, ok := m.connection.(CopyFrom)
+	if !ok {
+		err = ErrCopyNotSupported
+		return
+	}
+	names := []string{}
+	fieldsOfColumns := [][]Field{} // all fields of jsonb column
+	for _, column := range columns {
+		var fields []Field
+		if name := m.columnName(column); name != "" {
+			column = name
+			for _, f := range m.modelFields {
+				if f.Jsonb == "" && f.ColumnName == name {
+					fields = append(fields, f)
+					break
+				}
+			}
+		} else if stringsContain(m.jsonbColumns, column) {
+			for _, f := range m.modelFields {
+				if f.Jsonb == column {
+					fields = append(fields, f)
+				}
+			}
+		} else {
+			err = ErrUnknownColumn
+			return
+		}
+		names = append(names, column)
+		fieldsOfColumns = append(fieldsOfColumns, fields)
+	}
+	if len(objects) == 1 {
+		if rv := reflect.ValueOf(objects[0]); rv.Kind() == reflect.Slice {
+			objects = make([]interface{}, rv.Len())
+			for i := range objects {
+				objects[i] = rv.Index(i).Interface()
+			}
+		}
+	}
+	rows := [][]interface{}{}
+	for _, object := range objects {
+		rv, ok := addressableStruct(object)
+		if !ok {
+			err = ErrTypeAssertionFailed
+			return
+		}
+		row := []interface{}{}
+		for _, fields := range fieldsOfColumns {
+			changes := Changes{}
+			for _, field := range fields {
+				if value, ok := fieldValue(rv, field); ok {
+					changes[field] = value
+				}
+			}
+			if len(fields) == 1 && fields[0].Jsonb == "" {
+				row = append(row, fields[0].convertValue(changes[fields[0]]))
+			} else {
+				var object string
+				object, err = m.jsonbObject(changes)
+				if err != nil {
+					return
+				}
+				row = append(row, object)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sql := m.NewSQLWithValues("COPY " + m.tableName + " (" + strings.Join(names, ", ") + ") FROM STDIN")
+	sql.log(sql.sql, nil)
+	count, err = c.CopyFrom(context.Background(), m.tableName, names, rows)
+	m.clearQueryCache()
+	err = sql.wrapError(err)
+	return
+}
+
+// addressableStruct returns addressable struct value of a struct or pointer
+// of struct, so that unexported fields can be read.
+func addressableStruct(object interface{}) (rv reflect.Value, ok bool) {
+	rv = reflect.Indirect(reflect.ValueOf(object))
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	if !rv.CanAddr() {
+		v := reflect.New(rv.Type()).Elem()
+		v.Set(rv)
+		rv = v
+	}
+	ok = true
+	return
+}
+
+// fieldValue returns value of the field of the addressable struct, ok is
+// false if the struct doesn't have the field.
+func fieldValue(rv reflect.Value, field Field) (value interface{}, ok bool) {
+	f := rv.FieldByName(field.Name)
+	if !f.IsValid() {
+		return
+	}
+	if !f.CanInterface() {
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+	}
+	return f.Interface(), true
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	fetchCursorName = "furk_fetch_cursor"
+)
+
+var (
+	ErrInvalidChunkFunc = errors.New("chunk function must be like func([]T) error")
+
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type (
+	// Cursor can be created with SQLWithValues.Cursor(). Unlike Query(),
+	// rows are read one by one, so you can process huge number of rows
+	// without loading all of them into memory.
+	Cursor struct {
+		sql   SQLWithValues
+		rows  Rows
+		count int
+
+		// server-side cursor used if FetchSize() is set
+		tx      Tx
+		ctx     context.Context
+		fetched int
+		err     error
+	}
+
+	// TxCursor can be created with SQLWithValues.DeclareCursorTx(). It is
+	// a cursor declared in a transaction, rows are fetched one by one by
+	// Fetch(), and the current row can be updated or deleted with
+	// WhereCurrentOf().
+	TxCursor struct {
+		sql  SQLWithValues
+		tx   Tx
+		ctx  context.Context
+		name string
+	}
+)
+
+// Cursor executes the SQL query and returns a Cursor to iterate the rows. You
+// must call Close() when you are done with the cursor.
+//  cur, err := m.Find("ORDER BY id ASC").Cursor()
+//  if err != nil {
+//  	return err
+//  }
+//  defer cur.Close()
+//  for cur.Next() {
+//  	var o models.Order
+//  	if err := cur.Scan(&o); err != nil {
+//  		return err
+//  	}
+//  	// ...
+//  }
+//  return cur.Err()
+func (s SQLWithValues) Cursor() (*Cursor, error) {
+	if s.model.connection == nil {
+		return nil, ErrNoConnection
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.fetchSize > 0 {
+		return s.fetchCursor()
+	}
+	s.log(s.sql, s.values)
+	start := time.Now()
+	rows, err := s.model.connection.Query(s.sql, s.values...)
+	s.observe(start, &err)
+	if err != nil {
+		return nil, s.wrapError(err)
+	}
+	return &Cursor{
+		sql:  s,
+		rows: rows,
+	}, nil
+}
+
+// FetchSize makes Cursor() fetch n rows at a time. Rows of Query() of pq
+// are all loaded before the first row is returned, rows of pgx and go-pg
+// are read from the connection as they arrive, so none of them lets you
+// control how many rows are in the memory. If n is greater than zero,
+// Cursor() begins a transaction, declares a server-side cursor (see
+// DeclareCursorTx()) for the statement and fetches n rows at a time with
+// "FETCH n", which works the same way for all drivers. The transaction is
+// committed when Close() is called, so always call Close(). Query() and
+// other methods are not affected.
+//  cur, err := m.Find("ORDER BY id ASC").FetchSize(1000).Cursor()
+func (s SQLWithValues) FetchSize(n int) SQLWithValues {
+	s.fetchSize = n
+	return s
+}
+
+// fetchCursor declares a cursor in a new transaction for Cursor().
+func (s SQLWithValues) fetchCursor() (*Cursor, error) {
+	ctx := context.Background()
+	s.log("BEGIN", nil)
+	tx, err := s.model.connection.BeginTx(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sql := "DECLARE " + fetchCursorName + " NO SCROLL CURSOR FOR " + s.sql
+	s.log(sql, s.values)
+	if _, err := tx.ExecContext(ctx, sql, s.values...); err != nil {
+		s.log("ROLLBACK", nil)
+		tx.Rollback(ctx)
+		return nil, s.wrapError(err)
+	}
+	return &Cursor{
+		sql: s,
+		tx:  tx,
+		ctx: ctx,
+	}, nil
+}
+
+// Next prepares the next row for Scan(), returns false if there are no more
+// rows or error occurs, use Err() to check the error.
+func (c *Cursor) Next() bool {
+	if c.tx == nil {
+		if c.rows.Next() {
+			c.count += 1
+			return true
+		}
+		return false
+	}
+	for {
+		if c.rows != nil {
+			if c.rows.Next() {
+				c.fetched += 1
+				c.count += 1
+				return true
+			}
+			if c.rows.Err() != nil || c.fetched < c.sql.fetchSize {
+				return false
+			}
+			c.rows.Close()
+			c.rows = nil
+		}
+		sql := fmt.Sprintf("FETCH %d FROM %s", c.sql.fetchSize, fetchCursorName)
+		c.sql.log(sql, nil)
+		c.rows, c.err = c.tx.QueryContext(c.ctx, sql)
+		if c.err != nil {
+			return false
+		}
+		c.fetched = 0
+	}
+}
+
+// Count returns number of rows read by Next() so far.
+func (c *Cursor) Count() int {
+	return c.count
+}
+
+// Scan puts the current row into the target, which must be a pointer. If
+// target is pointer of the struct of the Model, all fields of the struct are
+// scanned, just like Query().
+func (c *Cursor) Scan(target interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr {
+		return ErrMustBePointer
+	}
+	return c.sql.wrapError(c.sql.scan(rv.Elem(), c.rows))
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (c *Cursor) Err() error {
+	if c.err != nil {
+		return c.sql.wrapError(c.err)
+	}
+	if c.rows == nil {
+		return nil
+	}
+	return c.sql.wrapError(c.rows.Err())
+}
+
+// Close closes the rows of the cursor, the error encountered during
+// iteration (see Err()) is returned. If FetchSize() is set, the transaction
+// of the cursor is also committed (or rolled back if there is error).
+func (c *Cursor) Close() (err error) {
+	if c.rows != nil {
+		err = c.rows.Close()
+		if rowsErr := c.rows.Err(); rowsErr != nil {
+			err = c.sql.wrapError(rowsErr)
+		}
+	}
+	if c.tx == nil {
+		return
+	}
+	if err != nil || c.err != nil {
+		c.sql.log("ROLLBACK", nil)
+		c.tx.Rollback(c.ctx)
+	} else {
+		c.sql.log("COMMIT", nil)
+		err = c.tx.Commit(c.ctx)
+	}
+	c.tx = nil
+	return
+}
+
+// DeclareCursorTx declares a cursor with the name for the SELECT statement in
+// the transaction, which is required by PostgreSQL for cursors. Name must be
+// a valid identifier, never use user input as the name. Use "FOR UPDATE" in
+// the statement if you are going to update the rows. The cursor is closed
+// at the end of the transaction if you don't call Close().
+//  tx, _ := conn.BeginTx(ctx, db.LevelReadCommitted)
+//  defer tx.Rollback(ctx)
+//  cur, err := m.Find("WHERE status = $1 FOR UPDATE", "old").DeclareCursorTx(tx, ctx, "orders_cursor")
+//  if err != nil {
+//  	return err
+//  }
+//  for {
+//  	var o models.Order
+//  	found, err := cur.Fetch(&o)
+//  	if err != nil {
+//  		return err
+//  	}
+//  	if !found {
+//  		break
+//  	}
+//  	err = m.Update(changes...)(cur.WhereCurrentOf()).ExecTx(tx, ctx)
+//  	if err != nil {
+//  		return err
+//  	}
+//  }
+//  cur.Close()
+//  return tx.Commit(ctx)
+func (s SQLWithValues) DeclareCursorTx(tx Tx, ctx context.Context, name string) (*TxCursor, error) {
+	if s.model.connection == nil {
+		return nil, ErrNoConnection
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	sql := "DECLARE " + name + " CURSOR FOR " + s.sql
+	s.log(sql, s.values)
+	if _, err := tx.ExecContext(ctx, sql, s.values...); err != nil {
+		return nil, s.wrapError(err)
+	}
+	return &TxCursor{
+		sql:  s,
+		tx:   tx,
+		ctx:  ctx,
+		name: name,
+	}, nil
+}
+
+// Fetch fetches the next row of the cursor and puts it into the target (see
+// Cursor.Scan()), found is false if there are no more rows.
+func (c *TxCursor) Fetch(target interface{}) (found bool, err error) {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr {
+		err = ErrMustBePointer
+		return
+	}
+	sql := "FETCH NEXT FROM " + c.name
+	c.sql.log(sql, nil)
+	rows, err := c.tx.QueryContext(c.ctx, sql)
+	if err != nil {
+		err = c.sql.wrapError(err)
+		return
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = c.sql.wrapError(rows.Err())
+		return
+	}
+	if err = c.sql.scan(rv.Elem(), rows); err != nil {
+		err = c.sql.wrapError(err)
+		return
+	}
+	found = true
+	return
+}
+
+// WhereCurrentOf returns the "WHERE CURRENT OF" condition of the cursor,
+// which can be used in Update() or Delete() to change the row fetched last.
+func (c *TxCursor) WhereCurrentOf() string {
+	return "WHERE CURRENT OF " + c.name
+}
+
+// Close closes the cursor.
+func (c *TxCursor) Close() error {
+	sql := "CLOSE " + c.name
+	c.sql.log(sql, nil)
+	_, err := c.tx.ExecContext(c.ctx, sql)
+	return err
+}
+
+// InChunks executes the SQL query and calls fn with at most size rows at a
+// time until all rows are processed, so only one chunk of rows is in the
+// memory (use FetchSize() if the driver loads all rows, see Cursor()). The
+// fn must be a function like func([]models.Order) error, the slice is
+// reused, so don't keep it after fn returns. If fn returns error, the
+// iteration stops and the error is returned.
+//  err := m.Find("ORDER BY id").InChunks(500, func(orders []models.Order) error {
+//  	// ...
+//  	return nil
+//  })
+func (s SQLWithValues) InChunks(size int, fn interface{}) (err error) {
+	f := reflect.ValueOf(fn)
+	if f.Kind() != reflect.Func || f.IsNil() || size < 1 {
+		return ErrInvalidChunkFunc
+	}
+	ft := f.Type()
+	if ft.NumIn() != 1 || ft.In(0).Kind() != reflect.Slice || ft.NumOut() != 1 || ft.Out(0) != errorType {
+		return ErrInvalidChunkFunc
+	}
+	cur, err := s.Cursor()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if e := cur.Close(); err == nil {
+			err = e
+		}
+	}()
+	chunk := reflect.MakeSlice(ft.In(0), 0, size)
+	call := func() error {
+		if out := f.Call([]reflect.Value{chunk})[0]; !out.IsNil() {
+			return out.Interface().(error)
+		}
+		chunk = chunk.Slice(0, 0)
+		return nil
+	}
+	elem := reflect.New(ft.In(0).Elem())
+	for cur.Next() {
+		elem.Elem().Set(reflect.Zero(elem.Elem().Type()))
+		if err = cur.Scan(elem.Interface()); err != nil {
+			return
+		}
+		chunk = reflect.Append(chunk, elem.Elem())
+		if chunk.Len() == size {
+			if err = call(); err != nil {
+				return
+			}
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	if chunk.Len() > 0 {
+		err = call()
+	}
+	return
+}
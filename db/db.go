@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 )
 
 const (
@@ -20,6 +22,15 @@ type (
 		BeginTx(ctx context.Context, isolationLevel string) (Tx, error)
 		ErrNoRows() error
 		ErrGetCode(err error) string
+		Stats() Stats
+	}
+
+	// Stats is statistics of the connection pool of DB.
+	Stats struct {
+		MaxOpen int // maximum number of connections, 0 for unlimited
+		Open    int // number of established connections (in use and idle)
+		InUse   int // number of connections in use
+		Idle    int // number of idle connections
 	}
 
 	Tx interface {
@@ -52,4 +63,98 @@ type (
 	ConvertParameters interface {
 		ConvertParameters(string, []interface{}) (string, []interface{})
 	}
+
+	ConvertArray interface {
+		ConvertArray(interface{}) interface{}
+	}
+
+	// QuoteIdentifier is implemented by adapters to quote identifiers
+	// (double quotes for PostgreSQL), see Model.QuoteIdentifier().
+	QuoteIdentifier interface {
+		QuoteIdentifier(name string) string
+	}
+
+	// PrepareNamed is implemented by DB which can prepare statements by name
+	// and execute them later (like standard, pq and pgx), see
+	// Model.Prepare(). Prepared statements are released by Close().
+	PrepareNamed interface {
+		PrepareNamed(name, query string) error
+		ExecNamed(name string, args ...interface{}) (Result, error)
+		QueryNamed(name string, args ...interface{}) (Rows, error)
+		DeallocateNamed(name string) error
+	}
+
+	// Returning is implemented by DB which may not support the RETURNING
+	// clause (like standard with MySQL), see SQLWithValues.Query().
+	Returning interface {
+		SupportsReturning() bool
+	}
+
+	// CopyFrom is implemented by DB which supports the COPY FROM protocol
+	// (like pgx), see Model.CopyFrom().
+	CopyFrom interface {
+		CopyFrom(ctx context.Context, tableName string, columns []string, rows [][]interface{}) (int64, error)
+	}
 )
+
+var noRowsErrors = []error{sql.ErrNoRows}
+
+// RegisterNoRowsError adds the no rows error of an adapter to the list of
+// errors IsNoRows() recognizes. Adapters in this package call it in init().
+func RegisterNoRowsError(err error) {
+	noRowsErrors = append(noRowsErrors, err)
+}
+
+var errCodeGetters []func(error) string
+
+// RegisterErrGetCode adds the function of an adapter which returns the
+// SQLSTATE code of its errors (like ErrGetCode() of DB) to the list of
+// functions IsErrorCode() uses. Adapters in this package call it in init().
+func RegisterErrGetCode(fn func(error) string) {
+	errCodeGetters = append(errCodeGetters, fn)
+}
+
+// IsErrorCode returns true if err is (or wraps) an error of any known
+// adapter with the SQLSTATE code, so you don't need the connection to check
+// it. See https://www.postgresql.org/docs/current/errcodes-appendix.html.
+//  if db.IsErrorCode(err, "23503") {
+//  	// foreign key violation
+//  }
+func IsErrorCode(err error, code string) bool {
+	if err == nil {
+		return false
+	}
+	for _, fn := range errCodeGetters {
+		if fn(err) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// IsUniqueViolation returns true if err is (or wraps) a unique violation
+// error (SQLSTATE 23505) of any known adapter.
+//  if err := m.Insert(changes...)().Execute(); db.IsUniqueViolation(err) {
+//  	// 409 Conflict
+//  }
+func IsUniqueViolation(err error) bool {
+	return IsErrorCode(err, "23505")
+}
+
+// IsNoRows returns true if err is (or wraps) the no rows error of any known
+// adapter, so you don't need the connection to check it.
+//  err := model.Select("name", "WHERE id = $1", 1).QueryRow(&name)
+//  if db.IsNoRows(err) {
+//  	// not found
+//  }
+func IsNoRows(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, e := range noRowsErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
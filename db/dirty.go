@@ -0,0 +1,81 @@
+package db
+
+import (
+	"reflect"
+	"time"
+)
+
+// IsDirty compares values of all fields of two structs (or pointers of
+// structs) of the Model, for example, a row loaded from the database and the
+// same row changed by the user, returns true and the columns whose values are
+// different, in the same order as the columns of Find(). Fields in jsonb
+// columns are compared as JSON, a jsonb column is listed if any of its fields
+// is different or can't be marshaled. Pointers are equal if both are nil or the values they point
+// to are equal. Time values are compared with time.Time.Equal(), so the same
+// time in different time zones is equal. Other values are compared with
+// reflect.DeepEqual(), for example, nil slice and empty slice are
+// different. If any of the objects is not a struct, false is returned.
+//  dirty, columns := m.IsDirty(loaded, user)
+//  // true [name meta]
+func (m Model) IsDirty(loaded, current interface{}) (dirty bool, columns []string) {
+	a, ok := addressableStruct(loaded)
+	if !ok {
+		return
+	}
+	b, ok := addressableStruct(current)
+	if !ok {
+		return
+	}
+	jsonbChanges := map[string][2]Changes{}
+	for _, field := range m.modelFields {
+		x, ok1 := fieldValue(a, field)
+		y, ok2 := fieldValue(b, field)
+		if !ok1 || !ok2 {
+			continue
+		}
+		if field.Jsonb != "" {
+			if _, ok := jsonbChanges[field.Jsonb]; !ok {
+				jsonbChanges[field.Jsonb] = [2]Changes{{}, {}}
+			}
+			jsonbChanges[field.Jsonb][0][field] = x
+			jsonbChanges[field.Jsonb][1][field] = y
+			continue
+		}
+		if !isEqual(reflect.ValueOf(x), reflect.ValueOf(y)) {
+			columns = append(columns, field.ColumnName)
+		}
+	}
+	for _, jsonbColumn := range m.jsonbColumns {
+		changes, ok := jsonbChanges[jsonbColumn]
+		if !ok {
+			continue
+		}
+		x, err1 := m.jsonbObject(changes[0])
+		y, err2 := m.jsonbObject(changes[1])
+		if err1 != nil || err2 != nil || x != y {
+			columns = append(columns, jsonbColumn)
+		}
+	}
+	dirty = len(columns) > 0
+	return
+}
+
+// isEqual compares two values of the same type, see IsDirty().
+func isEqual(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() { // nil interface{}
+		return a.IsValid() == b.IsValid()
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	if a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface {
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() && b.IsNil()
+		}
+		return isEqual(a.Elem(), b.Elem())
+	}
+	if x, ok := a.Interface().(time.Time); ok {
+		return x.Equal(b.Interface().(time.Time))
+	}
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+type (
+	// enumTextScanner scans text into a field (or pointer of a field) whose
+	// pointer is encoding.TextUnmarshaler.
+	enumTextScanner struct {
+		target reflect.Value
+	}
+)
+
+func (s enumTextScanner) Scan(src interface{}) error {
+	var text []byte
+	switch v := src.(type) {
+	case nil:
+		s.target.Set(reflect.Zero(s.target.Type()))
+		return nil
+	case []byte:
+		text = v
+	case string:
+		text = []byte(v)
+	default:
+		return ErrTypeAssertionFailed
+	}
+	target := s.target
+	if target.Kind() == reflect.Ptr {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	u, ok := target.Addr().Interface().(encoding.TextUnmarshaler)
+	if !ok {
+		return ErrTypeAssertionFailed
+	}
+	return u.UnmarshalText(text)
+}
+
+// enumTextValue returns text of encoding.TextMarshaler or fmt.Stringer, nil
+// pointer is returned as nil. Other values are returned as they are.
+func enumTextValue(value interface{}) interface{} {
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		value = rv.Elem().Interface()
+	}
+	switch v := value.(type) {
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return value
+		}
+		return string(text)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+// enumIntValue returns int64 of integer value (or pointer of it), so that
+// drivers don't use String() of the value. Other values are returned as they
+// are.
+func enumIntValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	}
+	return value
+}
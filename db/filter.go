@@ -0,0 +1,112 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+)
+
+// operators of fields of filter structs, longer suffixes go first
+var filterOperators = []struct {
+	name, suffix, operator string
+}{
+	{"gte", "Gte", ">="},
+	{"lte", "Lte", "<="},
+	{"gt", "Gt", ">"},
+	{"lt", "Lt", "<"},
+	{"ne", "Ne", "<>"},
+	{"ilike", "ILike", "ILIKE"},
+	{"like", "Like", "LIKE"},
+	{"eq", "", "="},
+}
+
+// MustFindWhere is like FindWhere but panics if query operation fails.
+func (m Model) MustFindWhere(filter interface{}, target interface{}) {
+	if err := m.FindWhere(filter, target); err != nil {
+		panic(err)
+	}
+}
+
+// FindWhere is like Find(m.WhereFilter(filter)).Query(target).
+//  var orders []models.Order
+//  m.FindWhere(OrderFilter{Status: "new"}, &orders)
+func (m Model) FindWhere(filter interface{}, target interface{}) error {
+	return m.Find(m.WhereFilter(filter)).Query(target)
+}
+
+// WhereFilter builds conditions from fields of the filter (a struct or
+// pointer of a struct) which are not zero values, so you don't have to
+// write conditions and placeholders for optional filters. Use pointer
+// fields if zero values (like 0 or false) are valid filters. Column of a
+// field is the column name of the struct field of the Model with the same
+// name (or the "column" tag) without the operator suffix. Operator is from
+// the "op" tag (eq, ne, gt, gte, lt, lte, like or ilike), or from suffix
+// of the field name (Ne, Gt, Gte, Lt, Lte, Like or ILike), or "=" by default.
+// Slices with "=" become "column = ANY($n)". Fields with `column:"-"` tag
+// and unexported fields are ignored. WhereFilter panics if "op" tag is
+// invalid.
+//  type OrderFilter struct {
+//  	Status      string
+//  	UserId      *int
+//  	Ids         []int `column:"id"`
+//  	CreatedAtGt time.Time
+//  	Name        string `op:"ilike"`
+//  }
+//  // SELECT ... FROM orders WHERE status = $1 AND created_at > $2
+//  m.Find(m.WhereFilter(OrderFilter{Status: "new", CreatedAtGt: yesterday})).MustQuery(&orders)
+func (m Model) WhereFilter(filter interface{}) (w Where) {
+	rv := reflect.Indirect(reflect.ValueOf(filter))
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if f.PkgPath != "" || f.Anonymous {
+			continue
+		}
+		value := rv.Field(i)
+		if value.IsZero() {
+			continue
+		}
+		column := f.Tag.Get("column")
+		if column == "-" {
+			continue
+		}
+		name := f.Name
+		operator := ""
+		if op, ok := f.Tag.Lookup("op"); ok {
+			for _, o := range filterOperators {
+				if strings.EqualFold(o.name, op) {
+					operator = o.operator
+					break
+				}
+			}
+			if operator == "" {
+				panic("db: invalid operator " + op + " of field " + f.Name)
+			}
+		} else {
+			for _, o := range filterOperators {
+				if o.suffix != "" && len(name) > len(o.suffix) && strings.HasSuffix(name, o.suffix) {
+					name = strings.TrimSuffix(name, o.suffix)
+					operator = o.operator
+					break
+				}
+			}
+		}
+		if operator == "" {
+			operator = "="
+		}
+		if column == "" {
+			if column = m.columnName(name); column == "" {
+				column = ToColumnName(name)
+			}
+		}
+		v := value.Interface()
+		if value.Kind() == reflect.Slice && operator == "=" {
+			w = w.AnyEq(column, v)
+			continue
+		}
+		w = w.add(column+" "+operator+" $1", v)
+	}
+	return
+}
@@ -2,6 +2,7 @@ package gopg
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"strconv"
 	"strings"
@@ -75,8 +76,22 @@ type (
 		query string
 		args  []interface{}
 	}
+
+	// Options can be used in OpenWithOptions.
+	Options struct {
+		// Name of the application shown in pg_stat_activity. It is sent
+		// as a startup parameter, so every connection of the pool has it,
+		// unlike "SET application_name" which only changes the session of
+		// one connection.
+		ApplicationName string
+	}
 )
 
+func init() {
+	db.RegisterNoRowsError(pg.ErrNoRows)
+	db.RegisterErrGetCode(new(DB).ErrGetCode)
+}
+
 // MustOpen is like Open but panics if connect operation fails.
 func MustOpen(conn string) db.DB {
 	c, err := Open(conn)
@@ -86,12 +101,30 @@ func MustOpen(conn string) db.DB {
 	return c
 }
 
+// MustOpenWithOptions is like OpenWithOptions but panics if connect
+// operation fails.
+func MustOpenWithOptions(conn string, options Options) db.DB {
+	c, err := OpenWithOptions(conn, options)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 // Open creates and establishes one connection to database.
 func Open(conn string) (db.DB, error) {
+	return OpenWithOptions(conn, Options{})
+}
+
+// OpenWithOptions is like Open but with options.
+func OpenWithOptions(conn string, options Options) (db.DB, error) {
 	opt, err := pg.ParseURL(conn)
 	if err != nil {
 		return nil, err
 	}
+	if options.ApplicationName != "" {
+		opt.ApplicationName = options.ApplicationName
+	}
 	db := pg.Connect(opt)
 	if err := db.Ping(context.Background()); err != nil {
 		return nil, err
@@ -110,6 +143,11 @@ func (d *DB) ConvertParameters(query string, args []interface{}) (outQuery strin
 	return
 }
 
+// Convert Go slice to PostgreSQL array using go-pg's pg.Array().
+func (d *DB) ConvertArray(slice interface{}) interface{} {
+	return pg.Array(slice)
+}
+
 func (d *DB) Exec(query string, args ...interface{}) (db.Result, error) {
 	re, err := d.DB.Exec(query, args...)
 	if err != nil {
@@ -148,13 +186,31 @@ func (d *DB) ErrNoRows() error {
 	return pg.ErrNoRows
 }
 
+// QuoteIdentifier quotes the identifier with double quotes.
+func (d *DB) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 func (d *DB) ErrGetCode(err error) string {
-	if e, ok := err.(interface{ Field(byte) string }); ok {
+	var e interface{ Field(byte) string }
+	if errors.As(err, &e) {
 		return e.Field('C')
 	}
 	return "unknown"
 }
 
+// Stats returns statistics of the connection pool, pg.PoolStats can be
+// obtained with d.DB.PoolStats().
+func (d *DB) Stats() db.Stats {
+	s := d.DB.PoolStats()
+	return db.Stats{
+		MaxOpen: d.DB.Options().PoolSize,
+		Open:    int(s.TotalConns),
+		InUse:   int(s.TotalConns - s.IdleConns),
+		Idle:    int(s.IdleConns),
+	}
+}
+
 func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (db.Result, error) {
 	re, err := t.Tx.ExecContext(ctx, query, args...)
 	if err != nil {
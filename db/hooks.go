@@ -0,0 +1,54 @@
+package db
+
+type (
+	// Hook can be registered by OnBeforeInsert() or OnBeforeUpdate().
+	Hook func(m *Model, c Changes) error
+)
+
+var (
+	beforeInsertHooks []Hook
+	beforeUpdateHooks []Hook
+)
+
+// OnBeforeInsert registers a global hook which runs for every Model before
+// the INSERT statement is built by Insert(), BatchInsert(), Upsert(), etc.
+// Changes of a row are merged into one Changes, which can be modified by the
+// hook, for example, to add audit fields or tenant id to every row. Hooks
+// run in the order they are registered. If any hook returns error, the
+// statement is not executed and the error is returned when it's executed.
+// Register hooks in init(), it is not safe to register hooks concurrently.
+//  db.OnBeforeInsert(func(m *db.Model, c db.Changes) error {
+//  	for k, v := range m.Changes(db.RawChanges{"TenantId": tenantId}) {
+//  		c[k] = v
+//  	}
+//  	return nil
+//  })
+func OnBeforeInsert(hook Hook) {
+	beforeInsertHooks = append(beforeInsertHooks, hook)
+}
+
+// OnBeforeUpdate is like OnBeforeInsert() but registers a global hook which
+// runs before the UPDATE statement is built by Update() or UpdateFrom().
+func OnBeforeUpdate(hook Hook) {
+	beforeUpdateHooks = append(beforeUpdateHooks, hook)
+}
+
+// runHooks merges lotsOfChanges into one Changes and runs the hooks with it.
+// LotsOfChanges is returned as it is if there are no hooks.
+func (m Model) runHooks(hooks []Hook, lotsOfChanges []Changes) ([]Changes, error) {
+	if len(hooks) == 0 {
+		return lotsOfChanges, nil
+	}
+	merged := Changes{}
+	for _, changes := range lotsOfChanges {
+		for field, value := range changes {
+			merged[field] = value
+		}
+	}
+	for _, hook := range hooks {
+		if err := hook(&m, merged); err != nil {
+			return nil, err
+		}
+	}
+	return []Changes{merged}, nil
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrInvalidHstore = errors.New("invalid hstore value")
+)
+
+type (
+	// hstoreScanner scans text representation of hstore like
+	// "a"=>"1", "b"=>NULL into map[string]string or map[string]*string.
+	hstoreScanner struct {
+		target reflect.Value
+	}
+)
+
+func (h hstoreScanner) Scan(src interface{}) error {
+	var text string
+	switch s := src.(type) {
+	case nil:
+		h.target.Set(reflect.Zero(h.target.Type()))
+		return nil
+	case []byte:
+		text = string(s)
+	case string:
+		text = s
+	default:
+		return ErrTypeAssertionFailed
+	}
+	pairs, err := parseHstore(text)
+	if err != nil {
+		return err
+	}
+	rt := h.target.Type()
+	if rt.Kind() != reflect.Map || rt.Key().Kind() != reflect.String {
+		return ErrTypeAssertionFailed
+	}
+	elem := rt.Elem()
+	m := reflect.MakeMapWithSize(rt, len(pairs))
+	for key, value := range pairs {
+		v := reflect.New(elem).Elem()
+		if value != nil {
+			if elem.Kind() == reflect.Ptr {
+				v.Set(reflect.New(elem.Elem()))
+				v.Elem().SetString(*value)
+			} else {
+				v.SetString(*value)
+			}
+		}
+		m.SetMapIndex(reflect.ValueOf(key).Convert(rt.Key()), v)
+	}
+	h.target.Set(m)
+	return nil
+}
+
+// parseHstore parses text representation of hstore, nil is used for NULL
+// values.
+func parseHstore(text string) (pairs map[string]*string, err error) {
+	pairs = map[string]*string{}
+	i := 0
+	next := func() (s string, quoted bool, ok bool) {
+		for i < len(text) && text[i] == ' ' {
+			i += 1
+		}
+		if i >= len(text) {
+			return
+		}
+		var b strings.Builder
+		if text[i] == '"' {
+			quoted = true
+			for i += 1; i < len(text); i++ {
+				c := text[i]
+				if c == '\\' && i+1 < len(text) {
+					i += 1
+					b.WriteByte(text[i])
+					continue
+				}
+				if c == '"' {
+					i += 1
+					return b.String(), true, true
+				}
+				b.WriteByte(c)
+			}
+			return
+		}
+		for ; i < len(text) && text[i] != ',' && text[i] != '=' && text[i] != ' '; i++ {
+			b.WriteByte(text[i])
+		}
+		return b.String(), false, b.Len() > 0
+	}
+	for {
+		key, _, ok := next()
+		if !ok {
+			break
+		}
+		for i < len(text) && text[i] == ' ' {
+			i += 1
+		}
+		if !strings.HasPrefix(text[i:], "=>") {
+			err = ErrInvalidHstore
+			return
+		}
+		i += 2
+		value, quoted, ok := next()
+		if !ok {
+			err = ErrInvalidHstore
+			return
+		}
+		if !quoted && strings.EqualFold(value, "NULL") {
+			pairs[key] = nil
+		} else {
+			v := value
+			pairs[key] = &v
+		}
+		for i < len(text) && text[i] == ' ' {
+			i += 1
+		}
+		if i < len(text) {
+			if text[i] != ',' {
+				err = ErrInvalidHstore
+				return
+			}
+			i += 1
+		}
+	}
+	return
+}
+
+// hstoreValue returns text representation of hstore of a map with string
+// keys and string (or pointer of string) values, keys are sorted. Other
+// values are returned as they are.
+func hstoreValue(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return value
+	}
+	if rv.IsNil() {
+		return nil
+	}
+	keys := []string{}
+	values := map[string]*string{}
+	iter := rv.MapRange()
+	for iter.Next() {
+		key := iter.Key().String()
+		keys = append(keys, key)
+		v := iter.Value()
+		if v.Kind() == reflect.Interface {
+			v = v.Elem()
+		}
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				values[key] = nil
+				continue
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.String {
+			values[key] = nil
+			continue
+		}
+		s := v.String()
+		values[key] = &s
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		value := "NULL"
+		if values[key] != nil {
+			value = hstoreQuote(*values[key])
+		}
+		pairs = append(pairs, hstoreQuote(key)+"=>"+value)
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func hstoreQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
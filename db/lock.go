@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrAdvisoryLockNotHeld = errors.New("advisory lock is not held")
+)
+
+// AdvisoryLock obtains the session-level advisory lock of the key
+// (pg_advisory_lock), waiting if necessary. Session-level locks are held
+// until AdvisoryUnlock() is called on the same session, but connections of
+// a pool (like pgx and the standard library) are shared, so the lock may be
+// obtained and released on different connections, or left on a connection
+// used by others. Use a dedicated connection (like a pool with only one
+// connection) for session-level locks, or use WithAdvisoryLock() instead.
+func AdvisoryLock(conn DB, key int64) error {
+	return NewModelTable("", conn).NewSQLWithValues("SELECT pg_advisory_lock($1)", key).Execute()
+}
+
+// TryAdvisoryLock is like AdvisoryLock but doesn't wait, acquired is false if
+// the lock is held by others (pg_try_advisory_lock).
+func TryAdvisoryLock(conn DB, key int64) (acquired bool, err error) {
+	err = NewModelTable("", conn).NewSQLWithValues("SELECT pg_try_advisory_lock($1)", key).QueryRow(&acquired)
+	return
+}
+
+// AdvisoryUnlock releases the session-level advisory lock of the key
+// obtained by AdvisoryLock() or TryAdvisoryLock() (pg_advisory_unlock),
+// ErrAdvisoryLockNotHeld is returned if the lock is not held by the session.
+func AdvisoryUnlock(conn DB, key int64) error {
+	var released bool
+	err := NewModelTable("", conn).NewSQLWithValues("SELECT pg_advisory_unlock($1)", key).QueryRow(&released)
+	if err == nil && !released {
+		err = ErrAdvisoryLockNotHeld
+	}
+	return err
+}
+
+// WithAdvisoryLock obtains the transaction-level advisory lock of the key
+// (pg_advisory_xact_lock) in a new transaction, waiting if necessary, then
+// calls fn and releases the lock by committing (or rolling back if fn returns
+// error or panics) the transaction. Because the lock belongs to the
+// transaction, it is safe to use with connection pools.
+//  err := db.WithAdvisoryLock(conn, 42, func() error {
+//  	// only one process can run this at a time
+//  	return nil
+//  })
+func WithAdvisoryLock(conn DB, key int64, fn func() error) error {
+	if conn == nil {
+		return ErrNoConnection
+	}
+	sql := NewModelTable("", conn).NewSQLWithValues("SELECT pg_advisory_xact_lock($1)", key)
+	return sql.transaction(&TxOptions{}, func(ctx context.Context, tx Tx) error {
+		if err := sql.ExecTx(tx, ctx); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+type (
+	// QueryHook can be registered by OnQuery().
+	QueryHook func(label string, duration time.Duration, err error)
+
+	// MetricsHook can be set by Model.SetMetricsHook(). ObserveQuery() is
+	// called after every statement of the Model is executed with the table
+	// name, the first keyword of the statement in upper case (like SELECT,
+	// INSERT or WITH), how long it took and the error (nil if succeeded).
+	MetricsHook interface {
+		ObserveQuery(table, verb string, duration time.Duration, err error)
+	}
+)
+
+var (
+	queryHooks []QueryHook
+)
+
+// OnQuery registers a global hook which runs after every statement is
+// executed by Query(), QueryRow(), Execute(), Cursor(), etc. with the label
+// of the statement (see Label()), how long it took and the error (nil if
+// succeeded), useful for collecting metrics. Hooks run in the order they are
+// registered. Register hooks in init(), it is not safe to register hooks
+// concurrently.
+//  db.OnQuery(func(label string, duration time.Duration, err error) {
+//  	queryDuration.WithLabelValues(label).Observe(duration.Seconds())
+//  })
+func OnQuery(hook QueryHook) {
+	queryHooks = append(queryHooks, hook)
+}
+
+// SetMetricsHook sets the metrics hook of the Model, so you can collect
+// metrics (like with Prometheus) per table and operation without the
+// Model depending on any metrics library. Use nil to remove the hook.
+//  type metrics struct{}
+//
+//  func (metrics) ObserveQuery(table, verb string, duration time.Duration, err error) {
+//  	queryDuration.WithLabelValues(table, verb).Observe(duration.Seconds())
+//  	if err != nil {
+//  		queryErrors.WithLabelValues(table, verb).Inc()
+//  	}
+//  }
+//
+//  m := db.NewModel(models.Order{}, conn, metrics{})
+func (m *Model) SetMetricsHook(hook MetricsHook) *Model {
+	m.metricsHook = hook
+	return m
+}
+
+// Label sets the label of the statement for hooks registered by OnQuery().
+// SQL statements are often different (number of placeholders, etc.) for the
+// same purpose, so they are not good labels for metrics. If no label is set,
+// the label is the table name and the first keyword of the statement in
+// lower case, like "orders.select".
+//  m.Find("WHERE user_id = $1", userId).Label("orders.list").MustQuery(&orders)
+func (s SQLWithValues) Label(label string) SQLWithValues {
+	s.label = label
+	return s
+}
+
+// getLabel returns label of the statement.
+func (s SQLWithValues) getLabel() string {
+	if s.label != "" {
+		return s.label
+	}
+	return s.model.tableName + "." + strings.ToLower(s.verb())
+}
+
+// verb returns the first keyword of the statement in upper case.
+func (s SQLWithValues) verb() string {
+	if idx := strings.IndexAny(s.sql, " \t\n"); idx > -1 {
+		return strings.ToUpper(s.sql[:idx])
+	}
+	return strings.ToUpper(s.sql)
+}
+
+// observe runs hooks registered by OnQuery() and the metrics hook of the
+// Model with duration since start and the error. The query cache of the
+// Model is cleared if the statement may change rows.
+func (s SQLWithValues) observe(start time.Time, err *error) {
+	if s.writes() {
+		s.model.clearQueryCache()
+	}
+	if len(queryHooks) == 0 && s.model.metricsHook == nil {
+		return
+	}
+	duration := time.Since(start)
+	if s.model.metricsHook != nil {
+		s.model.metricsHook.ObserveQuery(s.model.tableName, s.verb(), duration, *err)
+	}
+	label := s.getLabel()
+	for _, hook := range queryHooks {
+		hook(label, duration, *err)
+	}
+}
@@ -1,11 +1,15 @@
 package db
 
 import (
+	"context"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,21 +27,61 @@ type (
 	Model struct {
 		connection   DB
 		logger       logger.Logger
+		columnMapper ColumnMapper
 		structType   reflect.Type
 		tableName    string
 		modelFields  []Field
 		jsonbColumns []string
+		scopeColumn  string
+		scopeValue   interface{}
+		softDelete   bool
+		only         bool
+		zeroValues   bool
+		timeZone     *time.Location
+		metricsHook  MetricsHook
+		cache        *queryCache
 	}
 
 	ModelWithPermittedFields struct {
 		*Model
 		permittedFieldsIdx []int
+		allowedValues      map[string][]interface{}
+		transformers       map[string]reflect.Value
+		strict             bool
 	}
 
 	ModelWithTableName interface {
 		TableName() string
 	}
 
+	// ColumnMapper converts struct field name to column name for fields
+	// without "column" tag. It is like Columnizer but only for one Model,
+	// useful for legacy tables whose column names don't follow the naming
+	// convention. Use it as an option of NewModel(). Column names are not
+	// quoted, so PostgreSQL folds them to lower case.
+	//  legacy := map[string]string{"Id": "uid", "FullName": "fullname"}
+	//  db.NewModel(models.Legacy{}, conn, db.ColumnMapper(func(name string) string {
+	//  	return legacy[name]
+	//  }))
+	ColumnMapper func(fieldName string) string
+
+	// Field is a struct field of the Model, configured by these tags:
+	//  column:"name"            column name instead of the field name
+	//  jsonb:"meta"             key of the jsonb column, see also jsonbKey
+	//  jsonbKey:"firstName"     key in the jsonb column instead of column name
+	//  dataType:"hstore"        data type, columns "GENERATED ALWAYS" are
+	//                           left out in Insert() and Update(), "hstore"
+	//                           for map[string]string or map[string]*string
+	//  composite:"address"      struct of composite type, as ("1 Main St",10)
+	//  aggregate:""             JSON of nested data, which is the default for
+	//                           struct, map and slice types not scannable by
+	//                           the driver, like the result of json_agg()
+	//  enumAs:"text"            enum as MarshalText() or String(), or "int"
+	//  timeLayout:"2006-01-02"  time.Time as text in the layout
+	//  boolAsInt:""             bool as 0 or 1 in smallint column
+	//  unique:"uq_a,uq_b"       names of table-level unique constraints
+	//  references:"authors"     table the foreign key references
+	//  readonly:""              left out in Update() and upserts
 	Field struct {
 		Name       string // struct field name
 		ColumnName string // column name (or jsonb key name) in database
@@ -45,16 +89,80 @@ type (
 		Jsonb      string // jsonb column name in database
 		DataType   string // data type in database
 		Exported   bool   // false if field name is lower case (unexported)
+		Composite  bool   // true if column is a composite type
+		Aggregate  bool   // true if column is JSON of nested data
+		EnumAs     string // "text" to store enum as its text, or "int"
+		TimeLayout string // layout of time stored in text column
+		BoolAsInt  bool   // true if bool is stored as 0 or 1 in integer column
+		References string // table name the column (foreign key) references
+		Unique     string // names of unique constraints (separated by comma)
+		ReadOnly   bool   // true if column can't be updated after insert
 	}
 
 	RawChanges map[string]interface{}
 	Changes    map[Field]interface{}
+
+	// Raw is SQL expression which can be used as value of Changes in
+	// Insert() or Update() (except for fields in jsonb columns), it is put
+	// into the statement as it is instead of being a placeholder parameter.
+	// Never use user input as Raw.
+	Raw string
+
+	cast struct {
+		value    interface{}
+		dataType string
+	}
+)
+
+const (
+	// Default can be used as value of Changes in Insert() or Update() to use
+	// the default value of the column.
+	//  m.Insert(m.Changes(db.RawChanges{"Status": db.Default}))()
+	//  // INSERT INTO orders (status) VALUES (DEFAULT)
+	Default Raw = "DEFAULT"
+
+	// Null can be used as value of Changes in Insert() or Update() to set
+	// the column to NULL, or to remove the key from the jsonb column.
+	//  m.Update(m.Changes(db.RawChanges{"DeletedAt": db.Null, "Picture": db.Null}))()
+	//  // UPDATE categories SET deleted_at = NULL, meta = COALESCE(meta, '{}'::jsonb) - 'picture'
+	Null Raw = "NULL"
+
+	// Statuses of rows returned by Sync().
+	SyncInserted  = "inserted"
+	SyncUpdated   = "updated"
+	SyncUnchanged = "unchanged"
 )
 
 var (
 	ErrMustBePointer = errors.New("must be pointer")
+	ErrUnknownColumn = errors.New("unknown column")
+	ErrMissingColumn = errors.New("missing column")
+
+	ErrUnpermittedFields = errors.New("unpermitted fields")
+
+	ErrWhereWithoutUpdate = errors.New("WHERE clause can't be used when upsert has nothing to update")
+	ErrNothingToUpdate    = errors.New("nothing to update")
 )
 
+// Cast marks a value of Changes to be cast to the data type in Insert(),
+// Update(), Upsert(), etc., useful if the type inferred by the driver is
+// wrong. The placeholder parameter becomes "$n::dataType". Never use user
+// input as the data type. Values in jsonb columns are not cast.
+//  m.Update(m.Changes(db.RawChanges{"Status": db.Cast("paid", "order_status")}))()
+//  // UPDATE orders SET status = $1::order_status
+func Cast(value interface{}, dataType string) interface{} {
+	return cast{value, dataType}
+}
+
+// uncast returns the value marked by Cast(), other values are returned as
+// they are.
+func uncast(value interface{}) interface{} {
+	if c, ok := value.(cast); ok {
+		return c.value
+	}
+	return value
+}
+
 // Initialize a Model from a struct. For available options, see SetOptions().
 func NewModel(object interface{}, options ...interface{}) (m *Model) {
 	m = NewModelSlim(object, options...)
@@ -108,6 +216,20 @@ func (m Model) FieldByName(name string) *Field {
 	return nil
 }
 
+// columnName returns the column name of a struct field name or column name,
+// empty string is returned if no such column. Fields in jsonb are not columns.
+func (m Model) columnName(name string) string {
+	for _, f := range m.modelFields {
+		if f.Jsonb != "" {
+			continue
+		}
+		if f.Name == name || f.ColumnName == name {
+			return f.ColumnName
+		}
+	}
+	return ""
+}
+
 // Generate CREATE TABLE SQL statement from a Model.
 //  | Go Type                                        | PostgreSQL Data Type |
 //  |------------------------------------------------|----------------------|
@@ -117,11 +239,13 @@ func (m Model) FieldByName(name string) *Field {
 //  | float32 / float64 / decimal.Decimal            | numeric              |
 //  | bool                                           | boolean              |
 //  | other                                          | text                 |
-// You can use "dataType" tag to customize the data type. "NOT NULL" is added
-// if the struct field is not a pointer. You can also set SQL statements before
-// or after this statement by defining "BeforeCreateSchema() string" (for
-// example the CREATE EXTENSION statement) or "AfterCreateSchema() string" (for
-// example the CREATE INDEX statement) function for the struct.
+// Integer id column is "SERIAL PRIMARY KEY" (see UseIdentityColumns). You
+// can use "dataType" tag to customize the data type, see Field for other
+// tags. "NOT NULL" is added if the struct field is not a pointer. You can
+// also set SQL statements before or after this statement by defining
+// "BeforeCreateSchema() string" (for example the CREATE EXTENSION statement)
+// or "AfterCreateSchema() string" (for example the CREATE INDEX statement)
+// function for the struct.
 //  db.NewModel(struct {
 //  	__TABLE_NAME__ string `users`
 //
@@ -160,6 +284,7 @@ func (m Model) Schema() string {
 		}
 		sql = append(sql, "\t"+jsonbField+" "+dataType)
 	}
+	sql = append(sql, m.uniqueConstraints()...)
 	out := "CREATE TABLE " + m.tableName + " (\n" + strings.Join(sql, ",\n") + "\n);\n"
 	if m.structType != nil {
 		n := reflect.New(m.structType).Interface()
@@ -173,13 +298,41 @@ func (m Model) Schema() string {
 	return out
 }
 
+// uniqueConstraints returns table-level unique constraints of fields with
+// "unique" tag in order of first appearance of the constraint names.
+func (m Model) uniqueConstraints() (constraints []string) {
+	names := []string{}
+	columns := map[string][]string{}
+	for _, f := range m.modelFields {
+		if f.Jsonb != "" || f.Unique == "" {
+			continue
+		}
+		for _, name := range strings.Split(f.Unique, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if _, ok := columns[name]; !ok {
+				names = append(names, name)
+			}
+			columns[name] = append(columns[name], f.ColumnName)
+		}
+	}
+	for _, name := range names {
+		constraints = append(constraints, "\tCONSTRAINT "+name+" UNIQUE ("+strings.Join(columns[name], ", ")+")")
+	}
+	return
+}
+
 // Generate DROP TABLE ("DROP TABLE IF EXISTS <table_name>;") SQL statement from a Model.
 func (m Model) DropSchema() string {
 	return "DROP TABLE IF EXISTS " + m.tableName + ";\n"
 }
 
-// SetOptions sets database connection (see SetConnection()) and/or logger (see
-// SetLogger()).
+// SetOptions sets database connection (see SetConnection()), logger (see
+// SetLogger()), metrics hook (see SetMetricsHook()), time zone (see
+// SetInsertTimeZone()) and/or column mapper (see ColumnMapper, which only
+// takes effect if it is passed to NewModel()).
 func (m *Model) SetOptions(options ...interface{}) *Model {
 	for _, option := range options {
 		switch o := option.(type) {
@@ -187,6 +340,12 @@ func (m *Model) SetOptions(options ...interface{}) *Model {
 			m.SetConnection(o)
 		case logger.Logger:
 			m.SetLogger(o)
+		case MetricsHook:
+			m.SetMetricsHook(o)
+		case *time.Location:
+			m.SetInsertTimeZone(o)
+		case ColumnMapper:
+			m.columnMapper = o
 		}
 	}
 	return m
@@ -221,7 +380,7 @@ func (m Model) Permit(fieldNames ...string) *ModelWithPermittedFields {
 			break
 		}
 	}
-	return &ModelWithPermittedFields{&m, idx}
+	return &ModelWithPermittedFields{&m, idx, nil, nil, false}
 }
 
 // Permits all available fields except provided of a Model to limit Filter()
@@ -241,7 +400,7 @@ func (m Model) PermitAllExcept(fieldNames ...string) *ModelWithPermittedFields {
 			idx = append(idx, i)
 		}
 	}
-	return &ModelWithPermittedFields{&m, idx}
+	return &ModelWithPermittedFields{&m, idx, nil, nil, false}
 }
 
 // Returns list of permitted field names.
@@ -253,6 +412,121 @@ func (m ModelWithPermittedFields) PermittedFields() (out []string) {
 	return
 }
 
+// AllowValues limits values of a permitted field, Filter() drops the field
+// if its value is not one of the values. Values are compared in text
+// representation after the input is converted to the type of the field, so
+// nil pointer (null) is dropped unless nil is one of the values.
+//  m.Permit("Status").AllowValues("Status", "new", "paid", "cancelled").Filter(
+//  	`{"status": "refunded"}`,
+//  ) // empty Changes
+func (m ModelWithPermittedFields) AllowValues(fieldName string, values ...interface{}) *ModelWithPermittedFields {
+	allowedValues := map[string][]interface{}{}
+	for name, v := range m.allowedValues {
+		allowedValues[name] = v
+	}
+	allowedValues[fieldName] = values
+	m.allowedValues = allowedValues
+	return &m
+}
+
+// Transform registers a function to transform value of a permitted field in
+// Filter(), like normalizing the input. The function must have one argument
+// and one return value, for example, func(string) string or
+// func(interface{}) interface{}. If the field is a pointer, the function
+// can also accept the type the pointer points to, nil pointer is left
+// untouched. Values that are not assignable to type of the argument are
+// left untouched too. Values are transformed before checked by
+// AllowValues(). Transform panics if transformer is not a valid function.
+//  m.Permit("Email").Transform("Email", strings.ToLower).Filter(
+//  	`{"email": "FOO@example.com"}`,
+//  ) // Email is "foo@example.com"
+func (m ModelWithPermittedFields) Transform(fieldName string, transformer interface{}) *ModelWithPermittedFields {
+	fn := reflect.ValueOf(transformer)
+	if fn.Kind() != reflect.Func || fn.IsNil() || fn.Type().NumIn() != 1 || fn.Type().NumOut() != 1 {
+		panic("db: transformer must be a function with one argument and one return value")
+	}
+	transformers := map[string]reflect.Value{}
+	for name, f := range m.transformers {
+		transformers[name] = f
+	}
+	transformers[fieldName] = fn
+	m.transformers = transformers
+	return &m
+}
+
+// transform returns value transformed by the function registered by
+// Transform().
+func (m ModelWithPermittedFields) transform(field Field, value interface{}) interface{} {
+	fn, ok := m.transformers[field.Name]
+	if !ok {
+		return value
+	}
+	in := fn.Type().In(0)
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		return fn.Call([]reflect.Value{reflect.Zero(in)})[0].Interface()
+	}
+	if rv.Type().AssignableTo(in) {
+		return fn.Call([]reflect.Value{rv})[0].Interface()
+	}
+	if rv.Kind() == reflect.Ptr && rv.Type().Elem().AssignableTo(in) {
+		if rv.IsNil() {
+			return value
+		}
+		out := fn.Call([]reflect.Value{rv.Elem()})[0]
+		if !out.Type().AssignableTo(rv.Type().Elem()) {
+			return out.Interface()
+		}
+		ptr := reflect.New(rv.Type().Elem())
+		ptr.Elem().Set(out)
+		return ptr.Interface()
+	}
+	return value
+}
+
+// isAllowed returns false if the field has allowed values set by
+// AllowValues() and the value is not one of them.
+func (m ModelWithPermittedFields) isAllowed(field Field, value interface{}) bool {
+	values, ok := m.allowedValues[field.Name]
+	if !ok {
+		return true
+	}
+	text := func(value interface{}) *string {
+		rv := reflect.ValueOf(value)
+		for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+			if rv.IsNil() {
+				return nil
+			}
+			rv = rv.Elem()
+		}
+		if !rv.IsValid() {
+			return nil
+		}
+		s := fmt.Sprint(rv.Interface())
+		return &s
+	}
+	t := text(value)
+	for _, v := range values {
+		a := text(v)
+		if (a == nil && t == nil) || (a != nil && t != nil && *a == *t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strict returns a copy of the permitted fields that makes TryFilter() return
+// ErrUnpermittedFields with the unexpected keys (not JSON names of the
+// permitted fields) of the inputs. Only TryFilter() is strict, Filter() and
+// FilterWithMeta() can't return errors, so they still silently ignore the
+// unexpected keys. Fields of struct inputs are not checked.
+//  _, err := m.Permit("Name").Strict().TryFilter(`{"name":"foo","admin":true}`)
+//  // unpermitted fields: admin
+func (m ModelWithPermittedFields) Strict() *ModelWithPermittedFields {
+	m.strict = true
+	return &m
+}
+
 // MustBind is like Bind but panics if bind operation fails.
 func (m ModelWithPermittedFields) MustBind(ctx interface{ Bind(interface{}) error }, target interface{}) Changes {
 	c, err := m.Bind(ctx, target)
@@ -317,28 +591,61 @@ func (m ModelWithPermittedFields) Bind(ctx interface{ Bind(interface{}) error },
 //  	struct{ Age int }{60},
 //  ) // Age is 60
 func (m ModelWithPermittedFields) Filter(inputs ...interface{}) (out Changes) {
+	out, _, _ = m.filter(inputs, false)
+	return
+}
+
+// FilterWithMeta is like Filter() but also returns JSON names of the fields
+// in the output (present) and keys of the inputs that are dropped (ignored),
+// because they are not permitted, can't be converted to the type of the
+// field or are not allowed by AllowValues(). A key is not ignored if any of
+// the inputs has valid value of it. Fields of struct inputs that are not
+// permitted are not listed. Both lists are sorted.
+//  c, present, ignored := m.Permit("Name").FilterWithMeta(`{"name":"foo","admin":true}`)
+//  // present: [name], ignored: [admin]
+func (m ModelWithPermittedFields) FilterWithMeta(inputs ...interface{}) (out Changes, present, ignored []string) {
+	out, ignored, _ = m.filter(inputs, false)
+	present = []string{}
+	for field := range out {
+		present = append(present, field.JsonName)
+	}
+	sort.Strings(present)
+	return
+}
+
+// TryFilter is like Filter() but returns error if any input is invalid JSON.
+// If Strict() is used, ErrUnpermittedFields with the unexpected keys of the
+// inputs is returned, use errors.Is() to compare.
+func (m ModelWithPermittedFields) TryFilter(inputs ...interface{}) (Changes, error) {
+	out, _, err := m.filter(inputs, true)
+	return out, err
+}
+
+// filter returns values of permitted fields of the inputs and the sorted
+// keys of the inputs that are dropped.
+func (m ModelWithPermittedFields) filter(inputs []interface{}, stopOnError bool) (out Changes, ignored []string, err error) {
 	out = Changes{}
+	var unpermitted, dropped []string
+	add := func(u, d []string) {
+		unpermitted = append(unpermitted, u...)
+		dropped = append(dropped, d...)
+	}
 	for _, input := range inputs {
+		var data []byte
+		var readErr error
 		switch in := input.(type) {
 		case RawChanges:
-			m.filterPermits(in, &out)
+			add(m.filterPermits(in, &out))
+			continue
 		case map[string]interface{}:
-			m.filterPermits(in, &out)
+			add(m.filterPermits(in, &out))
+			continue
 		case string:
-			var c RawChanges
-			if json.Unmarshal([]byte(in), &c) == nil {
-				m.filterPermits(c, &out)
-			}
+			data = []byte(in)
 		case []byte:
-			var c RawChanges
-			if json.Unmarshal(in, &c) == nil {
-				m.filterPermits(c, &out)
-			}
+			data = in
 		case io.Reader:
-			var c RawChanges
-			if json.NewDecoder(in).Decode(&c) == nil {
-				m.filterPermits(c, &out)
-			}
+			data, readErr = ioutil.ReadAll(in)
 		default:
 			rt := reflect.TypeOf(in)
 			if rt.Kind() == reflect.Struct {
@@ -350,17 +657,72 @@ func (m ModelWithPermittedFields) Filter(inputs ...interface{}) (out Changes) {
 				}
 				for i := 0; i < rt.NumField(); i++ {
 					if field, ok := fields[rt.Field(i).Name]; ok {
-						out[field] = rv.Field(i).Interface()
+						if value := m.transform(field, rv.Field(i).Interface()); m.isAllowed(field, value) {
+							out[field] = value
+						} else {
+							dropped = append(dropped, field.JsonName)
+						}
 					}
 				}
 			}
+			continue
+		}
+		var c RawChanges
+		if readErr == nil {
+			readErr = JSONUnmarshal(data, &c)
+		}
+		if readErr != nil {
+			if stopOnError {
+				err = readErr
+				return
+			}
+			continue
+		}
+		add(m.filterPermits(c, &out))
+	}
+	unpermitted = uniqueStrings(unpermitted, nil)
+	present := map[string]bool{}
+	for field := range out {
+		present[field.JsonName] = true
+	}
+	ignored = uniqueStrings(append(unpermitted, dropped...), present)
+	if m.strict && len(unpermitted) > 0 {
+		err = fmt.Errorf("%w: %s", ErrUnpermittedFields, strings.Join(unpermitted, ", "))
+	}
+	return
+}
 
+// uniqueStrings returns sorted unique strings that are not in except.
+func uniqueStrings(strs []string, except map[string]bool) (out []string) {
+	out = []string{}
+	seen := map[string]bool{}
+	for _, s := range strs {
+		if seen[s] || except[s] {
+			continue
 		}
+		seen[s] = true
+		out = append(out, s)
 	}
+	sort.Strings(out)
 	return
 }
 
-func (m ModelWithPermittedFields) filterPermits(in RawChanges, out *Changes) {
+// filterPermits puts values of permitted fields into out and returns keys
+// that are not JSON names of the permitted fields (unpermitted) and keys of
+// the permitted fields whose values are dropped (dropped).
+func (m ModelWithPermittedFields) filterPermits(in RawChanges, out *Changes) (unpermitted, dropped []string) {
+	for key := range in {
+		found := false
+		for _, i := range m.permittedFieldsIdx {
+			if m.modelFields[i].JsonName == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unpermitted = append(unpermitted, key)
+		}
+	}
 	for _, i := range m.permittedFieldsIdx {
 		field := m.modelFields[i]
 		if _, ok := in[field.JsonName]; !ok {
@@ -373,16 +735,23 @@ func (m ModelWithPermittedFields) filterPermits(in RawChanges, out *Changes) {
 		if !ok {
 			continue
 		}
-		v, err := json.Marshal(in[field.JsonName])
+		v, err := JSONMarshal(in[field.JsonName])
 		if err != nil {
+			dropped = append(dropped, field.JsonName)
 			continue
 		}
 		x := reflect.New(f.Type)
-		if err := json.Unmarshal(v, x.Interface()); err != nil {
+		if err := JSONUnmarshal(v, x.Interface()); err != nil {
+			dropped = append(dropped, field.JsonName)
 			continue
 		}
-		(*out)[field] = x.Elem().Interface()
+		if value := m.transform(field, x.Elem().Interface()); m.isAllowed(field, value) {
+			(*out)[field] = value
+		} else {
+			dropped = append(dropped, field.JsonName)
+		}
 	}
+	return
 }
 
 // Convert RawChanges to Changes.
@@ -416,17 +785,175 @@ func (m Model) Changes(in RawChanges) (out Changes) {
 //  var user models.User
 //  db.NewModel(models.User{}, conn).Find("WHERE id = $1", 1).MustQuery(&user)
 func (m Model) Find(values ...interface{}) SQLWithValues {
-	fields := []string{}
+	return m.Select(strings.Join(m.columns(), ", "), values...)
+}
+
+// columns returns column names of all fields and jsonb columns.
+func (m Model) columns() (columns []string) {
 	for _, field := range m.modelFields {
 		if field.Jsonb != "" {
 			continue
 		}
-		fields = append(fields, field.ColumnName)
+		columns = append(columns, field.ColumnName)
 	}
 	for _, jsonbField := range m.jsonbColumns {
-		fields = append(fields, jsonbField)
+		columns = append(columns, jsonbField)
+	}
+	return
+}
+
+// FindExcept is like Find but the jsonb columns are not selected, fields in
+// these jsonb columns are left untouched when the results are put into the
+// struct. Useful for large jsonb columns that you don't need.
+//  var users []models.User
+//  db.NewModel(models.User{}, conn).FindExcept([]string{"meta"}).MustQuery(&users)
+func (m Model) FindExcept(jsonbColumns []string, values ...interface{}) SQLWithValues {
+	columns := []string{}
+	for _, jsonbField := range m.jsonbColumns {
+		if !stringsContain(jsonbColumns, jsonbField) {
+			columns = append(columns, jsonbField)
+		}
 	}
-	return m.Select(strings.Join(fields, ", "), values...)
+	m.jsonbColumns = columns
+	return m.Find(values...)
+}
+
+// QuoteIdentifier quotes the identifier (like column name) so that it can
+// be a reserved word or have special characters. If the connection
+// implements QuoteIdentifier, it is used, otherwise the identifier is quoted
+// with double quotes like PostgreSQL.
+//  m.QuoteIdentifier(`user "name"`) // "user ""name"""
+func (m Model) QuoteIdentifier(name string) string {
+	if q, ok := m.connection.(QuoteIdentifier); ok {
+		return q.QuoteIdentifier(name)
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// SelectJsonbKeys builds a SELECT statement to select text values of the
+// keys of the jsonb column as columns named after the keys. Results can be
+// put into any struct whose fields have the same column names as the keys.
+// You can provide conditions to the function returned.
+//  var products []struct {
+//  	Color string
+//  	Size  string
+//  }
+//  // SELECT meta->>'color' AS "color", meta->>'size' AS "size" FROM products WHERE id > $1
+//  m.SelectJsonbKeys("meta", "color", "size")("WHERE id > $1", 10).MustQuery(&products)
+func (m Model) SelectJsonbKeys(column string, keys ...string) func(...interface{}) SQLWithValues {
+	fields := []string{}
+	for _, key := range keys {
+		fields = append(fields, column+"->>'"+strings.ReplaceAll(key, "'", "''")+"' AS "+m.QuoteIdentifier(key))
+	}
+	return func(values ...interface{}) SQLWithValues {
+		return m.Select(strings.Join(fields, ", "), values...)
+	}
+}
+
+// LatestPerGroup is like Find but finds only the latest row (the row with the
+// greatest value of the order column, NULLs are considered the oldest) of
+// each group of rows with the same value of the group column, using SELECT
+// DISTINCT ON. Columns can be struct field names or column names of the
+// Model, ErrUnknownColumn is returned when the statement is executed if any
+// of them is not found. You can provide conditions (without ORDER BY) to
+// the function returned, and add more columns to order rows with the same
+// value of the order column with OrderBy().
+//  var orders []models.Order
+//  // SELECT DISTINCT ON (user_id) ... FROM orders WHERE status = $1
+//  // ORDER BY user_id, created_at DESC NULLS LAST, id DESC
+//  m.LatestPerGroup("UserId", "CreatedAt")("WHERE status = $1", "paid").OrderBy("Id", db.Desc).MustQuery(&orders)
+func (m Model) LatestPerGroup(groupColumn, orderColumn string) func(...interface{}) SQLWithValues {
+	return func(values ...interface{}) SQLWithValues {
+		group, order := m.columnName(groupColumn), m.columnName(orderColumn)
+		sql := m.Select("DISTINCT ON ("+group+") "+strings.Join(m.columns(), ", "), values...)
+		if group == "" || order == "" {
+			return sql.withError(ErrUnknownColumn)
+		}
+		return sql.OrderBy(group).OrderBy(order, Desc, NullsLast)
+	}
+}
+
+// LeftJoinLateral builds a SELECT statement of the table LEFT JOIN LATERAL
+// the subquery as the alias, the subquery can refer to columns of the table,
+// useful for correlated subqueries like top N rows per row of the table.
+// Rows of the table without rows from the subquery are kept with NULLs. This
+// is an advanced feature, fields are not validated and you should qualify
+// column names with the table name or the alias. Placeholders of the
+// conditions of the function returned are renumbered after the ones of
+// the subquery.
+//  var rows []struct {
+//  	OrderId  int
+//  	ItemName *string
+//  }
+//  items := db.NewModelTable("items", conn)
+//  top := items.Select("name", "WHERE items.order_id = orders.id ORDER BY price DESC LIMIT $1", 3)
+//  // SELECT orders.id, top.name FROM orders LEFT JOIN LATERAL (SELECT name FROM items
+//  // WHERE items.order_id = orders.id ORDER BY price DESC LIMIT $1) top ON true WHERE orders.status = $2
+//  m.LeftJoinLateral("orders.id, top.name", top, "top")("WHERE orders.status = $1", "paid").MustQuery(&rows)
+func (m Model) LeftJoinLateral(fields string, subquery SQLWithValues, alias string) func(...interface{}) SQLWithValues {
+	return func(values ...interface{}) SQLWithValues {
+		subValues := subquery.rawValues()
+		where, values := m.scope(splitConditions(values))
+		sql := "SELECT " + fields + " FROM " + m.fromTable() +
+			" LEFT JOIN LATERAL (" + subquery.rawSQL() + ") " + alias + " ON true " + renumber(where, len(subValues))
+		return m.NewSQLWithValues(sql, append(subValues, values...)...).withError(subquery.err)
+	}
+}
+
+// Join builds a SELECT statement of the table INNER JOIN the table of the
+// other Model on the condition. Like LeftJoinLateral(), fields are not
+// validated and you should qualify column names with the table names. If
+// the other Model is SoftDelete(), the condition to exclude its soft
+// deleted rows is added to the ON clause, soft deleted rows (and the scope)
+// of this Model are excluded in the WHERE clause as usual.
+//  authors := db.NewModel(models.Author{}, conn).SoftDelete()
+//  books := db.NewModel(models.Book{}, conn).SoftDelete()
+//  // SELECT authors.name, books.title FROM authors JOIN books ON (books.author_id = authors.id)
+//  // AND books.deleted_at IS NULL WHERE authors.deleted_at IS NULL
+//  authors.Join("authors.name, books.title", books, "books.author_id = authors.id")().MustQuery(&rows)
+func (m Model) Join(fields string, other *Model, on string) func(...interface{}) SQLWithValues {
+	return m.join("JOIN", fields, other, on)
+}
+
+// LeftJoin is like Join but builds LEFT JOIN, rows of the table without
+// (active) rows of the other table are kept with NULLs.
+func (m Model) LeftJoin(fields string, other *Model, on string) func(...interface{}) SQLWithValues {
+	return m.join("LEFT JOIN", fields, other, on)
+}
+
+func (m Model) join(kind, fields string, other *Model, on string) func(...interface{}) SQLWithValues {
+	return func(values ...interface{}) SQLWithValues {
+		condition := on
+		if other.softDelete {
+			condition = "(" + on + ") AND " + other.tableRef() + "." + other.deletedAtColumn() + " IS NULL"
+		}
+		where, values := m.scope(splitConditions(values))
+		sql := "SELECT " + fields + " FROM " + m.fromTable() + " " + kind + " " + other.fromTable() + " ON " + condition + " " + where
+		return m.NewSQLWithValues(sql, values...)
+	}
+}
+
+// FindOrPrimary is like Find but executes the query and put the results into
+// the target immediately. The connection of the Model is treated as a read
+// replica, if no rows are found (ErrNoRows for struct, or empty slice or
+// map), the query is executed once again on the primary. This gives you
+// read-your-writes consistency for records you just created or updated on
+// the primary, at the cost of one more query for records that really don't
+// exist. Records that are updated (not created) on the primary may still be
+// stale because they can be found on the replica.
+//  var order models.Order
+//  m := db.NewModel(models.Order{}, replica)
+//  m.FindOrPrimary(primary, &order, "WHERE id = $1", newOrderId)
+func (m Model) FindOrPrimary(primary DB, target interface{}, values ...interface{}) error {
+	n, err := m.Find(values...).QueryWithCount(target)
+	if err != nil {
+		if m.connection == nil || !errors.Is(err, m.connection.ErrNoRows()) {
+			return err
+		}
+	} else if n > 0 {
+		return nil
+	}
+	return m.SetConnection(primary).Find(values...).Query(target)
 }
 
 // Select is like Find but you can choose what columns to retrieve.
@@ -445,15 +972,85 @@ func (m Model) Find(values ...interface{}) SQLWithValues {
 //  }
 //  db.NewModelTable("users", conn).Select("name, id", "ORDER BY id ASC").MustQuery(&users)
 func (m Model) Select(fields string, values ...interface{}) SQLWithValues {
-	var where string
-	if len(values) > 0 {
-		if w, ok := values[0].(string); ok {
-			where = w
-			values = values[1:]
+	where, values := m.scope(splitConditions(values))
+	sql := "SELECT " + fields + " FROM " + m.fromTable()
+	s := m.NewSQLWithValues(sql+" "+where, values...)
+	s.tableEnd = len(sql)
+	return s
+}
+
+// SelectInto is like Find() but only selects columns of the fields (struct
+// field names or column names) and scans the first row into these fields of
+// the target (pointer of a struct of the Model), other fields of the target
+// are left untouched, so you can refresh part of a loaded struct. Fields in
+// jsonb columns are selected with the -> operator. ErrUnknownColumn is
+// returned if any field is unknown.
+//  // SELECT status, updated_at FROM orders WHERE id = $1
+//  m.SelectInto([]string{"Status", "UpdatedAt"}, &order, "WHERE id = $1", order.Id)
+func (m Model) SelectInto(fieldNames []string, target interface{}, values ...interface{}) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+	rv = rv.Elem()
+	columns := []string{}
+	dests := []interface{}{}
+	for _, name := range fieldNames {
+		var field *Field
+		for i, f := range m.modelFields {
+			if f.Name == name || (f.Jsonb == "" && f.ColumnName == name) {
+				field = &m.modelFields[i]
+				break
+			}
+		}
+		if field == nil {
+			return ErrUnknownColumn
+		}
+		f := rv.FieldByName(field.Name)
+		if !f.IsValid() {
+			return ErrUnknownColumn
+		}
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+		if field.Jsonb != "" {
+			columns = append(columns, field.Jsonb+"->'"+field.ColumnName+"'")
+			dests = append(dests, &aggregateScanner{f})
+			continue
 		}
+		columns = append(columns, field.ColumnName)
+		dests = append(dests, field.scanner(f.Addr().Interface()))
 	}
-	sql := "SELECT " + fields + " FROM " + m.tableName + " " + where
-	return m.NewSQLWithValues(sql, values...)
+	return m.Select(strings.Join(columns, ", "), values...).QueryRow(dests...)
+}
+
+// Only returns a copy of the Model whose SELECT, UPDATE and DELETE
+// statements use "ONLY table_name", so rows of the child tables inheriting
+// from the table (CREATE TABLE ... INHERITS) are not included, only rows
+// stored in the table itself are. A partitioned table stores no rows itself,
+// so nothing is found with ONLY. Insert() is not affected.
+//  // SELECT COUNT(*) FROM ONLY orders
+//  m.Only().MustCount()
+func (m Model) Only() *Model {
+	m.only = true
+	return &m
+}
+
+// fromTable returns table name used in FROM, UPDATE and DELETE FROM.
+func (m Model) fromTable() string {
+	if m.only {
+		return "ONLY " + m.tableName
+	}
+	return m.tableName
+}
+
+// tableRef returns the name to qualify column names with, which is the alias
+// if the table name has one ("users AS u" or "users u"), otherwise the
+// (schema-qualified) table name.
+func (m Model) tableRef() string {
+	names := strings.Fields(m.tableName)
+	if len(names) == 0 {
+		return m.tableName
+	}
+	return names[len(names)-1]
 }
 
 // MustCount is like Count but panics if count operation fails.
@@ -474,6 +1071,67 @@ func (m Model) Count(values ...interface{}) (count int, err error) {
 	return
 }
 
+// MustCountByGroup is like CountByGroup but panics if count operation fails.
+func (m Model) MustCountByGroup(groupField string, values ...interface{}) map[string]int {
+	counts, err := m.CountByGroup(groupField, values...)
+	if err != nil {
+		panic(err)
+	}
+	return counts
+}
+
+// CountByGroup counts rows of each value of the field (struct field name or
+// column name), keys of the map are the values in text, NULL is counted as
+// empty string. You can provide conditions (like WHERE) as the first
+// argument, GROUP BY is added after them. The rest arguments are for any
+// placeholder parameters in the conditions. ErrUnknownColumn is returned if
+// the field is unknown.
+//  // SELECT COALESCE(status::text, ''), COUNT(*) FROM orders WHERE user_id = $1 GROUP BY status
+//  counts, err := m.CountByGroup("Status", "WHERE user_id = $1", 1) // map[new:2 paid:1]
+func (m Model) CountByGroup(groupField string, values ...interface{}) (counts map[string]int, err error) {
+	column := m.columnName(groupField)
+	if column == "" {
+		err = ErrUnknownColumn
+		return
+	}
+	conditions, args := splitConditions(values)
+	conditions = strings.TrimSpace(conditions + " GROUP BY " + column)
+	counts = map[string]int{}
+	err = m.Select("COALESCE("+column+"::text, ''), COUNT(*)", append([]interface{}{conditions}, args...)...).Query(&counts)
+	return
+}
+
+// MustEstimatedCount is like EstimatedCount but panics if count operation
+// fails.
+func (m Model) MustEstimatedCount() int {
+	count, err := m.EstimatedCount()
+	if err != nil {
+		panic(err)
+	}
+	return count
+}
+
+// EstimatedCount returns estimated number of rows of the table from
+// statistics in pg_class, which is much faster than Count() for huge tables
+// but is only an approximation (like the one used by the query planner),
+// conditions and scope are not supported. The statistics are updated by
+// VACUUM, ANALYZE and CREATE INDEX, the estimate is scaled by the current
+// size of the table to catch up with changes since then. If the table has
+// never been analyzed (reltuples is -1, or 0 before PostgreSQL 14) or the
+// estimate is 0, Count() is used instead.
+func (m Model) EstimatedCount() (count int, err error) {
+	err = m.NewSQLWithValues("SELECT (CASE WHEN c.reltuples < 0 THEN -1 "+
+		"WHEN c.relpages = 0 THEN c.reltuples "+
+		"ELSE c.reltuples / c.relpages * (pg_relation_size(c.oid) / current_setting('block_size')::int) END)::bigint "+
+		"FROM pg_class c WHERE c.oid = to_regclass($1)", m.tableName).QueryRow(&count)
+	if err == nil && count <= 0 {
+		m.scopeColumn = ""
+		m.softDelete = false
+		return m.Count()
+	}
+	return
+}
+
 // MustExists is like Exists but panics if existence check operation fails.
 // Returns true if record exists, false if not exists.
 func (m Model) MustExists(values ...interface{}) bool {
@@ -489,7 +1147,7 @@ func (m Model) MustExists(values ...interface{}) bool {
 func (m Model) Exists(values ...interface{}) (exists bool, err error) {
 	var ret int
 	err = m.Select("1 AS one", values...).QueryRow(&ret)
-	if err == m.connection.ErrNoRows() {
+	if errors.Is(err, m.connection.ErrNoRows()) {
 		err = nil
 		return
 	}
@@ -497,6 +1155,30 @@ func (m Model) Exists(values ...interface{}) (exists bool, err error) {
 	return
 }
 
+// IsNoRows returns true if err is (or wraps) the no rows error of the
+// connection. If the Model has no connection, it is the same as
+// db.IsNoRows().
+func (m Model) IsNoRows(err error) bool {
+	if m.connection == nil {
+		return IsNoRows(err)
+	}
+	return err != nil && errors.Is(err, m.connection.ErrNoRows())
+}
+
+// ErrHasCode returns true if err is (or wraps) an error from the database
+// with the SQLSTATE code (see ErrGetCode() of the connection), for example,
+// "23505" for unique violation. False is returned if the Model has no
+// connection.
+//  if err := m.Insert(changes...)().Execute(); m.ErrHasCode(err, "23505") {
+//  	// duplicate
+//  }
+func (m Model) ErrHasCode(err error, code string) bool {
+	if err == nil || m.connection == nil {
+		return false
+	}
+	return m.connection.ErrGetCode(err) == code
+}
+
 // MustAssign is like Assign but panics if assign operation fails.
 func (m Model) MustAssign(i interface{}, lotsOfChanges ...Changes) []Changes {
 	out, err := m.Assign(i, lotsOfChanges...)
@@ -531,14 +1213,17 @@ func (m Model) Assign(target interface{}, lotsOfChanges ...Changes) (out []Chang
 	for _, changes := range lotsOfChanges {
 		for field, value := range changes {
 			f := rv.FieldByName(field.Name)
+			if !f.IsValid() {
+				continue
+			}
 			var pointer interface{}
 			if field.Exported {
 				pointer = f.Addr().Interface()
 			} else {
 				pointer = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Interface()
 			}
-			b, _ := json.Marshal(value)
-			json.Unmarshal(b, pointer)
+			b, _ := JSONMarshal(value)
+			JSONUnmarshal(b, pointer)
 		}
 	}
 	out = lotsOfChanges
@@ -547,7 +1232,10 @@ func (m Model) Assign(target interface{}, lotsOfChanges ...Changes) (out []Chang
 
 // Insert builds an INSERT INTO statement with fields and values in the
 // changes, returns a function with optional string argument which you can add
-// extra clause (like ON CONFLICT or RETURNING) to the statement.
+// extra clause (like ON CONFLICT or RETURNING) to the statement. Columns are
+// in the order of the fields of the struct (jsonb columns are after other
+// columns of the same changes), so the statement is always the same for the
+// same fields.
 //  var id int
 //  m.Insert(changes...)("RETURNING id").MustQueryRow(&id)
 func (m Model) Insert(lotsOfChanges ...Changes) func(...string) SQLWithValues {
@@ -556,71 +1244,759 @@ func (m Model) Insert(lotsOfChanges ...Changes) func(...string) SQLWithValues {
 		if len(args) > 0 {
 			suffix = args[0]
 		}
-		fields := []string{}
-		fieldsIndex := map[string]int{}
-		numbers := []string{}
-		values := []interface{}{}
-		jsonbFields := map[string]Changes{}
-		i := 1
+		fields, numbers, values, err := m.insertValues(1, lotsOfChanges)
+		sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(numbers, ", ") + ") " + suffix
+		return m.NewSQLWithValues(sql, values...).withError(err)
+	}
+}
+
+// insertValues returns column names, placeholders (starting from $i) and
+// values of the changes for the INSERT statement.
+func (m Model) insertValues(i int, lotsOfChanges []Changes) (fields, numbers []string, values []interface{}, err error) {
+	fields, rows, values, err := m.batchInsertValues(i, [][]Changes{lotsOfChanges})
+	if err == nil {
+		numbers = rows[0]
+	}
+	return
+}
+
+// batchInsertValues is like insertValues but for multiple rows. Column names
+// are collected from all rows, DEFAULT is used if a row doesn't have the
+// column. Hooks registered by OnBeforeInsert() run for each row.
+func (m Model) batchInsertValues(i int, rows [][]Changes) (fields []string, numbers [][]string, values []interface{}, err error) {
+	fieldsIndex := map[string]int{}
+	rowsValues := make([][]interface{}, 0, len(rows))
+	for _, lotsOfChanges := range rows {
+		lotsOfChanges, err = m.runHooks(beforeInsertHooks, lotsOfChanges)
+		if err != nil {
+			return
+		}
+		lotsOfChanges, err = m.scopeChanges(lotsOfChanges, true)
+		if err != nil {
+			return
+		}
+		rowValues := make([]interface{}, 0, len(fields))
+		var jsonbFields map[string]Changes
 		for _, changes := range lotsOfChanges {
-			for field, value := range changes {
+			for _, field := range m.sortedFields(changes) {
+				value := m.inTimeZone(changes[field])
 				if field.Jsonb != "" {
+					if jsonbFields == nil {
+						jsonbFields = map[string]Changes{}
+					}
 					if _, ok := jsonbFields[field.Jsonb]; !ok {
 						jsonbFields[field.Jsonb] = Changes{}
 					}
 					jsonbFields[field.Jsonb][field] = value
 					continue
 				}
-				if idx, ok := fieldsIndex[field.Name]; ok { // prevent duplication
-					values[idx] = value
+				if field.generatedAlways() {
 					continue
 				}
-				fields = append(fields, field.ColumnName)
-				fieldsIndex[field.Name] = i - 1
-				numbers = append(numbers, fmt.Sprintf("$%d", i))
-				values = append(values, value)
-				i += 1
+				idx, ok := fieldsIndex[field.Name] // prevent duplication
+				if !ok {
+					idx = len(fields)
+					fieldsIndex[field.Name] = idx
+					fields = append(fields, field.ColumnName)
+				}
+				rowValues = setRowValue(rowValues, idx, field.convertValue(value))
 			}
 		}
-		for jsonbField, changes := range jsonbFields {
-			fields = append(fields, jsonbField)
-			numbers = append(numbers, fmt.Sprintf("$%d", i))
-			out := map[string]interface{}{}
-			for field, value := range changes {
-				out[field.ColumnName] = value
+		for _, jsonbField := range m.sortedJsonbColumns(jsonbFields) {
+			changes := jsonbFields[jsonbField]
+			idx, ok := fieldsIndex["jsonb:"+jsonbField]
+			if !ok {
+				idx = len(fields)
+				fieldsIndex["jsonb:"+jsonbField] = idx
+				fields = append(fields, jsonbField)
 			}
-			j, _ := json.Marshal(out)
-			values = append(values, string(j))
+			var object string
+			object, err = m.jsonbObject(changes)
+			if err != nil {
+				return
+			}
+			rowValues = setRowValue(rowValues, idx, object)
+		}
+		rowsValues = append(rowsValues, rowValues)
+	}
+	numbers = make([][]string, 0, len(rowsValues))
+	values = make([]interface{}, 0, len(rowsValues)*len(fields))
+	for _, rowValues := range rowsValues {
+		row := make([]string, 0, len(fields))
+		for idx := range fields {
+			value := interface{}(Default)
+			if idx < len(rowValues) {
+				value = rowValues[idx]
+			}
+			if raw, ok := value.(Raw); ok {
+				row = append(row, string(raw))
+				continue
+			}
+			if c, ok := value.(cast); ok {
+				row = append(row, "$"+strconv.Itoa(i)+"::"+c.dataType)
+				values = append(values, c.value)
+				i += 1
+				continue
+			}
+			row = append(row, "$"+strconv.Itoa(i))
+			values = append(values, value)
 			i += 1
 		}
-		sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(numbers, ", ") + ") " + suffix
-		return m.NewSQLWithValues(sql, values...)
+		numbers = append(numbers, row)
 	}
+	return
+}
+
+// setRowValue sets value of the column at idx of the row, columns before it
+// without values use DEFAULT.
+func setRowValue(row []interface{}, idx int, value interface{}) []interface{} {
+	for len(row) <= idx {
+		row = append(row, Default)
+	}
+	row[idx] = value
+	return row
+}
+
+// sortedFields returns fields of the changes in the order of the fields of
+// the Model, so the statements are the same every time. Fields not of the
+// Model come last in order of their names.
+func (m Model) sortedFields(changes Changes) []Field {
+	fields := make([]Field, 0, len(changes))
+	for _, field := range m.modelFields {
+		if _, ok := changes[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) == len(changes) {
+		return fields
+	}
+	others := []Field{}
+	for field := range changes {
+		if !m.hasField(field) {
+			others = append(others, field)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		if others[i].Name != others[j].Name {
+			return others[i].Name < others[j].Name
+		}
+		return others[i].Jsonb < others[j].Jsonb
+	})
+	return append(fields, others...)
+}
+
+// sortedJsonbColumns returns keys of the map in the order of the jsonb
+// columns of the Model, unknown columns come last in alphabetical order.
+func (m Model) sortedJsonbColumns(jsonbFields map[string]Changes) []string {
+	columns := []string{}
+	for _, column := range m.jsonbColumns {
+		if _, ok := jsonbFields[column]; ok {
+			columns = append(columns, column)
+		}
+	}
+	others := []string{}
+	for column := range jsonbFields {
+		if !stringsContain(m.jsonbColumns, column) {
+			others = append(others, column)
+		}
+	}
+	sort.Strings(others)
+	return append(columns, others...)
+}
+
+func (m Model) hasField(field Field) bool {
+	for _, f := range m.modelFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertAll inserts rows (each row is one Changes) in a transaction and
+// returns ids of the inserted rows. Rows are inserted by BatchInsert() in
+// chunks so that the number of placeholder parameters of each statement
+// doesn't exceed the limit of PostgreSQL. All rows must have the same
+// columns, ErrMissingColumn with the name of the column is returned if a row
+// doesn't have a column of other rows. If any statement fails (or panics),
+// the transaction is rolled back and nothing is inserted.
+//  ids, err := m.InsertAll([]db.Changes{
+//  	m.Changes(db.RawChanges{"Name": "foo"}),
+//  	m.Changes(db.RawChanges{"Name": "bar"}),
+//  })
+func (m Model) InsertAll(rows []Changes) (ids []int, err error) {
+	if m.connection == nil {
+		err = ErrNoConnection
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	columns, err := m.insertColumns(rows)
+	if err != nil {
+		return
+	}
+	count := len(columns)
+	if m.scopeColumn != "" && !stringsContain(columns, m.scopeColumn) {
+		count += 1
+	}
+	size := maxParameters
+	if count > 0 {
+		size = maxParameters / count
+	}
+	statements := []SQLWithValues{}
+	for i := 0; i < len(rows); i += size {
+		chunk := [][]Changes{}
+		for _, row := range rows[i:min(i+size, len(rows))] {
+			chunk = append(chunk, []Changes{row})
+		}
+		statements = append(statements, m.BatchInsert(chunk...)("RETURNING id"))
+	}
+	err = statements[0].transaction(&TxOptions{}, func(ctx context.Context, tx Tx) error {
+		for _, statement := range statements {
+			rows, err := statement.QueryTx(tx, ctx)
+			if err != nil {
+				return err
+			}
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err != nil {
+					rows.Close()
+					return statement.wrapError(err)
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return statement.wrapError(err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ids = nil
+	}
+	return
+}
+
+// insertColumns returns sorted names of columns of the rows to be inserted,
+// ErrMissingColumn is returned if rows don't have the same columns.
+func (m Model) insertColumns(rows []Changes) ([]string, error) {
+	sets := make([]map[string]bool, 0, len(rows))
+	all := map[string]bool{}
+	for _, changes := range rows {
+		set := map[string]bool{}
+		for field := range changes {
+			column := field.ColumnName
+			if field.Jsonb != "" {
+				column = field.Jsonb
+			} else if field.generatedAlways() {
+				continue
+			}
+			set[column] = true
+			all[column] = true
+		}
+		sets = append(sets, set)
+	}
+	columns := make([]string, 0, len(all))
+	for column := range all {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, set := range sets {
+		for _, column := range columns {
+			if !set[column] {
+				return nil, fmt.Errorf("%w: %s", ErrMissingColumn, column)
+			}
+		}
+	}
+	return columns, nil
+}
+
+// Snapshot calls fn in a REPEATABLE READ and READ ONLY transaction, so all
+// statements executed with the transaction see the same snapshot of the
+// database (taken when the first statement runs), no matter what other
+// transactions commit in the meantime. Useful for reports consisting of
+// many queries. The transaction is always rolled back since nothing can be
+// changed in it.
+//  err := m.Snapshot(func(ctx context.Context, tx db.Tx) error {
+//  	if err := m.Select("COUNT(*)").QueryRowTx(tx, ctx, &count); err != nil {
+//  		return err
+//  	}
+//  	return m.Select("SUM(amount)").QueryRowTx(tx, ctx, &sum)
+//  })
+func (m Model) Snapshot(fn func(context.Context, Tx) error) error {
+	if m.connection == nil {
+		return ErrNoConnection
+	}
+	sql := m.NewSQLWithValues("SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY")
+	ctx := context.Background()
+	sql.log("BEGIN", nil)
+	tx, err := m.connection.BeginTx(ctx, LevelRepeatableRead)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		sql.log("ROLLBACK", nil)
+		tx.Rollback(ctx)
+	}()
+	if err := sql.ExecTx(tx, ctx); err != nil {
+		return err
+	}
+	return fn(ctx, tx)
+}
+
+// jsonbObject returns JSON object of the changes of one jsonb column, keys
+// are in the same order as the fields in the struct, keys of fields not in
+// the struct (for example, changes of NewModelTable()) follow in sorted
+// order.
+func (m Model) jsonbObject(changes Changes) (string, error) {
+	fields := make([]Field, 0, len(changes))
+	for _, field := range m.modelFields {
+		if _, ok := changes[field]; ok {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) < len(changes) {
+		others := []Field{}
+		for field := range changes {
+			if !m.hasField(field) {
+				others = append(others, field)
+			}
+		}
+		sort.Slice(others, func(i, j int) bool {
+			return others[i].ColumnName < others[j].ColumnName
+		})
+		fields = append(fields, others...)
+	}
+	var b strings.Builder
+	b.WriteString("{")
+	written := map[string]bool{}
+	for _, field := range fields {
+		value := changes[field]
+		if value == Null || written[field.ColumnName] {
+			continue
+		}
+		written[field.ColumnName] = true
+		v, err := JSONMarshal(uncast(value))
+		if err != nil {
+			return "", err
+		}
+		if b.Len() > 1 {
+			b.WriteString(",")
+		}
+		k, _ := json.Marshal(field.ColumnName)
+		b.Write(k)
+		b.WriteString(":")
+		b.Write(v)
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// BatchInsert is like Insert but inserts multiple rows in one statement, each
+// row is a list of changes. Columns not in some rows use DEFAULT values.
+// With RETURNING, PostgreSQL returns the inserted rows in the same order as
+// the rows, so you can get ids of all rows in one round trip and match them
+// with the rows, for example, to insert rows of other tables referencing
+// them. Use InsertAll() if there are too many rows for one statement.
+//  var ids []int
+//  m.BatchInsert(
+//  	[]db.Changes{m.Changes(db.RawChanges{"Name": "foo"})},
+//  	[]db.Changes{m.Changes(db.RawChanges{"Name": "bar"})},
+//  )("RETURNING id").MustQuery(&ids)
+func (m Model) BatchInsert(rows ...[]Changes) func(...string) SQLWithValues {
+	return func(args ...string) SQLWithValues {
+		var suffix string
+		if len(args) > 0 {
+			suffix = args[0]
+		}
+		fields, numbers, values, err := m.batchInsertValues(1, rows)
+		sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES " + joinRows(numbers) + " " + suffix
+		return m.NewSQLWithValues(sql, values...).withError(err)
+	}
+}
+
+// Upsert is like Insert but builds an INSERT INTO ... ON CONFLICT ... DO
+// UPDATE statement, columns in the changes (except the conflict columns) are
+// updated with the EXCLUDED values. Jsonb columns are merged with existing
+// values, so keys not in the changes are kept. Conflict columns can be struct
+// field names or column names. The function returned takes optional
+// conditions (like WHERE and/or RETURNING) as the first argument, which are
+// added after the DO UPDATE SET clause, the rest arguments are for any
+// placeholder parameters in the conditions, they are numbered before the
+// values of the changes, just like Update(). If there is nothing to update
+// (all columns are conflict columns), DO NOTHING is used instead, RETURNING
+// is kept but a WHERE clause returns ErrWhereWithoutUpdate when the statement
+// is executed.
+//  // last write wins
+//  m.Upsert([]string{"Id"}, changes...)(
+//  	"WHERE orders.updated_at < EXCLUDED.updated_at",
+//  ).MustExecute(&rowsAffected)
+func (m Model) Upsert(conflictColumns []string, lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.upsert(conflictColumns, "", lotsOfChanges)
+}
+
+// UpsertPartial is like Upsert but the conflict target is a partial unique
+// index with the index predicate, for example:
+//  // INSERT INTO users (...) VALUES (...)
+//  // ON CONFLICT (email) WHERE deleted_at IS NULL DO UPDATE SET ...
+//  m.UpsertPartial([]string{"Email"}, "deleted_at IS NULL", changes...)().MustExecute()
+func (m Model) UpsertPartial(conflictColumns []string, indexPredicate string, lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.upsert(conflictColumns, indexPredicate, lotsOfChanges)
+}
+
+// BatchUpsert is like Upsert but inserts or updates multiple rows in one
+// statement, each row is a list of changes. Rows must not have the same
+// values of the conflict columns. Use xmax to know whether a row is inserted
+// or updated:
+//  var results []struct {
+//  	Id       int
+//  	Inserted bool
+//  }
+//  m.BatchUpsert([]string{"Id"}, rows...)(
+//  	"RETURNING id, (xmax = 0) AS inserted",
+//  ).MustQuery(&results)
+func (m Model) BatchUpsert(conflictColumns []string, rows ...[]Changes) func(...interface{}) SQLWithValues {
+	return m.upsert(conflictColumns, "", rows...)
+}
+
+// InsertIfNotExists inserts a row with the changes unless it conflicts with
+// existing rows on the conflict columns (struct field names or column
+// names), returns whether the row is inserted and its id. With "ON CONFLICT
+// DO NOTHING RETURNING id", no row is returned if there is a conflict, so
+// QueryRow() fails with the error of no rows, this function returns
+// inserted = false, id = 0 and no error instead. Use Upsert() if you want id
+// of the existing row.
+//  inserted, id, err := m.InsertIfNotExists([]string{"Email"}, changes)
+//  // INSERT INTO users (email) VALUES ($1) ON CONFLICT (email) DO NOTHING RETURNING id
+func (m Model) InsertIfNotExists(conflictColumns []string, lotsOfChanges ...Changes) (inserted bool, id int, err error) {
+	fields, numbers, values, err := m.insertValues(1, lotsOfChanges)
+	sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(numbers, ", ") + ") " +
+		"ON CONFLICT (" + strings.Join(m.conflictColumns(conflictColumns), ", ") + ") DO NOTHING RETURNING id"
+	inserted, err = m.NewSQLWithValues(sql, values...).withError(err).QueryRowOrNil(&id)
+	return
+}
+
+// InsertDoNothing is like Insert but builds an INSERT INTO ... ON CONFLICT
+// ... DO NOTHING statement, rows conflicting with existing rows on the
+// conflict columns (struct field names or column names) are skipped. If
+// there are no conflict columns, conflicts on any unique constraint are
+// skipped. Unlike InsertIfNotExists(), the statement is not executed.
+//  // INSERT INTO users (email) VALUES ($1) ON CONFLICT (email) DO NOTHING
+//  m.InsertDoNothing([]string{"Email"}, changes)().MustExecute(&rowsAffected)
+func (m Model) InsertDoNothing(conflictColumns []string, lotsOfChanges ...Changes) func(...string) SQLWithValues {
+	return func(args ...string) SQLWithValues {
+		var suffix string
+		if len(args) > 0 {
+			suffix = args[0]
+		}
+		target := ""
+		if len(conflictColumns) > 0 {
+			target = "(" + strings.Join(m.conflictColumns(conflictColumns), ", ") + ") "
+		}
+		fields, numbers, values, err := m.insertValues(1, lotsOfChanges)
+		sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES (" + strings.Join(numbers, ", ") + ") " +
+			"ON CONFLICT " + target + "DO NOTHING " + suffix
+		return m.NewSQLWithValues(sql, values...).withError(err)
+	}
+}
+
+// InsertOnConstraint is like Upsert but the conflict target is the name of
+// a unique or exclusion constraint, which is useful if the unique index has
+// complex expressions. All columns in the changes are updated.
+//  // INSERT INTO orders (...) VALUES (...)
+//  // ON CONFLICT ON CONSTRAINT orders_trade_number_key DO UPDATE SET ...
+//  m.InsertOnConstraint("orders_trade_number_key", changes...)().MustExecute()
+func (m Model) InsertOnConstraint(constraintName string, lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.upsertOn(nil, "ON CONSTRAINT "+constraintName, []Changes(lotsOfChanges))
+}
+
+func (m Model) upsert(conflictColumns []string, indexPredicate string, rows ...[]Changes) func(...interface{}) SQLWithValues {
+	conflicts := m.conflictColumns(conflictColumns)
+	target := "(" + strings.Join(conflicts, ", ") + ")"
+	if indexPredicate != "" {
+		target += " WHERE " + indexPredicate
+	}
+	return m.upsertOn(conflicts, target, rows...)
+}
+
+// upsertOn builds the upsert statement with the conflict target, conflict
+// columns are not updated.
+func (m Model) upsertOn(conflicts []string, target string, rows ...[]Changes) func(...interface{}) SQLWithValues {
+	return func(args ...interface{}) SQLWithValues {
+		suffix, args := splitConditions(args)
+		fields, numbers, values, err := m.batchInsertValues(len(args)+1, rows)
+		updates := []string{}
+		columns, exprs := m.upsertUpdates(fields, conflicts, nil)
+		for i := range columns {
+			updates = append(updates, columns[i]+" = "+exprs[i])
+		}
+		action := "DO NOTHING"
+		values = append(args, values...)
+		if len(updates) > 0 {
+			action = "DO UPDATE SET " + strings.Join(updates, ", ")
+			// rows of other scopes are not updated
+			suffix, values = m.scope(suffix, values)
+		} else if err == nil {
+			for _, i := range topLevelWords(suffix) {
+				if hasKeywordAt(suffix, i, "WHERE") {
+					err = ErrWhereWithoutUpdate
+					break
+				}
+			}
+		}
+		sql := "INSERT INTO " + m.tableName + " (" + strings.Join(fields, ", ") + ") VALUES " + joinRows(numbers) + " " +
+			"ON CONFLICT " + target + " " + action + " " + suffix
+		return m.NewSQLWithValues(sql, values...).withError(err)
+	}
+}
+
+// conflictColumns converts struct field names to column names.
+func (m Model) conflictColumns(columns []string) (conflicts []string) {
+	conflicts = []string{}
+	for _, column := range columns {
+		if c := m.columnName(column); c != "" {
+			column = c
+		}
+		conflicts = append(conflicts, column)
+	}
+	return
+}
+
+// upsertUpdates returns columns to update and their new values of the upsert
+// statement. Conflict columns and columns of fields with "readonly" tag are
+// not updated. If updateColumns is not nil, only these columns are updated.
+func (m Model) upsertUpdates(fields, conflicts, updateColumns []string) (columns, exprs []string) {
+	for _, field := range fields {
+		if stringsContain(conflicts, field) {
+			continue
+		}
+		if updateColumns != nil && !stringsContain(updateColumns, field) {
+			continue
+		}
+		if m.isReadOnly(field) {
+			continue
+		}
+		columns = append(columns, field)
+		if stringsContain(m.jsonbColumns, field) {
+			exprs = append(exprs, fmt.Sprintf("COALESCE(%s.%s, '{}'::jsonb) || EXCLUDED.%s",
+				m.tableRef(), field, field))
+			continue
+		}
+		exprs = append(exprs, "EXCLUDED."+field)
+	}
+	return
+}
+
+// Sync inserts or updates rows (each row is one Changes) just like
+// BatchUpsert(), but rows are not updated if the values of the update
+// columns are not changed. Returns status (SyncInserted, SyncUpdated or
+// SyncUnchanged) of each row in the same order of the rows. Conflict
+// columns and update columns can be struct field names or column names,
+// if updateColumns is nil, all columns in the changes except the conflict
+// columns are updated. Values of the conflict columns must be in all rows.
+// To match the rows, returned values are scanned into the types of the
+// values of the first row, then both are converted like driver arguments
+// (pointers are dereferenced and times are in UTC) and compared.
+//  statuses, err := m.Sync(rows, []string{"Id"}, []string{"Name", "Status"})
+func (m Model) Sync(rows []Changes, conflictColumns, updateColumns []string) (statuses []string, err error) {
+	if m.connection == nil {
+		err = ErrNoConnection
+		return
+	}
+	if len(rows) == 0 {
+		return
+	}
+	conflicts := []string{}
+	for _, column := range conflictColumns {
+		if c := m.columnName(column); c != "" {
+			column = c
+		}
+		conflicts = append(conflicts, column)
+	}
+	var updates []string
+	if updateColumns != nil {
+		updates = []string{}
+		for _, column := range updateColumns {
+			if c := m.columnName(column); c != "" {
+				column = c
+			}
+			updates = append(updates, column)
+		}
+	}
+	batch := [][]Changes{}
+	keys := []string{}
+	keyTypes := make([]reflect.Type, len(conflicts))
+	for _, row := range rows {
+		batch = append(batch, []Changes{row})
+		key := []string{}
+		for i, column := range conflicts {
+			for field, value := range row {
+				if field.Jsonb == "" && field.ColumnName == column {
+					key = append(key, syncKey(value))
+					if keyTypes[i] == nil && value != nil {
+						keyTypes[i] = reflect.TypeOf(value)
+					}
+				}
+			}
+		}
+		keys = append(keys, strings.Join(key, "\x00"))
+	}
+	fields, numbers, values, err := m.batchInsertValues(1, batch)
+	if err != nil {
+		return
+	}
+	columns, exprs := m.upsertUpdates(fields, conflicts, updates)
+	returning := []string{}
+	for _, column := range conflicts {
+		returning = append(returning, m.tableRef()+"."+column)
+	}
+	returning = append(returning, "(xmax = 0)")
+	action := "DO NOTHING"
+	if len(columns) > 0 {
+		sets := []string{}
+		olds := []string{}
+		for i := range columns {
+			sets = append(sets, columns[i]+" = "+exprs[i])
+			olds = append(olds, m.tableRef()+"."+columns[i])
+		}
+		action = "DO UPDATE SET " + strings.Join(sets, ", ") +
+			" WHERE (" + strings.Join(olds, ", ") + ") IS DISTINCT FROM (" + strings.Join(exprs, ", ") + ")"
+		if m.scopeColumn != "" {
+			values = append(values, m.scopeValue)
+			action += fmt.Sprintf(" AND %s.%s = $%d", m.tableRef(), m.scopeColumn, len(values))
+		}
+	}
+	sql := m.NewSQLWithValues("INSERT INTO "+m.tableName+" ("+strings.Join(fields, ", ")+") VALUES "+joinRows(numbers)+" "+
+		"ON CONFLICT ("+strings.Join(conflicts, ", ")+") "+action+" RETURNING "+strings.Join(returning, ", "), values...)
+	sql.log(sql.sql, sql.values)
+	start := time.Now()
+	results, err := m.connection.Query(sql.sql, sql.values...)
+	sql.observe(start, &err)
+	if err != nil {
+		err = sql.wrapError(err)
+		return
+	}
+	defer results.Close()
+	changed := map[string]string{}
+	for results.Next() {
+		var inserted bool
+		dests := []interface{}{}
+		for _, rt := range keyTypes {
+			if rt == nil {
+				rt = reflect.TypeOf("")
+			}
+			dests = append(dests, reflect.New(rt).Interface())
+		}
+		dests = append(dests, &inserted)
+		if err = results.Scan(dests...); err != nil {
+			err = sql.wrapError(err)
+			return
+		}
+		key := make([]string, len(conflicts))
+		for i := range key {
+			key[i] = syncKey(reflect.ValueOf(dests[i]).Elem().Interface())
+		}
+		status := SyncUpdated
+		if inserted {
+			status = SyncInserted
+		}
+		changed[strings.Join(key, "\x00")] = status
+	}
+	if err = results.Err(); err != nil {
+		err = sql.wrapError(err)
+		return
+	}
+	for _, key := range keys {
+		status, ok := changed[key]
+		if !ok {
+			status = SyncUnchanged
+		}
+		statuses = append(statuses, status)
+	}
+	return
+}
+
+// syncKey returns text of the value of the conflict column to match the
+// rows in Sync().
+func syncKey(value interface{}) string {
+	v, err := driver.DefaultParameterConverter.ConvertValue(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	return fmt.Sprintf("%T %v", v, v)
 }
 
 // Update builds an UPDATE statement with fields and values in the changes,
 // returns a function with optional conditions (like WHERE) to the statement as
 // the first argument. The rest arguments are for any placeholder parameters in
-// the statement.
+// the statement. Fields in jsonb columns are updated with jsonb_set() on
+// the current value of each row (an empty object if it is NULL), other keys
+// are kept, so you can change a key of many rows at once. Columns (and keys
+// of jsonb columns) are in the order of the fields of the struct, so the
+// statement is always the same for the same fields. Fields with
+// "readonly" tag (like `readonly:""` for CreatedAt) are left out even if they
+// are in the changes, they can only be set by Insert(). ErrNothingToUpdate
+// is returned when the statement is executed if no columns are left.
 //  var rowsAffected int
 //  m.Update(changes...)("WHERE user_id = $1", 1).MustExecute(&rowsAffected)
+//
+//  // UPDATE users SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{notifications}', $2) WHERE status = $1
+//  m.Update(m.Changes(db.RawChanges{"Notifications": false}))("WHERE status = $1", "active").MustExecute(&rowsAffected)
 func (m Model) Update(lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.update("", lotsOfChanges, false)
+}
+
+// UpdateIfChanged is like Update but rows are updated only if any of the
+// columns in the changes has a different value (IS DISTINCT FROM, so NULL
+// and NULL are not different), so no-op updates don't fire triggers and
+// affect zero rows. Columns with Raw values (like NOW()) are not compared.
+//  // UPDATE orders SET status = $2 WHERE (orders.status IS DISTINCT FROM $2) AND (id = $1)
+//  m.UpdateIfChanged(m.Changes(db.RawChanges{"Status": "paid"}))("WHERE id = $1", 1).MustExecute(&rowsAffected)
+func (m Model) UpdateIfChanged(lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.update("", lotsOfChanges, true)
+}
+
+// UpdateFrom is like Update but updates rows based on other tables in the
+// FROM clause, you can join the tables in the conditions. Placeholder
+// parameters in the FROM clause and the conditions are numbered before the
+// values of the changes.
+//  var rowsAffected int
+//  m.UpdateFrom("users", changes...)(
+//  	"WHERE orders.user_id = users.id AND users.inactive = $1", true,
+//  ).MustExecute(&rowsAffected)
+func (m Model) UpdateFrom(from string, lotsOfChanges ...Changes) func(...interface{}) SQLWithValues {
+	return m.update(from, lotsOfChanges, false)
+}
+
+func (m Model) update(from string, lotsOfChanges []Changes, ifChanged bool) func(...interface{}) SQLWithValues {
 	return func(args ...interface{}) SQLWithValues {
-		var where string
-		if len(args) > 0 {
-			if w, ok := args[0].(string); ok {
-				where = w
-				args = args[1:]
-			}
-		}
+		where, args := m.scope(splitConditions(args))
 		fields := []string{}
-		fieldsIndex := map[string]int{}
+		guards := []string{}
+		changedFields := []Field{}
+		changedValues := map[string]interface{}{}
 		values := []interface{}{}
 		values = append(values, args...)
 		jsonbFields := map[string]Changes{}
 		i := len(args) + 1
+		lotsOfChanges, err := m.runHooks(beforeUpdateHooks, lotsOfChanges)
+		if err == nil {
+			lotsOfChanges, err = m.scopeChanges(lotsOfChanges, false)
+		}
 		for _, changes := range lotsOfChanges {
-			for field, value := range changes {
+			for _, field := range m.sortedFields(changes) {
+				value := m.inTimeZone(changes[field])
+				if field.ReadOnly {
+					continue
+				}
 				if field.Jsonb != "" {
 					if _, ok := jsonbFields[field.Jsonb]; !ok {
 						jsonbFields[field.Jsonb] = Changes{}
@@ -628,28 +2004,60 @@ func (m Model) Update(lotsOfChanges ...Changes) func(...interface{}) SQLWithValu
 					jsonbFields[field.Jsonb][field] = value
 					continue
 				}
-				if idx, ok := fieldsIndex[field.Name]; ok { // prevent duplication
-					values[idx] = value
+				if field.generatedAlways() {
 					continue
 				}
-				fields = append(fields, fmt.Sprintf("%s = $%d", field.ColumnName, i))
-				fieldsIndex[field.Name] = i - 1
-				values = append(values, value)
-				i += 1
+				if _, ok := changedValues[field.Name]; !ok { // prevent duplication
+					changedFields = append(changedFields, field)
+				}
+				changedValues[field.Name] = field.convertValue(value)
+			}
+		}
+		for _, field := range changedFields {
+			value := changedValues[field.Name]
+			if raw, ok := value.(Raw); ok {
+				fields = append(fields, field.ColumnName+" = "+string(raw))
+				continue
 			}
+			dataType := ""
+			if c, ok := value.(cast); ok {
+				dataType = "::" + c.dataType
+				value = c.value
+			}
+			fields = append(fields, fmt.Sprintf("%s = $%d", field.ColumnName, i)+dataType)
+			guards = append(guards, fmt.Sprintf("%s.%s IS DISTINCT FROM $%d", m.tableRef(), field.ColumnName, i)+dataType)
+			values = append(values, value)
+			i += 1
 		}
-		for jsonbField, changes := range jsonbFields {
+		for _, jsonbField := range m.sortedJsonbColumns(jsonbFields) {
+			changes := jsonbFields[jsonbField]
 			var field = fmt.Sprintf("COALESCE(%s, '{}'::jsonb)", jsonbField)
-			for f, value := range changes {
+			for _, f := range m.sortedFields(changes) {
+				value := changes[f]
+				if value == Null {
+					field = fmt.Sprintf("%s - '%s'", field, f.ColumnName)
+					continue
+				}
 				field = fmt.Sprintf("jsonb_set(%s, '{%s}', $%d)", field, f.ColumnName, i)
-				j, _ := json.Marshal(value)
+				j, _ := JSONMarshal(uncast(value))
 				values = append(values, string(j))
 				i += 1
 			}
 			fields = append(fields, jsonbField+" = "+field)
+			guards = append(guards, m.tableRef()+"."+jsonbField+" IS DISTINCT FROM "+field)
 		}
-		sql := "UPDATE " + m.tableName + " SET " + strings.Join(fields, ", ") + " " + where
-		return m.NewSQLWithValues(sql, values...)
+		if err == nil && len(fields) == 0 {
+			err = ErrNothingToUpdate
+		}
+		if ifChanged && len(guards) > 0 {
+			where = addCondition(where, "("+strings.Join(guards, " OR ")+")")
+		}
+		fromClause := ""
+		if from != "" {
+			fromClause = "FROM " + from + " "
+		}
+		sql := "UPDATE " + m.fromTable() + " SET " + strings.Join(fields, ", ") + " " + fromClause + where
+		return m.NewSQLWithValues(sql, values...).withError(err)
 	}
 }
 
@@ -659,14 +2067,20 @@ func (m Model) Update(lotsOfChanges ...Changes) func(...interface{}) SQLWithValu
 //  var ids []int
 //  db.NewModelTable("reports", conn).Delete("RETURNING id").MustQuery(&ids)
 func (m Model) Delete(values ...interface{}) SQLWithValues {
-	var where string
-	if len(values) > 0 {
-		if w, ok := values[0].(string); ok {
-			where = w
-			values = values[1:]
-		}
-	}
-	sql := "DELETE FROM " + m.tableName + " " + where
+	where, values := m.scope(splitConditions(values))
+	sql := "DELETE FROM " + m.fromTable() + " " + where
+	return m.NewSQLWithValues(sql, values...)
+}
+
+// DeleteUsing is like Delete but deletes rows based on other tables in the
+// USING clause, you can join the tables in the conditions.
+//  var rowsAffected int
+//  db.NewModelTable("orders", conn).DeleteUsing(
+//  	"users", "WHERE orders.user_id = users.id AND users.banned = $1", true,
+//  ).MustExecute(&rowsAffected)
+func (m Model) DeleteUsing(using string, values ...interface{}) SQLWithValues {
+	where, values := m.scope(splitConditions(values))
+	sql := "DELETE FROM " + m.fromTable() + " USING " + using + " " + where
 	return m.NewSQLWithValues(sql, values...)
 }
 
@@ -684,6 +2098,29 @@ func (m Model) UpdatedAt() Changes {
 	})
 }
 
+// JsonbWhole returns changes to replace the whole jsonb column with value
+// (marshaled to JSON) in Insert() and Update(), instead of merging keys into
+// the column by jsonb_set(). Don't use it with other changes of fields in
+// the same jsonb column. Empty changes are returned if the column is not a
+// jsonb column.
+//  m.Update(m.JsonbWhole("meta", map[string]interface{}{
+//  	"picture": "https://hello/world",
+//  }))("WHERE id = $1", 1).MustExecute()
+func (m Model) JsonbWhole(column string, value interface{}) Changes {
+	out := Changes{}
+	if !stringsContain(m.jsonbColumns, column) {
+		return out
+	}
+	j, _ := JSONMarshal(value)
+	out[Field{
+		Name:       column,
+		ColumnName: column,
+		JsonName:   column,
+		DataType:   "jsonb",
+	}] = string(j)
+	return out
+}
+
 // parseStruct collects column names, json names and jsonb names
 func (m *Model) parseStruct(obj interface{}) (fields []Field, jsonbColumns []string) {
 	var rt reflect.Type
@@ -718,7 +2155,12 @@ func (m *Model) parseStruct(obj interface{}) (fields []Field, jsonbColumns []str
 			if f.PkgPath != "" {
 				continue // ignore unexported field if no column specified
 			}
-			columnName = ToColumnName(f.Name)
+			if m.columnMapper != nil {
+				columnName = m.columnMapper(f.Name)
+			}
+			if columnName == "" {
+				columnName = ToColumnName(f.Name)
+			}
 		}
 
 		jsonName := f.Tag.Get("json")
@@ -749,9 +2191,24 @@ func (m *Model) parseStruct(obj interface{}) (fields []Field, jsonbColumns []str
 			if !exists {
 				jsonbColumns = append(jsonbColumns, jsonb)
 			}
+			if jsonbKey := f.Tag.Get("jsonbKey"); jsonbKey != "" {
+				columnName = jsonbKey
+			}
 		}
 
 		dataType := f.Tag.Get("dataType")
+		timeLayout := f.Tag.Get("timeLayout")
+		composite, isComposite := f.Tag.Lookup("composite")
+		_, isAggregate := f.Tag.Lookup("aggregate")
+		_, isReadOnly := f.Tag.Lookup("readonly")
+		_, isBoolAsInt := f.Tag.Lookup("boolAsInt")
+		enumAs := f.Tag.Get("enumAs")
+		if dataType == "" && composite != "" {
+			dataType = composite
+		}
+		if !isAggregate && !isComposite && jsonb == "" && dataType == "" && enumAs == "" && timeLayout == "" && isComplexType(f.Type) {
+			isAggregate = true
+		}
 		if dataType == "" {
 			tp := f.Type.String()
 			var null bool
@@ -759,10 +2216,29 @@ func (m *Model) parseStruct(obj interface{}) (fields []Field, jsonbColumns []str
 				tp = strings.TrimPrefix(tp, "*")
 				null = true
 			}
+			if timeLayout != "" {
+				tp = "string"
+			}
 			if columnName == "id" && strings.Contains(tp, "int") {
-				dataType = "SERIAL PRIMARY KEY"
+				if UseIdentityColumns {
+					dataType = "bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY"
+				} else {
+					dataType = "SERIAL PRIMARY KEY"
+				}
+			} else if isAggregate && jsonb == "" {
+				dataType = "jsonb"
 			} else if jsonb == "" {
+				if enumAs == "int" {
+					tp = "int32"
+				} else if enumAs == "text" {
+					tp = "string"
+				}
+				if isBoolAsInt && tp == "bool" {
+					tp = "smallint"
+				}
 				switch tp {
+				case "smallint":
+					dataType = "smallint DEFAULT 0"
 				case "int8", "int16", "int32", "uint8", "uint16", "uint32":
 					dataType = "integer DEFAULT 0"
 				case "int64", "uint64", "int", "uint":
@@ -791,17 +2267,102 @@ func (m *Model) parseStruct(obj interface{}) (fields []Field, jsonbColumns []str
 			JsonName:   jsonName,
 			Jsonb:      jsonb,
 			DataType:   dataType,
+			Composite:  isComposite && jsonb == "",
+			Aggregate:  isAggregate && jsonb == "",
+			EnumAs:     enumAs,
+			TimeLayout: timeLayout,
+			BoolAsInt:  isBoolAsInt && jsonb == "",
+			References: f.Tag.Get("references"),
+			Unique:     f.Tag.Get("unique"),
+			ReadOnly:   isReadOnly,
 		})
 	}
 	return
 }
 
+// convertValue converts value of composite type, hstore, time with layout,
+// bool as int, aggregate or enum to its text representation, other values
+// are returned as they are.
+func (f Field) convertValue(value interface{}) interface{} {
+	if c, ok := value.(cast); ok {
+		c.value = f.convertValue(c.value)
+		return c
+	}
+	if f.Composite {
+		return compositeValue(value)
+	}
+	if f.Aggregate {
+		return aggregateValue(value)
+	}
+	if f.EnumAs == "text" && f.Jsonb == "" {
+		return enumTextValue(value)
+	}
+	if f.EnumAs == "int" && f.Jsonb == "" {
+		return enumIntValue(value)
+	}
+	if f.isHstore() {
+		return hstoreValue(value)
+	}
+	if f.TimeLayout != "" && f.Jsonb == "" {
+		return timeLayoutValue(value, f.TimeLayout)
+	}
+	if f.BoolAsInt {
+		return boolIntValue(value)
+	}
+	return value
+}
+
+// scanner returns scanner of composite type, hstore, time with layout,
+// bool as int, aggregate or enum for the pointer of the struct field, other
+// pointers are returned as they are.
+func (f Field) scanner(pointer interface{}) interface{} {
+	if f.Composite {
+		return &compositeScanner{reflect.ValueOf(pointer).Elem()}
+	}
+	if f.Aggregate {
+		return &aggregateScanner{reflect.ValueOf(pointer).Elem()}
+	}
+	if f.EnumAs == "text" && f.Jsonb == "" {
+		return &enumTextScanner{reflect.ValueOf(pointer).Elem()}
+	}
+	if f.isHstore() {
+		return &hstoreScanner{reflect.ValueOf(pointer).Elem()}
+	}
+	if f.TimeLayout != "" && f.Jsonb == "" {
+		return &timeLayoutScanner{reflect.ValueOf(pointer).Elem(), f.TimeLayout}
+	}
+	if f.BoolAsInt {
+		return &boolIntScanner{reflect.ValueOf(pointer).Elem()}
+	}
+	return pointer
+}
+
+// isReadOnly returns true if the column is of a field with "readonly" tag.
+func (m Model) isReadOnly(column string) bool {
+	for _, f := range m.modelFields {
+		if f.Jsonb == "" && f.ColumnName == column {
+			return f.ReadOnly
+		}
+	}
+	return false
+}
+
+// generatedAlways returns true if the column is an identity column or a
+// generated column which can't be written.
+func (f Field) generatedAlways() bool {
+	return strings.Contains(strings.ToUpper(f.DataType), "GENERATED ALWAYS")
+}
+
+func (f Field) isHstore() bool {
+	return f.Jsonb == "" && strings.HasPrefix(f.DataType, "hstore")
+}
+
 func (c Changes) MarshalJSON() ([]byte, error) {
 	data := map[string]interface{}{}
 	for field, value := range c {
 		data[field.JsonName] = value
 	}
-	return json.Marshal(data)
+	return JSONMarshal(data)
 }
 
 func (c Changes) String() string {
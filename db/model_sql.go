@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/caiguanhao/furk/logger"
@@ -17,10 +20,23 @@ const (
 	actionExecute
 )
 
+const (
+	// Modifiers of OrderBy().
+	Asc        = "ASC"
+	Desc       = "DESC"
+	NullsFirst = "NULLS FIRST"
+	NullsLast  = "NULLS LAST"
+
+	// Sampling methods of TableSample().
+	Bernoulli = "BERNOULLI"
+	System    = "SYSTEM"
+)
+
 var (
 	ErrInvalidTarget       = errors.New("target must be pointer of a struct or pointer of a slice of structs")
 	ErrNoConnection        = errors.New("no connection")
 	ErrTypeAssertionFailed = errors.New("type assertion failed")
+	ErrInvalidTableSample  = errors.New("invalid table sample")
 )
 
 type (
@@ -28,13 +44,31 @@ type (
 	TxOptions struct {
 		IsolationLevel string
 		Before, After  func(context.Context, Tx) error
+
+		// If greater than zero, "SET LOCAL statement_timeout" is executed
+		// after BEGIN, so every statement in the transaction (including
+		// the ones in Before and After) is aborted if it takes longer than
+		// the timeout, the connection's own timeout is not affected.
+		StatementTimeout time.Duration
 	}
 
 	// SQLWithValues can be created with Model.NewSQLWithValues(sql, values...)
 	SQLWithValues struct {
 		model  *Model
+		logger logger.Logger
 		sql    string
 		values []interface{}
+
+		main       string        // statement without clauses like ORDER BY
+		mainValues []interface{} // values of the main statement
+		orderBy    []string
+		limit      interface{} // nil if there's no LIMIT clause
+		offset     interface{} // nil if there's no OFFSET clause
+		returning  string
+		fetchSize  int    // number of rows fetched at a time by Cursor()
+		tableEnd   int    // index after the table name in main, 0 if unknown
+		label      string // label for hooks registered by OnQuery()
+		err        error  // returned when the statement is executed
 	}
 
 	jsonbRaw map[string]json.RawMessage
@@ -44,31 +78,214 @@ func (j *jsonbRaw) Scan(src interface{}) error { // necessary for github.com/lib
 	if src == nil {
 		return nil
 	}
-	source, ok := src.([]byte)
-	if !ok {
-		return ErrTypeAssertionFailed
+	switch source := src.(type) {
+	case []byte:
+		return JSONUnmarshal(source, j)
+	case string:
+		return JSONUnmarshal([]byte(source), j)
 	}
-	return json.Unmarshal(source, j)
+	return ErrTypeAssertionFailed
 }
 
 // Create new SQLWithValues with SQL statement as first argument, The rest
 // arguments are for any placeholder parameters in the statement.
 func (m Model) NewSQLWithValues(sql string, values ...interface{}) SQLWithValues {
-	sql = strings.TrimSpace(sql)
-	if c, ok := m.connection.(ConvertParameters); ok {
+	s := SQLWithValues{
+		model:      &m,
+		logger:     m.logger,
+		main:       strings.TrimSpace(sql),
+		mainValues: values,
+	}
+	s.build()
+	return s
+}
+
+// build generates the final SQL statement and values from the main statement
+// and the clauses added later.
+func (s *SQLWithValues) build() {
+	sql := s.rawSQL()
+	rawValues := s.rawValues()
+	values := make([]interface{}, len(rawValues))
+	for i, value := range rawValues {
+		if a, ok := value.(array); ok {
+			if c, ok := s.model.connection.(ConvertArray); ok {
+				value = c.ConvertArray(a.value)
+			} else {
+				value = a.value
+			}
+		}
+		values[i] = value
+	}
+	if c, ok := s.model.connection.(ConvertParameters); ok {
 		sql, values = c.ConvertParameters(sql, values)
 	}
-	return SQLWithValues{
-		model:  &m,
-		sql:    sql,
-		values: values,
+	s.sql, s.values = sql, values
+}
+
+// rawSQL returns the SQL statement with all clauses before parameters are
+// converted by the connection.
+func (s SQLWithValues) rawSQL() string {
+	sql := s.main
+	if len(s.orderBy) > 0 {
+		// ORDER BY must come before LIMIT, OFFSET, FETCH and FOR UPDATE
+		end := len(sql)
+		for _, i := range topLevelWords(sql) {
+			if isClauseAfterOrderBy(sql, i) {
+				end = i
+				break
+			}
+		}
+		sql = strings.TrimSpace(strings.TrimSpace(sql[:end]) + " ORDER BY " + strings.Join(s.orderBy, ", ") + " " + sql[end:])
+	}
+	n := len(s.mainValues)
+	if s.limit != nil {
+		n += 1
+		sql += fmt.Sprintf(" LIMIT $%d", n)
+	}
+	if s.offset != nil {
+		n += 1
+		sql += fmt.Sprintf(" OFFSET $%d", n)
+	}
+	if s.returning != "" {
+		sql += " RETURNING " + s.returning
+	}
+	return sql
+}
+
+// rawValues returns values of the main statement and the clauses.
+func (s SQLWithValues) rawValues() []interface{} {
+	values := s.mainValues[:len(s.mainValues):len(s.mainValues)]
+	if s.limit != nil {
+		values = append(values, s.limit)
+	}
+	if s.offset != nil {
+		values = append(values, s.offset)
 	}
+	return values
+}
+
+// withError sets the error which is returned instead of executing the
+// statement, for example, the error returned by hooks.
+func (s SQLWithValues) withError(err error) SQLWithValues {
+	s.err = err
+	return s
 }
 
 func (s SQLWithValues) String() string {
 	return s.sql
 }
 
+// OrderBy adds an ORDER BY clause to the SELECT statement. Column can be
+// struct field name or column name of the Model, the clause is not added if
+// the column is not found, so it is safe to use user input as the column.
+// Available modifiers are Asc, Desc, NullsFirst and NullsLast, invalid
+// modifiers are ignored. Call OrderBy() multiple times to order by multiple
+// columns. Don't use OrderBy() if the statement already has ORDER BY. If the
+// conditions of the statement have LIMIT or OFFSET, the clause is added
+// before them.
+//  // SELECT ... FROM orders ORDER BY updated_at DESC NULLS LAST, id
+//  m.Find().OrderBy("UpdatedAt", db.Desc, db.NullsLast).OrderBy("id").MustQuery(&orders)
+func (s SQLWithValues) OrderBy(column string, modifiers ...string) SQLWithValues {
+	column = s.model.columnName(column)
+	if column == "" {
+		return s
+	}
+	var direction, nulls string
+	for _, modifier := range modifiers {
+		switch modifier {
+		case Asc, Desc:
+			direction = " " + modifier
+		case NullsFirst, NullsLast:
+			nulls = " " + modifier
+		}
+	}
+	s.orderBy = append(s.orderBy[:len(s.orderBy):len(s.orderBy)], column+direction+nulls)
+	s.build()
+	return s
+}
+
+// OrderByRaw is like OrderBy but adds the expression to the ORDER BY clause
+// as it is, so you can order by expressions which are not columns. The
+// expression is not validated, never use user input as the expression.
+//  // SELECT ... FROM orders ORDER BY (meta->>'priority')::int DESC, id
+//  m.Find().OrderByRaw("(meta->>'priority')::int DESC").OrderBy("Id").MustQuery(&orders)
+func (s SQLWithValues) OrderByRaw(expression string) SQLWithValues {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return s
+	}
+	s.orderBy = append(s.orderBy[:len(s.orderBy):len(s.orderBy)], expression)
+	s.build()
+	return s
+}
+
+// Limit adds a LIMIT clause to the SELECT statement with the number as a
+// placeholder parameter numbered after other parameters, it is added after
+// the ORDER BY clause added by OrderBy(). If Limit() is called more than
+// once, the last one wins. Don't use Limit() if the statement already has
+// LIMIT.
+//  // SELECT ... FROM orders WHERE status = $1 ORDER BY id DESC LIMIT $2 OFFSET $3
+//  m.Find("WHERE status = $1", "new").OrderBy("Id", db.Desc).Limit(20).Offset(40).MustQuery(&orders)
+func (s SQLWithValues) Limit(limit int) SQLWithValues {
+	s.limit = limit
+	s.build()
+	return s
+}
+
+// Offset is like Limit but adds an OFFSET clause to skip the number of rows.
+func (s SQLWithValues) Offset(offset int) SQLWithValues {
+	s.offset = offset
+	s.build()
+	return s
+}
+
+// TableSample adds a TABLESAMPLE clause after the table name of the SELECT
+// statement built by Select(), Find() or FindExcept() to read only a random
+// sample (percent, from 0 to 100) of the table, useful for approximate
+// statistics of huge tables. Method must be Bernoulli (sample rows, slower
+// but more random) or System (sample pages), otherwise ErrInvalidTableSample
+// is returned when the statement is executed, so is it if the statement is
+// not built by these functions.
+//  // SELECT AVG(amount) FROM orders TABLESAMPLE BERNOULLI (1)
+//  m.Select("AVG(amount)").TableSample(db.Bernoulli, 1).MustQueryRow(&avg)
+func (s SQLWithValues) TableSample(method string, percent float64) SQLWithValues {
+	method = strings.ToUpper(method)
+	if s.tableEnd == 0 || (method != Bernoulli && method != System) || percent < 0 || percent > 100 {
+		return s.withError(ErrInvalidTableSample)
+	}
+	clause := " TABLESAMPLE " + method + " (" + strconv.FormatFloat(percent, 'f', -1, 64) + ")"
+	s.main = s.main[:s.tableEnd] + clause + s.main[s.tableEnd:]
+	s.tableEnd = 0 // only one TABLESAMPLE clause is allowed
+	s.build()
+	return s
+}
+
+// ReturningAll adds a RETURNING clause with all columns of the Model (the
+// same columns as Find()) to the INSERT, UPDATE or DELETE statement, so
+// the results can be put into the struct or slice of structs just like
+// Find(). Don't use ReturningAll() if the statement already has RETURNING.
+//  var user models.User
+//  m.Insert(changes...)().ReturningAll().MustQuery(&user)
+func (s SQLWithValues) ReturningAll() SQLWithValues {
+	s.returning = strings.Join(s.model.columns(), ", ")
+	s.build()
+	return s
+}
+
+// WithLogger overrides the logger of the Model for this statement only.
+//  m.Find().WithLogger(logger.StandardLogger).MustQuery(&users)
+func (s SQLWithValues) WithLogger(logger logger.Logger) SQLWithValues {
+	s.logger = logger
+	return s
+}
+
+// Silent disables logging for this statement only. Useful if the statement
+// is too noisy or contains sensitive data.
+//  m.Update(changes...)("WHERE id = $1", id).Silent().MustExecute()
+func (s SQLWithValues) Silent() SQLWithValues {
+	return s.WithLogger(nil)
+}
+
 // MustQuery is like Query but panics if query operation fails.
 func (s SQLWithValues) MustQuery(target interface{}) {
 	if err := s.Query(target); err != nil {
@@ -80,16 +297,91 @@ func (s SQLWithValues) MustQuery(target interface{}) {
 // is pointer of a struct, at most one row of the query is returned. If target
 // is a pointer of a slice, all rows of the query are returned. If target is a
 // pointer of a map, first column in the SELECT list will be the key of the
-// map, and the second column is the value of the map. For use cases, see
-// Find() and Select().
+// map, and the second column is the value of the map, this also works for
+// statements with RETURNING that return many rows. For use cases, see
+// Find() and Select(). If target is (a slice of) other struct than the struct
+// of the Model, columns are scanned into fields with the same column names
+// if the driver supports it (pq and pgx), otherwise into fields in order.
+//  var groups []struct {
+//  	Status string
+//  	Count  int
+//  }
+//  m.Select("status, COUNT(*) AS count", "GROUP BY status").MustQuery(&groups)
+// JSON columns are unmarshaled into fields with "aggregate" tag, for example:
+//  var orders []struct {
+//  	Id    int
+//  	Items []models.Item `aggregate:""`
+//  }
+//  m.Select("orders.id, COALESCE(json_agg(items ORDER BY items.id) "+
+//  	"FILTER (WHERE items.id IS NOT NULL), '[]') AS items",
+//  	"LEFT JOIN items ON items.order_id = orders.id GROUP BY orders.id").MustQuery(&orders)
+// If the statement is an INSERT without RETURNING and target is (a slice of)
+// the struct of the Model, "RETURNING" with all columns is added, so the
+// struct is populated with the inserted row (including id and default
+// values):
+//  var user models.User
+//  m.Insert(changes...)().MustQuery(&user)
+//  // INSERT INTO users (name) VALUES ($1) RETURNING id, name, created_at
+// If the connection implements Returning and doesn't support RETURNING, the
+// statement is executed in a transaction, the id of the inserted row is the
+// LastInsertId() of the result, or lastval() if the result doesn't have it,
+// then the row is queried with the id in the same transaction. This only
+// works for one row and the pointer of a struct.
+// Errors from the database have the SQL statement appended, use errors.Is()
+// to compare them with the original error.
 func (s SQLWithValues) Query(target interface{}) error {
+	_, err := s.query(target, 0)
+	return err
+}
+
+// QueryWithCount is like Query but also returns number of rows scanned into
+// the target, which is 0 or 1 if target is pointer of a struct.
+//  n, err := m.Find("WHERE status = $1", "new").QueryWithCount(&orders)
+func (s SQLWithValues) QueryWithCount(target interface{}) (n int, err error) {
+	return s.query(target, 0)
+}
+
+// QueryWithCap is like Query but if target is a pointer of a slice, the
+// slice is grown to have room for at least n more elements before scanning,
+// to avoid reallocating the slice many times for large results. The n can be
+// the LIMIT of the statement or the result of Count().
+//  var users []models.User
+//  m.Find("LIMIT 10000").QueryWithCap(&users, 10000)
+func (s SQLWithValues) QueryWithCap(target interface{}, n int) error {
+	_, err := s.query(target, n)
+	return err
+}
+
+// query puts the results into the target and returns number of rows.
+func (s SQLWithValues) query(target interface{}, capacity int) (n int, err error) {
 	if s.model.connection == nil {
-		return ErrNoConnection
+		return 0, ErrNoConnection
+	}
+	if s.err != nil {
+		return 0, s.err
+	}
+	if s.needsReturning(target) {
+		if r, ok := s.model.connection.(Returning); !ok || r.SupportsReturning() {
+			s = s.ReturningAll()
+		} else if reflect.TypeOf(target).Elem().Kind() == reflect.Struct {
+			return s.queryInserted(target)
+		}
+	}
+	if key, ok := s.cacheKey(); ok {
+		if n, ok := s.model.cache.get(key, target); ok {
+			return n, nil
+		}
+		defer func() {
+			if err == nil {
+				s.model.cache.set(key, n, target)
+			}
+		}()
 	}
+	defer s.observe(time.Now(), &err)
 
 	rt := reflect.TypeOf(target)
 	if rt.Kind() != reflect.Ptr {
-		return ErrInvalidTarget
+		return 0, ErrInvalidTarget
 	}
 	rt = rt.Elem()
 
@@ -97,61 +389,80 @@ func (s SQLWithValues) Query(target interface{}) error {
 	if kind == reflect.Struct { // if target is not a slice, use QueryRow instead
 		rv := reflect.Indirect(reflect.ValueOf(target))
 		s.log(s.sql, s.values)
-		return s.scan(rv, s.model.connection.QueryRow(s.sql, s.values...))
+		if err = s.wrapError(s.scan(rv, s.model.connection.QueryRow(s.sql, s.values...))); err == nil {
+			n = 1
+		}
+		return
 	} else if kind == reflect.Map {
 		s.log(s.sql, s.values)
-		rows, err := s.model.connection.Query(s.sql, s.values...)
+		var rows Rows
+		rows, err = s.model.connection.Query(s.sql, s.values...)
 		if err != nil {
-			return err
+			return 0, s.wrapError(err)
 		}
-		defer rows.Close()
-		rv := reflect.Indirect(reflect.ValueOf(target))
-		if rv.IsNil() {
-			rv.Set(reflect.MakeMapWithSize(rt, 0))
-		}
-		mapKeyType := rt.Key()
-		mapValueType := rt.Elem()
-		for rows.Next() {
-			newKey := reflect.New(mapKeyType).Elem()
-			newValue := reflect.New(mapValueType).Elem()
-			if err := rows.Scan(newKey.Addr().Interface(), newValue.Addr().Interface()); err != nil {
-				return err
-			}
-			rv.SetMapIndex(newKey, newValue)
-		}
-		return rows.Err()
+		n, err = scanMap(rows, target)
+		return n, s.wrapError(err)
 	} else if kind != reflect.Slice {
-		return ErrInvalidTarget
+		return 0, ErrInvalidTarget
 	}
 
 	rt = rt.Elem()
 	s.log(s.sql, s.values)
 	rows, err := s.model.connection.Query(s.sql, s.values...)
 	if err != nil {
-		return err
+		return 0, s.wrapError(err)
 	}
 	defer rows.Close()
 	v := reflect.Indirect(reflect.ValueOf(target))
+	if capacity > v.Cap()-v.Len() {
+		grown := reflect.MakeSlice(v.Type(), v.Len(), v.Len()+capacity)
+		reflect.Copy(grown, v)
+		v.Set(grown)
+	}
 	for rows.Next() {
 		rv := reflect.New(rt).Elem()
 		if err := s.scan(rv, rows); err != nil {
-			return err
+			return n, s.wrapError(err)
 		}
 		v.Set(reflect.Append(v, rv))
+		n += 1
 	}
-	return rows.Err()
+	return n, s.wrapError(rows.Err())
+}
+
+// scanMap scans all rows into target, which must be pointer of a map,
+// first column is the key of the map, and second column is the value of the
+// map, returns number of rows. Rows are closed after scanning.
+func scanMap(rows Rows, target interface{}) (n int, err error) {
+	defer rows.Close()
+	rv := reflect.Indirect(reflect.ValueOf(target))
+	rt := rv.Type()
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMapWithSize(rt, 0))
+	}
+	mapKeyType := rt.Key()
+	mapValueType := rt.Elem()
+	for rows.Next() {
+		newKey := reflect.New(mapKeyType).Elem()
+		newValue := reflect.New(mapValueType).Elem()
+		if err := rows.Scan(newKey.Addr().Interface(), newValue.Addr().Interface()); err != nil {
+			return n, err
+		}
+		rv.SetMapIndex(newKey, newValue)
+		n += 1
+	}
+	return n, rows.Err()
 }
 
 // scan a scannable (Row or Rows) into every field of a struct
 func (s SQLWithValues) scan(rv reflect.Value, scannable Scannable) error {
-	if rv.Kind() != reflect.Struct || (s.model.structType != nil && rv.Type() != s.model.structType) {
+	if rv.Kind() != reflect.Struct || isScannable(rv.Type()) {
 		return scannable.Scan(rv.Addr().Interface())
 	}
-	f := rv.FieldByName(tableNameField)
-	if f.Kind() == reflect.String {
-		// hack
-		reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().SetString(s.model.tableName)
+	if s.model.structType == nil || rv.Type() != s.model.structType {
+		return scanStruct(rv, scannable)
 	}
+	setTableNameField(rv, s.model.tableName)
 	dests := []interface{}{}
 	for _, field := range s.model.modelFields {
 		if field.Jsonb != "" {
@@ -164,6 +475,7 @@ func (s SQLWithValues) scan(rv reflect.Value, scannable Scannable) error {
 		} else {
 			pointer = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Interface()
 		}
+		pointer = field.scanner(pointer)
 		dests = append(dests, pointer)
 	}
 	jsonbValues := []jsonbRaw{}
@@ -172,18 +484,8 @@ func (s SQLWithValues) scan(rv reflect.Value, scannable Scannable) error {
 		dests = append(dests, &jsonb)
 		jsonbValues = append(jsonbValues, jsonb)
 	}
-	if s.model.structType == nil || len(dests) == 0 {
-		rt := rv.Type()
-		for i := 0; i < rt.NumField(); i++ {
-			f := rv.Field(i)
-			var pointer interface{}
-			if rt.Field(i).PkgPath == "" {
-				pointer = f.Addr().Interface()
-			} else {
-				pointer = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Interface()
-			}
-			dests = append(dests, pointer)
-		}
+	if len(dests) == 0 {
+		return scanStruct(rv, scannable)
 	}
 	if err := scannable.Scan(dests...); err != nil {
 		return err
@@ -204,7 +506,7 @@ func (s SQLWithValues) scan(rv reflect.Value, scannable Scannable) error {
 			} else {
 				pointer = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Interface()
 			}
-			if err := json.Unmarshal(val, pointer); err != nil {
+			if err := JSONUnmarshal(val, pointer); err != nil {
 				return err
 			}
 		}
@@ -212,6 +514,78 @@ func (s SQLWithValues) scan(rv reflect.Value, scannable Scannable) error {
 	return nil
 }
 
+// scanStruct scans a scannable into fields of any struct. If the scannable
+// has Columns() (like Rows of pq and pgx) and every column has a field with
+// the same column name ("column" tag or field name converted by
+// ToColumnName()), columns are scanned into the fields by name, otherwise
+// columns are scanned into the fields in order. JSON columns are unmarshaled
+// into fields with "aggregate" tag.
+func scanStruct(rv reflect.Value, scannable Scannable) error {
+	rt := rv.Type()
+	fieldsIndex := map[string]int{}
+	pointers := []interface{}{}
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if field.Name == tableNameField {
+			continue
+		}
+		columnName := field.Tag.Get("column")
+		if columnName == "-" {
+			continue
+		}
+		if idx := strings.Index(columnName, ","); idx != -1 {
+			columnName = columnName[:idx]
+		}
+		if columnName == "" {
+			columnName = ToColumnName(field.Name)
+		}
+		f := rv.Field(i)
+		var pointer interface{}
+		if field.PkgPath == "" {
+			pointer = f.Addr().Interface()
+		} else {
+			pointer = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Interface()
+		}
+		if _, ok := field.Tag.Lookup("aggregate"); ok {
+			pointer = &aggregateScanner{f}
+		}
+		fieldsIndex[columnName] = len(pointers)
+		pointers = append(pointers, pointer)
+	}
+	dests := pointers
+	if c, ok := scannable.(interface{ Columns() ([]string, error) }); ok {
+		if columns, err := c.Columns(); err == nil {
+			byName := make([]interface{}, len(columns))
+			for i, column := range columns {
+				idx, ok := fieldsIndex[column]
+				if !ok {
+					byName = nil
+					break
+				}
+				byName[i] = pointers[idx]
+			}
+			if byName != nil {
+				dests = byName
+			}
+		}
+	}
+	return scannable.Scan(dests...)
+}
+
+// isScannable returns true if the struct type should be scanned as one value
+// (like time.Time, decimal.Decimal) instead of a struct with many columns.
+func isScannable(rt reflect.Type) bool {
+	if rt == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	pt := reflect.PtrTo(rt)
+	if pt.Implements(reflect.TypeOf((*interface{ Scan(interface{}) error })(nil)).Elem()) { // database/sql
+		return true
+	}
+	_, ok := pt.MethodByName("ScanValue") // github.com/go-pg/pg/v10/types
+	return ok
+}
+
 // MustQueryRow is like QueryRow but panics if query row operation fails.
 func (s SQLWithValues) MustQueryRow(dest ...interface{}) {
 	if err := s.QueryRow(dest...); err != nil {
@@ -226,10 +600,55 @@ func (s SQLWithValues) MustQueryRow(dest ...interface{}) {
 //  	id   int
 //  }
 //  db.NewModelTable("users", conn).Select("name, id").MustQueryRow(&u.name, &u.id)
+// If the statement has RETURNING and the only dest is pointer of a map, all
+// rows are put into the map just like Query(), first column is the key and
+// second column is the value. Without RETURNING, the first column of the
+// first row is scanned into the map as usual (like a jsonb column).
+//  var tradeNumberToId map[string]int
+//  db.NewModelTable("orders", conn).NewSQLWithValues(
+//  	"INSERT INTO orders (trade_number) VALUES ($1), ($2) RETURNING trade_number, id", "a", "b",
+//  ).MustQueryRow(&tradeNumberToId)
 func (s SQLWithValues) QueryRow(dest ...interface{}) error {
 	return s.QueryRowInTransaction(nil, dest...)
 }
 
+// QueryRowOrNil is like QueryRow but returns found = false and no error if
+// no rows are found, so you can tell "not found" from other errors.
+//  var name string
+//  found, err := model.Select("name", "WHERE id = $1", 1).QueryRowOrNil(&name)
+func (s SQLWithValues) QueryRowOrNil(dest ...interface{}) (found bool, err error) {
+	err = s.QueryRow(dest...)
+	if s.model.IsNoRows(err) {
+		err = nil
+		return
+	}
+	found = err == nil
+	return
+}
+
+// MustQueryJSON is like QueryJSON but panics if query operation fails.
+func (s SQLWithValues) MustQueryJSON(w io.Writer) {
+	if err := s.QueryJSON(w); err != nil {
+		panic(err)
+	}
+}
+
+// QueryJSON makes PostgreSQL build a JSON array of all rows returned by the
+// statement (with json_agg) and writes it to w, so rows don't have to be
+// scanned and marshaled in Go. Keys of the objects are the column names.
+// If there are no rows, [] is written.
+//  // WITH t AS (SELECT id, name FROM users ORDER BY id) SELECT COALESCE(json_agg(t), '[]')::text FROM t
+//  m.Select("id, name", "ORDER BY id").MustQueryJSON(w) // [{"id":1,"name":"foo"}]
+func (s SQLWithValues) QueryJSON(w io.Writer) error {
+	s.sql = "WITH t AS (" + s.sql + ") SELECT COALESCE(json_agg(t), '[]')::text FROM t"
+	var text string
+	if err := s.QueryRow(&text); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, text)
+	return err
+}
+
 // MustQueryRowInTransaction is like QueryRowInTransaction but panics if query
 // row operation fails.
 func (s SQLWithValues) MustQueryRowInTransaction(txOpts *TxOptions, dest ...interface{}) {
@@ -254,7 +673,9 @@ func (s SQLWithValues) MustExecute(dest ...interface{}) {
 
 // Execute executes a query without returning any rows by an UPDATE, INSERT, or
 // DELETE. You can get number of rows affected by providing pointer of int or
-// int64 to the optional dest. For use cases, see Update().
+// int64 to the optional dest. For use cases, see Update(). If the statement
+// has RETURNING and dest is pointer of a map, returned rows are put into the
+// map (see QueryRow()).
 func (s SQLWithValues) Execute(dest ...interface{}) error {
 	return s.ExecuteInTransaction(nil, dest...)
 }
@@ -282,8 +703,38 @@ func (s SQLWithValues) ExecTx(tx Tx, ctx context.Context, dest ...interface{}) (
 		err = ErrNoConnection
 		return
 	}
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	defer s.observe(time.Now(), &err)
 	s.log(s.sql, s.values)
-	err = returnRowsAffected(dest)(tx.ExecContext(ctx, s.sql, s.values...))
+	err = s.wrapError(returnRowsAffected(dest)(tx.ExecContext(ctx, s.sql, s.values...)))
+	return
+}
+
+// QueryRowTx is like QueryRow but executes the statement in a transaction.
+func (s SQLWithValues) QueryRowTx(tx Tx, ctx context.Context, dest ...interface{}) (err error) {
+	if s.model.connection == nil {
+		err = ErrNoConnection
+		return
+	}
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	defer s.observe(time.Now(), &err)
+	s.log(s.sql, s.values)
+	if s.isReturningMap(dest) {
+		var rows Rows
+		rows, err = tx.QueryContext(ctx, s.sql, s.values...)
+		if err == nil {
+			_, err = scanMap(rows, dest[0])
+		}
+		err = s.wrapError(err)
+		return
+	}
+	err = s.wrapError(tx.QueryRowContext(ctx, s.sql, s.values...).Scan(dest...))
 	return
 }
 
@@ -293,8 +744,14 @@ func (s SQLWithValues) QueryTx(tx Tx, ctx context.Context, dest ...interface{})
 		err = ErrNoConnection
 		return
 	}
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	defer s.observe(time.Now(), &err)
 	s.log(s.sql, s.values)
 	rows, err = tx.QueryContext(ctx, s.sql, s.values...)
+	err = s.wrapError(err)
 	return
 }
 
@@ -303,15 +760,65 @@ func (s SQLWithValues) execute(action int, txOpts *TxOptions, dest ...interface{
 		err = ErrNoConnection
 		return
 	}
-	if txOpts == nil || (txOpts.Before == nil && txOpts.After == nil) {
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	if key, ok := s.cacheKey(); ok && action == actionQueryRow && txOpts == nil {
+		if _, ok := s.model.cache.get(key, dest...); ok {
+			return nil
+		}
+		defer func() {
+			if err == nil {
+				s.model.cache.set(key, 0, dest...)
+			}
+		}()
+	}
+	defer s.observe(time.Now(), &err)
+	if txOpts == nil || (txOpts.Before == nil && txOpts.After == nil && txOpts.StatementTimeout <= 0) {
 		s.log(s.sql, s.values)
+		if s.isReturningMap(dest) {
+			var rows Rows
+			rows, err = s.model.connection.Query(s.sql, s.values...)
+			if err == nil {
+				_, err = scanMap(rows, dest[0])
+			}
+			err = s.wrapError(err)
+			return
+		}
 		if action == actionQueryRow {
-			err = s.model.connection.QueryRow(s.sql, s.values...).Scan(dest...)
+			err = s.wrapError(s.model.connection.QueryRow(s.sql, s.values...).Scan(dest...))
 			return
 		}
-		err = returnRowsAffected(dest)(s.model.connection.Exec(s.sql, s.values...))
+		err = s.wrapError(returnRowsAffected(dest)(s.model.connection.Exec(s.sql, s.values...)))
 		return
 	}
+	return s.transaction(txOpts, func(ctx context.Context, tx Tx) (err error) {
+		s.log(s.sql, s.values)
+		if s.isReturningMap(dest) {
+			var rows Rows
+			rows, err = tx.QueryContext(ctx, s.sql, s.values...)
+			if err == nil {
+				_, err = scanMap(rows, dest[0])
+			}
+		} else if action == actionQueryRow {
+			err = tx.QueryRowContext(ctx, s.sql, s.values...).Scan(dest...)
+		} else {
+			err = returnRowsAffected(dest)(tx.ExecContext(ctx, s.sql, s.values...))
+		}
+		return s.wrapError(err)
+	})
+}
+
+// milliseconds returns the positive duration in milliseconds, rounded up so
+// that durations less than 1ms don't become 0 (which means no timeout).
+func milliseconds(d time.Duration) int64 {
+	return int64((d + time.Millisecond - 1) / time.Millisecond)
+}
+
+// transaction runs fn between Before and After of txOptions in a
+// transaction, which is rolled back if any of them returns error or panics.
+func (s SQLWithValues) transaction(txOpts *TxOptions, fn func(context.Context, Tx) error) (err error) {
 	ctx := context.Background()
 	s.log("BEGIN", nil)
 	var tx Tx
@@ -332,18 +839,21 @@ func (s SQLWithValues) execute(action int, txOpts *TxOptions, dest ...interface{
 			err = tx.Commit(ctx)
 		}
 	}()
+	if txOpts.StatementTimeout > 0 {
+		timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", milliseconds(txOpts.StatementTimeout))
+		s.log(timeout, nil)
+		_, err = tx.ExecContext(ctx, timeout)
+		if err != nil {
+			return
+		}
+	}
 	if txOpts.Before != nil {
 		err = txOpts.Before(ctx, tx)
 		if err != nil {
 			return
 		}
 	}
-	s.log(s.sql, s.values)
-	if action == actionQueryRow {
-		err = tx.QueryRowContext(ctx, s.sql, s.values...).Scan(dest...)
-	} else {
-		err = returnRowsAffected(dest)(tx.ExecContext(ctx, s.sql, s.values...))
-	}
+	err = fn(ctx, tx)
 	if err != nil {
 		return
 	}
@@ -356,16 +866,22 @@ func (s SQLWithValues) execute(action int, txOpts *TxOptions, dest ...interface{
 	return
 }
 
+// wrapError adds the SQL statement to the error returned from the database,
+// so that the failing query can be found in the logs. Values are not
+// included since they may contain sensitive data like passwords. The
+// original error can still be checked with errors.Is() or errors.As().
+func (s SQLWithValues) wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w (SQL: %s)", err, s.sql)
+}
+
 func (s SQLWithValues) log(sql string, args []interface{}) {
-	if s.model.logger == nil {
+	if s.logger == nil {
 		return
 	}
-	var prefix string
-	if idx := strings.Index(sql, " "); idx > -1 {
-		prefix = strings.ToUpper(sql[:idx])
-	} else {
-		prefix = strings.ToUpper(sql)
-	}
+	prefix := SQLWithValues{sql: sql}.verb()
 	var colored logger.ColoredString
 	switch prefix {
 	case "DELETE", "DROP", "ROLLBACK":
@@ -378,10 +894,10 @@ func (s SQLWithValues) log(sql string, args []interface{}) {
 		colored = logger.CyanString(sql)
 	}
 	if len(args) == 0 {
-		s.model.logger.Debug(colored)
+		s.logger.Debug(colored)
 		return
 	}
-	s.model.logger.Debug(colored, args)
+	s.logger.Debug(colored, args)
 }
 
 func returnRowsAffected(dest []interface{}) func(Result, error) error {
@@ -7,6 +7,7 @@ import (
 	"database/sql/driver"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -59,8 +60,90 @@ type (
 		hashed string
 		clear  string
 	}
+
+	account struct {
+		Id        int
+		Email     string
+		Name      string
+		DeletedAt *time.Time
+	}
+
+	location struct {
+		Street string
+		Zip    *int
+	}
+
+	parcel struct {
+		Id          int
+		Origin      location  `composite:"furk_location"`
+		Destination *location `composite:"furk_location"`
+	}
+
+	shipment struct {
+		Id      int
+		Address struct {
+			City string
+			Zip  string
+		}
+		Tags []string
+	}
+
+	legacyFlag struct {
+		Id      int
+		Enabled bool `boolAsInt:""`
+	}
+
+	legacyEvent struct {
+		Id   int
+		Date time.Time `timeLayout:"02/01/2006"`
+	}
+
+	setting struct {
+		Id    int
+		Attrs map[string]string `dataType:"hstore"`
+	}
+
+	author struct {
+		Id        int
+		Name      string
+		DeletedAt *time.Time
+	}
+
+	book struct {
+		Id        int
+		AuthorId  int
+		DeletedAt *time.Time
+	}
+
+	// noReturningDB pretends RETURNING is not supported
+	noReturningDB struct {
+		db.DB
+	}
 )
 
+func (d noReturningDB) SupportsReturning() bool {
+	return false
+}
+
+func (d noReturningDB) ConvertParameters(query string, args []interface{}) (string, []interface{}) {
+	if c, ok := d.DB.(db.ConvertParameters); ok {
+		return c.ConvertParameters(query, args)
+	}
+	return query, args
+}
+
+func (s setting) BeforeCreateSchema() string {
+	return "CREATE EXTENSION IF NOT EXISTS hstore;"
+}
+
+func (p parcel) BeforeCreateSchema() string {
+	return "DROP TYPE IF EXISTS furk_location; CREATE TYPE furk_location AS (street text, zip integer);"
+}
+
+func (a account) AfterCreateSchema() string {
+	return "CREATE UNIQUE INDEX accounts_email_idx ON accounts (email) WHERE deleted_at IS NULL;"
+}
+
 func (p password) String() string {
 	return p.hashed
 }
@@ -148,6 +231,60 @@ func TestCRUDInGOPG(t *testing.T) {
 	testCRUD(t, conn)
 }
 
+func TestTypeScriptInterface(_t *testing.T) {
+	t := test{_t}
+	t.String("order typescript interface", db.NewModel(order{}).TypeScriptInterface(), `export interface Order {
+	Id: number;
+	Status: string;
+	TradeNumber: string;
+	foobar_user_id: number;
+	TotalAmount: string;
+	CreatedAt: Date;
+	UpdatedAt: Date;
+	Password: any;
+	FieldInJsonb: string;
+	otherjsonb: string;
+	BadType: number;
+	Sources: { Name: string }[];
+	Sources2: { [key: string]: number };
+	Sources3: { Word: string };
+}
+`)
+	t.String("optional typescript interface", db.NewModel(struct {
+		__TABLE_NAME__ string `user_profiles`
+
+		Id        int
+		Age       *int
+		Tags      []*string `json:"tags"`
+		Meta      json.RawMessage
+		Raw       []byte
+		Status    orderStatus
+		DeletedAt *time.Time `json:"deleted-at"`
+	}{}).TypeScriptInterface(), `export interface UserProfiles {
+	Id: number;
+	Age?: number;
+	tags: (string | null)[];
+	Meta: any;
+	Raw: string;
+	Status: string;
+	"deleted-at"?: Date;
+}
+`)
+}
+
+func TestIsNoRows(_t *testing.T) {
+	t := test{_t}
+	for name, conn := range map[string]db.DB{
+		"pq":   &pq.DB{},
+		"pgx":  &pgx.DB{},
+		"gopg": &gopg.DB{},
+	} {
+		err := fmt.Errorf("%w (SQL: SELECT 1)", conn.ErrNoRows())
+		t.Bool(name+" is no rows", db.IsNoRows(err))
+		t.Bool(name+" is not no rows", !db.IsNoRows(errors.New("no rows")))
+	}
+}
+
 func testCRUD(_t *testing.T, conn db.DB) {
 	t := test{_t}
 
@@ -237,6 +374,11 @@ func testCRUD(_t *testing.T, conn db.DB) {
 	exists2 := model.MustExists("WHERE id = $1", id+1)
 	t.Bool("first order exists #2", exists2 == false)
 
+	var notFound order
+	err = model.Find("WHERE id = $1", id+1).Query(&notFound)
+	t.Bool("not found error is no rows", errors.Is(err, conn.ErrNoRows()))
+	t.Bool("not found error has sql", err != nil && strings.Contains(err.Error(), "FROM orders WHERE id = "))
+
 	err = model.Insert(
 		model.Changes(db.RawChanges{
 			"Status": "new2",
@@ -267,6 +409,27 @@ func testCRUD(_t *testing.T, conn db.DB) {
 	t.Int("map length", len(status2id), 2)
 	t.Int("map 0", status2id["new"], 1)
 	t.Int("map 1", status2id["new2"], 2)
+	var groups []struct {
+		Status string
+		Count  int
+	}
+	model.Select("status, COUNT(*) AS count", "GROUP BY status ORDER BY status").MustQuery(&groups)
+	t.String("group by", fmt.Sprintf("%+v", groups), "[{Status:new Count:1} {Status:new2 Count:1}]")
+	var anyIds []int
+	model.Select("id", db.Where{}.AnyEq("status", []string{"new2", "none"})).MustQuery(&anyIds)
+	t.String("any ids", fmt.Sprint(anyIds), "[2]")
+	var allIds []int
+	model.Select("id", db.Where{}.All("id", "<>", []int64{2, 3})).MustQuery(&allIds)
+	t.String("all ids", fmt.Sprint(allIds), "[1]")
+	var matchIds []int
+	model.Select("id", db.Where{}.Matches("status", "^new[0-9]$")).MustQuery(&matchIds)
+	t.String("matches", fmt.Sprint(matchIds), "[2]")
+	matchIds = nil
+	model.Select("id", db.Where{}.IMatches("status", "^NEW$")).MustQuery(&matchIds)
+	t.String("imatches", fmt.Sprint(matchIds), "[1]")
+	matchIds = nil
+	model.Select("id", db.Where{}.SimilarTo("status", "new(2|3)")).MustQuery(&matchIds)
+	t.String("similar to", fmt.Sprint(matchIds), "[2]")
 	var createdAts []time.Time
 	model.Select("created_at").MustQuery(&createdAts)
 	t.Int("created_at length", len(createdAts), 2)
@@ -336,6 +499,47 @@ func testCRUD(_t *testing.T, conn db.DB) {
 	t.Int("second order id", orders[1].Id, 1)
 	t.Int("second order jsonbTest", orders[1].jsonbTest, 123)
 
+	cur, err := model.Find("ORDER BY id ASC").Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cursorOrders []order
+	for cur.Next() {
+		var o order
+		if err := cur.Scan(&o); err != nil {
+			t.Fatal(err)
+		}
+		cursorOrders = append(cursorOrders, o)
+	}
+	if err := cur.Err(); err != nil {
+		t.Fatal(err)
+	}
+	cur.Close()
+	t.Int("cursor orders size", len(cursorOrders), 2)
+	t.Int("cursor first order id", cursorOrders[0].Id, 1)
+	t.Int("cursor first order jsonbTest", cursorOrders[0].jsonbTest, 123)
+	t.Int("cursor second order id", cursorOrders[1].Id, 2)
+
+	cur, err = model.Find("ORDER BY id ASC").FetchSize(1).Cursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetchedIds := []int{}
+	for cur.Next() {
+		var o order
+		if err := cur.Scan(&o); err != nil {
+			t.Fatal(err)
+		}
+		fetchedIds = append(fetchedIds, o.Id)
+	}
+	if err := cur.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cur.Close(); err != nil {
+		t.Fatal(err)
+	}
+	t.String("fetch size cursor ids", fmt.Sprint(fetchedIds), "[1 2]")
+
 	time.Sleep(200 * time.Millisecond)
 	updateInput := strings.NewReader(`{
 		"Status": "modified",
@@ -404,6 +608,182 @@ func testCRUD(_t *testing.T, conn db.DB) {
 	var u int
 	t.Int("order user", secondOrder.UserId, u-23+99)
 
+	// all columns are returned after insert
+	var returned order
+	model.Insert(model.Changes(db.RawChanges{
+		"Status":       "returning",
+		"TradeNumber":  "returning-all",
+		"FieldInJsonb": "all",
+	}), model.CreatedAt())().ReturningAll().MustQuery(&returned)
+	t.Bool("returning all id", returned.Id > 2)
+	t.String("returning all status", returned.Status, "returning")
+	t.String("returning all trade number", returned.TradeNumber, "returning-all")
+	t.String("returning all jsonb", returned.FieldInJsonb, "all")
+	t.Bool("returning all created at", !returned.CreatedAt.IsZero())
+	model.Delete("WHERE id = $1", returned.Id).ReturningAll().MustQuery(&returned)
+	t.String("returning all deleted status", returned.Status, "returning")
+
+	// all or nothing
+	ids, err = model.InsertAll([]db.Changes{
+		model.Changes(db.RawChanges{"Id": 5000, "Status": "all"}),
+		model.Changes(db.RawChanges{"Id": 5000, "Status": "all"}),
+	})
+	t.Bool("insert all duplicate error", err != nil)
+	t.Int("insert all duplicate ids", len(ids), 0)
+	t.Int("insert all duplicate rolled back", model.MustCount("WHERE status = $1", "all"), 0)
+	ids, err = model.InsertAll([]db.Changes{
+		model.Changes(db.RawChanges{"Id": 5000, "Status": "all"}),
+		model.Changes(db.RawChanges{"Id": 5001, "Status": "all"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.String("insert all ids", fmt.Sprint(ids), "[5000 5001]")
+	model.Delete("WHERE status = $1", "all").MustExecute(&rowsAffected)
+	t.Int("insert all rows deleted", rowsAffected, 2)
+
+	// migrate rows with cursor
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, db.LevelReadCommitted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txCur, err := model.Find("ORDER BY id ASC FOR UPDATE").DeclareCursorTx(tx, ctx, "orders_cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrated int
+	for {
+		var o order
+		found, err := txCur.Fetch(&o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found {
+			break
+		}
+		err = model.Update(model.Changes(db.RawChanges{
+			"TradeNumber": "migrated-" + o.Status,
+		}))(txCur.WhereCurrentOf()).ExecTx(tx, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		migrated += 1
+	}
+	if err := txCur.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Int("cursor migrated rows", migrated, 2)
+	t.Int("cursor migrated count", model.MustCount("WHERE trade_number LIKE $1", "migrated-%"), 2)
+
+	// inserted, updated or unchanged
+	statuses, err = model.Sync([]db.Changes{
+		model.Changes(db.RawChanges{"Id": 1, "Status": "synced"}),
+		model.Changes(db.RawChanges{"Id": 6000, "Status": "synced"}),
+	}, []string{"Id"}, []string{"Status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.String("sync statuses", strings.Join(statuses, ","), "updated,inserted")
+	statuses, err = model.Sync([]db.Changes{
+		model.Changes(db.RawChanges{"Id": 6000, "Status": "synced"}),
+		model.Changes(db.RawChanges{"Id": 6001, "Status": "synced"}),
+		model.Changes(db.RawChanges{"Id": 1, "Status": "synced again"}),
+	}, []string{"Id"}, []string{"Status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.String("sync statuses again", strings.Join(statuses, ","), "unchanged,inserted,updated")
+	model.Delete("WHERE id > $1", 5000).MustExecute()
+
+	// merge keys vs replace whole jsonb column
+	model.Update(model.Changes(db.RawChanges{
+		"FieldInJsonb": "green",
+	}))("WHERE id = $1", 2).MustExecute()
+	var jsonbOrder order
+	model.Find("WHERE id = $1", 2).MustQuery(&jsonbOrder)
+	t.String("merged FieldInJsonb", jsonbOrder.FieldInJsonb, "green")
+	t.String("merged OtherJsonb", jsonbOrder.OtherJsonb, "blue")
+	model.Update(model.JsonbWhole("meta", map[string]string{
+		"field_in_jsonb": "white",
+	}))("WHERE id = $1", 2).MustExecute()
+	jsonbOrder = order{}
+	model.Find("WHERE id = $1", 2).MustQuery(&jsonbOrder)
+	t.String("replaced FieldInJsonb", jsonbOrder.FieldInJsonb, "white")
+	t.String("replaced OtherJsonb", jsonbOrder.OtherJsonb, "")
+
+	// change one jsonb key of many rows, other keys are kept
+	model.Update(model.Changes(db.RawChanges{
+		"OtherJsonb": "bulk",
+	}))("WHERE id IN ($1, $2)", 1, 2).MustExecute(&rowsAffected)
+	t.Int("bulk jsonb rows affected", rowsAffected, 2)
+	t.Int("bulk jsonb count", model.MustCount("WHERE meta->>'other_jsonb' = $1", "bulk"), 2)
+	jsonbOrder = order{}
+	model.Find("WHERE id = $1", 2).MustQuery(&jsonbOrder)
+	t.String("bulk jsonb kept FieldInJsonb", jsonbOrder.FieldInJsonb, "white")
+
+	// slow statement is canceled and changes in Before are rolled back
+	err = model.NewSQLWithValues("SELECT pg_sleep(1)").ExecuteInTransaction(&db.TxOptions{
+		StatementTimeout: 100 * time.Millisecond,
+		Before: func(ctx context.Context, tx db.Tx) error {
+			return model.NewSQLWithValues("UPDATE orders SET status = $1", "timeout").ExecTx(tx, ctx)
+		},
+	})
+	t.String("statement timeout error code", conn.ErrGetCode(err), "57014")
+	t.Int("statement timeout rolled back", model.MustCount("WHERE status = $1", "timeout"), 0)
+
+	// older changes should not overwrite newer ones
+	err = model.Upsert([]string{"Id"}, model.Changes(db.RawChanges{
+		"Id":        2,
+		"Status":    "older",
+		"UpdatedAt": time.Now().Add(-1 * time.Hour),
+	}))("WHERE orders.updated_at < EXCLUDED.updated_at").Execute(&rowsAffected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("upsert older rows affected", rowsAffected, 0)
+	var status string
+	model.Select("status", "WHERE id = $1", 2).MustQueryRow(&status)
+	t.String("upsert older status", status, "furk")
+	err = model.Upsert([]string{"Id"}, model.Changes(db.RawChanges{
+		"Id":        2,
+		"Status":    "newer",
+		"UpdatedAt": time.Now().Add(1 * time.Hour),
+	}))("WHERE orders.updated_at < EXCLUDED.updated_at").Execute(&rowsAffected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("upsert newer rows affected", rowsAffected, 1)
+	model.Select("status", "WHERE id = $1", 2).MustQueryRow(&status)
+	t.String("upsert newer status", status, "newer")
+
+	// inserted or updated in batch upsert
+	var results []struct {
+		Id       int
+		Inserted bool
+	}
+	err = model.BatchUpsert([]string{"Id"},
+		[]db.Changes{model.Changes(db.RawChanges{"Id": 2, "Status": "batch"})},
+		[]db.Changes{model.Changes(db.RawChanges{"Id": 1000, "Status": "batch"})},
+	)("RETURNING id, (xmax = 0) AS inserted").Query(&results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("batch upsert results", len(results), 2)
+	for _, result := range results {
+		t.Bool(fmt.Sprintf("batch upsert row %d inserted", result.Id), result.Inserted == (result.Id == 1000))
+	}
+	model.UpdateFrom("(VALUES ($1::int, $2::text)) AS v (id, status)", model.Changes(db.RawChanges{
+		"TradeNumber": "from",
+	}))("WHERE orders.id = v.id AND orders.status = v.status", 1000, "batch").MustExecute(&rowsAffected)
+	t.Int("update from rows affected", rowsAffected, 1)
+	t.Int("update from count", model.MustCount("WHERE trade_number = $1", "from"), 1)
+	model.DeleteUsing("(VALUES ($1::int)) AS v (id)", "WHERE orders.id = v.id", 1000).MustExecute(&rowsAffected)
+	t.Int("delete using rows affected", rowsAffected, 1)
+
 	count, err := model.Count()
 	if err != nil {
 		t.Fatal(err)
@@ -422,6 +802,748 @@ func testCRUD(_t *testing.T, conn db.DB) {
 		t.Fatal(err)
 	}
 	t.Int("rows count", count, 0)
+
+	var tradeNumberToId map[string]int
+	err = model.NewSQLWithValues(
+		"INSERT INTO orders (trade_number) VALUES ($1), ($2) RETURNING trade_number, id", "a", "b",
+	).QueryRow(&tradeNumberToId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("returning map length", len(tradeNumberToId), 2)
+	t.Int("returning map ids", tradeNumberToId["b"]-tradeNumberToId["a"], 1)
+	err = model.Delete("RETURNING trade_number, id").Execute(&tradeNumberToId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("returning map length after delete", len(tradeNumberToId), 2)
+
+	testUpsertPartial(t, conn)
+	testComposite(t, conn)
+	testHstore(t, conn)
+	testTimeLayout(t, conn)
+	testCascadeSoftDelete(t, conn)
+	testQueryJSON(t, conn)
+	testEstimatedCount(t, conn)
+	testAdvisoryLock(t, conn)
+	testLatestPerGroup(t, conn)
+	testNull(t, conn)
+	testStats(t, conn)
+	testSnapshot(t, conn)
+	testCopyFrom(t, conn)
+	testLeftJoinLateral(t, conn)
+	testAggregate(t, conn)
+	testJsonbKey(t, conn)
+	testSave(t, conn)
+	testEnum(t, conn)
+	testInsertIfNotExists(t, conn)
+	testQuoteIdentifier(t, conn)
+	testUpdateIfChanged(t, conn)
+	testBatchInsertReturning(t, conn)
+	testSoftDelete(t, conn)
+	testPrepare(t, conn)
+	testAutoReturning(t, conn)
+	testInsertTimeZone(t, conn)
+	testPaginate(t, conn)
+	testBoolAsInt(t, conn)
+	testValues(t, conn)
+	testComplexType(t, conn)
+	testQueryCache(t, conn)
+}
+
+func testUpsertPartial(t test, conn db.DB) {
+	m := db.NewModel(account{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	// soft-deleted duplicate is not covered by the partial unique index
+	m.Insert(m.Changes(db.RawChanges{
+		"Email":     "foo@example.com",
+		"Name":      "deleted",
+		"DeletedAt": time.Now(),
+	}))().MustExecute()
+	m.Insert(m.Changes(db.RawChanges{
+		"Email": "foo@example.com",
+		"Name":  "active",
+	}))().MustExecute()
+	var rowsAffected int
+	m.UpsertPartial([]string{"Email"}, "deleted_at IS NULL", m.Changes(db.RawChanges{
+		"Email": "foo@example.com",
+		"Name":  "upserted",
+	}))().MustExecute(&rowsAffected)
+	t.Int("partial upsert rows affected", rowsAffected, 1)
+	t.Int("partial upsert accounts count", m.MustCount(), 2)
+	var names []string
+	m.Select("name", "ORDER BY id ASC").MustQuery(&names)
+	t.String("partial upsert names", strings.Join(names, ","), "deleted,upserted")
+}
+
+func testComposite(t test, conn db.DB) {
+	m := db.NewModel(parcel{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	zip := 10001
+	var id int
+	m.Insert(m.Changes(db.RawChanges{
+		"Origin": location{Street: `1 "Main" St, (A)`, Zip: &zip},
+	}))("RETURNING id").MustQueryRow(&id)
+	var p parcel
+	m.Find("WHERE id = $1", id).MustQuery(&p)
+	t.String("composite street", p.Origin.Street, `1 "Main" St, (A)`)
+	t.Int("composite zip", *p.Origin.Zip, zip)
+	t.Bool("composite null", p.Destination == nil)
+
+	m.Update(m.Changes(db.RawChanges{
+		"Destination": location{Street: "2 Main St"},
+	}))("WHERE id = $1", id).MustExecute()
+	m.Find("WHERE id = $1", id).MustQuery(&p)
+	t.String("composite updated street", p.Destination.Street, "2 Main St")
+	t.Bool("composite updated zip", p.Destination.Zip == nil)
+}
+
+func testHstore(t test, conn db.DB) {
+	m := db.NewModel(setting{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	var id int
+	m.Insert(m.Changes(db.RawChanges{
+		"Attrs": map[string]string{"color": "red", "quote": `"a, b"=>c`},
+	}))("RETURNING id").MustQueryRow(&id)
+	var s setting
+	m.Find("WHERE id = $1", id).MustQuery(&s)
+	t.Int("hstore length", len(s.Attrs), 2)
+	t.String("hstore color", s.Attrs["color"], "red")
+	t.String("hstore quote", s.Attrs["quote"], `"a, b"=>c`)
+	var color string
+	m.Select("attrs -> 'color'", "WHERE id = $1", id).MustQueryRow(&color)
+	t.String("hstore operator", color, "red")
+}
+
+func testTimeLayout(t test, conn db.DB) {
+	m := db.NewModel(legacyEvent{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	date := time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)
+	var e legacyEvent
+	m.Insert(m.Changes(db.RawChanges{
+		"Date": date,
+	}))().ReturningAll().MustQuery(&e)
+	t.String("time layout date", e.Date.String(), date.String())
+	var text string
+	m.Select("date", "WHERE id = $1", e.Id).MustQueryRow(&text)
+	t.String("time layout text", text, "31/12/2021")
+}
+
+func testCascadeSoftDelete(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	books := db.NewModel(book{}, conn, logger.StandardLogger)
+	for _, m := range []*db.Model{authors, books} {
+		m.NewSQLWithValues(m.DropSchema()).MustExecute()
+		m.NewSQLWithValues(m.Schema()).MustExecute()
+	}
+
+	var authorIds []int
+	authors.BatchInsert(
+		[]db.Changes{authors.Changes(db.RawChanges{"Name": "foo"})},
+		[]db.Changes{authors.Changes(db.RawChanges{"Name": "bar"})},
+	)("RETURNING id").MustQuery(&authorIds)
+	for _, id := range append(authorIds, authorIds[0]) {
+		books.Insert(books.Changes(db.RawChanges{"AuthorId": id}))().MustExecute()
+	}
+
+	var ids []int
+	authors.CascadeSoftDelete(books)("WHERE name = $1", "foo").MustQuery(&ids)
+	t.Int("cascade soft delete parents", len(ids), 1)
+	t.Int("cascade soft delete remaining authors", authors.MustCount("WHERE deleted_at IS NULL"), 1)
+	t.Int("cascade soft delete remaining books", books.MustCount("WHERE deleted_at IS NULL"), 1)
+	t.Int("cascade soft delete deleted books", books.MustCount("WHERE author_id = $1 AND deleted_at IS NOT NULL", authorIds[0]), 2)
+
+	authors.CascadeSoftDelete(books)("WHERE name = $1", "foo").MustQuery(&ids)
+	t.Int("cascade soft delete again", len(ids), 0)
+
+	// author foo and 2 books of foo are deleted, 1 book of bar is active
+	books.Update(books.Changes(db.RawChanges{"DeletedAt": time.Now()}))("WHERE author_id = $1", authorIds[1]).MustExecute()
+	books.Insert(books.Changes(db.RawChanges{"AuthorId": authorIds[1]}))().MustExecute()
+	var count int
+	authors.SoftDelete().Join("COUNT(*)", books.SoftDelete(), "books.author_id = authors.id")().MustQueryRow(&count)
+	t.Int("join soft delete", count, 1)
+	authors.Join("COUNT(*)", books, "books.author_id = authors.id")().MustQueryRow(&count)
+	t.Int("join with soft deleted", count, 4)
+	var rows []struct {
+		Name   string
+		BookId *int
+	}
+	authors.LeftJoin("authors.name, books.id", books.SoftDelete(), "books.author_id = authors.id")(
+		"ORDER BY authors.name, books.id").MustQuery(&rows)
+	t.Int("left join soft delete", len(rows), 2)
+	t.Bool("left join soft delete nulls", rows[0].Name == "bar" && rows[0].BookId != nil && rows[1].Name == "foo" && rows[1].BookId == nil)
+
+	var names []string
+	authors.Select("name", db.Where{}.Exists(
+		"SELECT 1 FROM books WHERE books.author_id = authors.id AND books.deleted_at IS NULL",
+	)).MustQuery(&names)
+	t.String("exists", fmt.Sprint(names), "[bar]")
+	names = nil
+	authors.Select("name", db.Where{}.Eq("name", "foo").NotExists(
+		"SELECT 1 FROM books WHERE books.author_id = authors.id AND books.deleted_at IS NULL AND books.id > $1", 0,
+	)).MustQuery(&names)
+	t.String("not exists", fmt.Sprint(names), "[foo]")
+}
+
+func testQueryJSON(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	var b strings.Builder
+	m.Select("name", "WHERE name = $1", "foo").MustQueryJSON(&b)
+	t.String("query json", b.String(), `[{"name":"foo"}]`)
+	b.Reset()
+	m.Select("name", "WHERE name = $1", "baz").MustQueryJSON(&b)
+	t.String("query json empty", b.String(), "[]")
+}
+
+func testEstimatedCount(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	t.Int("estimated count before analyze", m.MustEstimatedCount(), 0)
+	m.NewSQLWithValues("INSERT INTO authors (name) SELECT 'author ' || i FROM generate_series(1, 10000) i").MustExecute()
+	m.NewSQLWithValues("ANALYZE authors").MustExecute()
+	exact := m.MustCount()
+	estimate := m.MustEstimatedCount()
+	t.Int("exact count", exact, 10000)
+	t.Bool("estimated count", estimate > exact*9/10 && estimate < exact*11/10)
+	_, err := db.NewModelTable("not_exists", conn).EstimatedCount()
+	t.Bool("estimated count of unknown table", db.IsNoRows(err))
+}
+
+func testAdvisoryLock(t test, conn db.DB) {
+	called := false
+	err := db.WithAdvisoryLock(conn, 4242, func() error {
+		called = true
+		// the lock is held by the transaction, so other sessions can't get it
+		acquired, err := db.TryAdvisoryLock(conn, 4242)
+		if err != nil {
+			return err
+		}
+		t.Bool("try advisory lock when locked", !acquired)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Bool("with advisory lock", called)
+	acquired, err := db.TryAdvisoryLock(conn, 4242)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Bool("try advisory lock when unlocked", acquired)
+}
+
+func testLatestPerGroup(t test, conn db.DB) {
+	m := db.NewModel(book{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	for _, authorId := range []int{1, 2, 1, 3, 2, 1} {
+		m.Insert(m.Changes(db.RawChanges{"AuthorId": authorId}))().MustExecute()
+	}
+	var books []book
+	m.LatestPerGroup("AuthorId", "Id")().MustQuery(&books)
+	t.Int("latest per group size", len(books), 3)
+	ids := []int{}
+	for _, b := range books {
+		ids = append(ids, b.AuthorId, b.Id)
+	}
+	t.String("latest per group", fmt.Sprint(ids), "[1 6 2 5 3 4]")
+	m.LatestPerGroup("AuthorId", "Id")("WHERE id < $1", 5).MustQuery(&books)
+	t.Int("latest per group with conditions size", len(books), 3)
+	t.Int("latest per group with conditions", books[0].Id, 3)
+}
+
+func testNull(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	var a author
+	m.Insert(m.Changes(db.RawChanges{
+		"Name":      "foo",
+		"DeletedAt": time.Now(),
+	}))("RETURNING id, name, deleted_at").MustQuery(&a)
+	t.Bool("deleted at is set", a.DeletedAt != nil)
+	m.Update(m.Changes(db.RawChanges{
+		"DeletedAt": db.Null,
+	}))("WHERE id = $1 RETURNING id, name, deleted_at", a.Id).MustQuery(&a)
+	t.Bool("deleted at is null", a.DeletedAt == nil)
+	t.Int("deleted at is null count", m.MustCount("WHERE deleted_at IS NULL"), 1)
+}
+
+func testStats(t test, conn db.DB) {
+	before := conn.Stats()
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, db.LevelReadCommitted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	stats := conn.Stats()
+	t.Int("stats in use", stats.InUse, before.InUse+1)
+	t.Bool("stats open", stats.Open > 0 && stats.Open == stats.InUse+stats.Idle)
+	tx.Rollback(ctx)
+	t.Int("stats in use after rollback", conn.Stats().InUse, before.InUse)
+}
+
+func testSnapshot(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	var before, after int
+	err := m.Snapshot(func(ctx context.Context, tx db.Tx) error {
+		if err := m.Select("COUNT(*)").QueryRowTx(tx, ctx, &before); err != nil {
+			return err
+		}
+		// changes committed by others are not visible in the snapshot
+		m.Insert(m.Changes(db.RawChanges{"Name": "snapshot"}))().MustExecute()
+		if err := m.Select("COUNT(*)").QueryRowTx(tx, ctx, &after); err != nil {
+			return err
+		}
+		return m.Delete().ExecTx(tx, ctx)
+	})
+	t.String("snapshot read only error code", conn.ErrGetCode(err), "25006")
+	t.Int("snapshot count", after, before)
+	t.Int("snapshot count outside", m.MustCount(), before+1)
+}
+
+func testCopyFrom(t test, conn db.DB) {
+	if _, ok := conn.(db.CopyFrom); !ok {
+		return
+	}
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	now := time.Now()
+	count, err := m.CopyFrom([]string{"Name"}, []author{
+		{Id: 100, Name: "foo", DeletedAt: &now},
+		{Id: 200, Name: "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Int("copy from count", int(count), 2)
+	var authors []author
+	m.Find("ORDER BY id").MustQuery(&authors)
+	t.Int("copy from authors", len(authors), 2)
+	t.Int("copy from default id", authors[0].Id, 1)
+	t.String("copy from name", authors[1].Name, "bar")
+	t.Bool("copy from default deleted at", authors[0].DeletedAt == nil)
+}
+
+func testLeftJoinLateral(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	books := db.NewModel(book{}, conn, logger.StandardLogger)
+	for _, m := range []*db.Model{authors, books} {
+		m.NewSQLWithValues(m.DropSchema()).MustExecute()
+		m.NewSQLWithValues(m.Schema()).MustExecute()
+	}
+	for _, name := range []string{"foo", "bar", "baz"} {
+		authors.Insert(authors.Changes(db.RawChanges{"Name": name}))().MustExecute()
+	}
+	for _, authorId := range []int{1, 1, 1, 2} {
+		books.Insert(books.Changes(db.RawChanges{"AuthorId": authorId}))().MustExecute()
+	}
+	var rows []struct {
+		Name   string
+		BookId *int
+	}
+	latest := books.Select("id", "WHERE books.author_id = authors.id ORDER BY id DESC LIMIT $1", 2)
+	authors.LeftJoinLateral("authors.name, latest.id", latest, "latest")(
+		"WHERE authors.name <> $1 ORDER BY authors.id, latest.id DESC", "bar",
+	).MustQuery(&rows)
+	result := []string{}
+	for _, row := range rows {
+		if row.BookId == nil {
+			result = append(result, row.Name+":nil")
+		} else {
+			result = append(result, fmt.Sprintf("%s:%d", row.Name, *row.BookId))
+		}
+	}
+	t.String("left join lateral", strings.Join(result, ","), "foo:3,foo:2,baz:nil")
+}
+
+func testAggregate(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	books := db.NewModel(book{}, conn, logger.StandardLogger)
+	for _, m := range []*db.Model{authors, books} {
+		m.NewSQLWithValues(m.DropSchema()).MustExecute()
+		m.NewSQLWithValues(m.Schema()).MustExecute()
+	}
+	for _, name := range []string{"foo", "bar"} {
+		authors.Insert(authors.Changes(db.RawChanges{"Name": name}))().MustExecute()
+	}
+	for _, authorId := range []int{1, 1} {
+		books.Insert(books.Changes(db.RawChanges{"AuthorId": authorId}))().MustExecute()
+	}
+	type bookItem struct {
+		Id       int `json:"id"`
+		AuthorId int `json:"author_id"`
+	}
+	var rows []struct {
+		Name  string
+		Books []bookItem `aggregate:""`
+	}
+	authors.Select("authors.name, COALESCE(json_agg(books ORDER BY books.id) "+
+		"FILTER (WHERE books.id IS NOT NULL), '[]') AS books",
+		"LEFT JOIN books ON books.author_id = authors.id GROUP BY authors.id ORDER BY authors.id").MustQuery(&rows)
+	t.Int("aggregate rows", len(rows), 2)
+	t.String("aggregate", fmt.Sprint(rows), "[{foo [{1 1} {2 1}]} {bar []}]")
+}
+
+func testJsonbKey(t test, conn db.DB) {
+	type profile struct {
+		__TABLE_NAME__ string `profiles`
+
+		Id        int
+		FirstName string `jsonb:"meta" jsonbKey:"firstName"`
+		LastName  string `jsonb:"meta" jsonbKey:"lastName"`
+	}
+	m := db.NewModel(profile{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	m.Insert(m.Changes(db.RawChanges{"FirstName": "foo", "LastName": "bar"}))().MustExecute()
+	m.Update(m.Changes(db.RawChanges{"LastName": "baz"}))().MustExecute()
+	var p profile
+	m.Find().MustQuery(&p)
+	t.String("jsonb key", p.FirstName+" "+p.LastName, "foo baz")
+	var keys string
+	m.Select("meta->>'firstName' || meta->>'lastName'").MustQueryRow(&keys)
+	t.String("jsonb key in database", keys, "foobaz")
+}
+
+func testSave(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	authors.NewSQLWithValues(authors.DropSchema()).MustExecute()
+	authors.NewSQLWithValues(authors.Schema()).MustExecute()
+	a := author{Name: "foo"}
+	err := authors.Save(&a)
+	t.Bool("save create", err == nil)
+	t.Int("save id", a.Id, 1)
+	a.Name = "bar"
+	err = authors.Save(&a)
+	t.Bool("save update", err == nil)
+	var name string
+	authors.Select("name", "WHERE id = $1", a.Id).MustQueryRow(&name)
+	t.String("save name", name, "bar")
+	t.Int("save count", authors.MustCount(), 1)
+	a.Id = 100
+	t.Bool("save not found", authors.IsNoRows(authors.Save(&a)))
+}
+
+type orderStatus int
+
+const (
+	orderStatusNew orderStatus = iota
+	orderStatusPaid
+)
+
+func (s orderStatus) MarshalText() ([]byte, error) {
+	return []byte([]string{"new", "paid"}[s]), nil
+}
+
+func (s *orderStatus) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "new":
+		*s = orderStatusNew
+	case "paid":
+		*s = orderStatusPaid
+	default:
+		return fmt.Errorf("invalid status: %s", text)
+	}
+	return nil
+}
+
+func testEnum(t test, conn db.DB) {
+	type enumOrder struct {
+		__TABLE_NAME__ string `enum_orders`
+
+		Id     int
+		Status orderStatus `enumAs:"text"`
+		Code   orderStatus `enumAs:"int"`
+	}
+	m := db.NewModel(enumOrder{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	m.Insert(m.Changes(db.RawChanges{"Status": orderStatusPaid, "Code": orderStatusPaid}))().MustExecute()
+	var o enumOrder
+	m.Find().MustQuery(&o)
+	t.Int("enum text", int(o.Status), int(orderStatusPaid))
+	t.Int("enum int", int(o.Code), int(orderStatusPaid))
+	var status string
+	var code int
+	m.Select("status, code").MustQueryRow(&status, &code)
+	t.String("enum text in database", status, "paid")
+	t.Int("enum int in database", code, 1)
+}
+
+func testInsertIfNotExists(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	authors.NewSQLWithValues(authors.DropSchema()).MustExecute()
+	authors.NewSQLWithValues(authors.Schema()).MustExecute()
+	authors.NewSQLWithValues("CREATE UNIQUE INDEX authors_name ON authors (name)").MustExecute()
+	inserted, id, err := authors.InsertIfNotExists([]string{"Name"}, authors.Changes(db.RawChanges{"Name": "foo"}))
+	t.Bool("insert if not exists", err == nil && inserted)
+	t.Int("insert if not exists id", id, 1)
+	inserted, id, err = authors.InsertIfNotExists([]string{"Name"}, authors.Changes(db.RawChanges{"Name": "foo"}))
+	t.Bool("insert if not exists conflict", err == nil && !inserted)
+	t.Int("insert if not exists conflict id", id, 0)
+	t.Int("insert if not exists count", authors.MustCount(), 1)
+	err = authors.Insert(authors.Changes(db.RawChanges{"Name": "foo"}))().Execute()
+	t.Bool("insert duplicate has code", authors.ErrHasCode(err, "23505"))
+	t.Bool("insert duplicate is unique violation", db.IsUniqueViolation(err))
+
+	var rowsAffected int
+	authors.InsertDoNothing(nil, authors.Changes(db.RawChanges{"Name": "foo"}))().MustExecute(&rowsAffected)
+	t.Int("insert do nothing conflict", rowsAffected, 0)
+	authors.InsertDoNothing([]string{"Name"}, authors.Changes(db.RawChanges{"Name": "bar"}))().MustExecute(&rowsAffected)
+	t.Int("insert do nothing", rowsAffected, 1)
+}
+
+func testValues(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	authors.NewSQLWithValues(authors.DropSchema()).MustExecute()
+	authors.NewSQLWithValues(authors.Schema()).MustExecute()
+	authors.BatchInsert(
+		[]db.Changes{authors.Changes(db.RawChanges{"Name": "foo"})},
+		[]db.Changes{authors.Changes(db.RawChanges{"Name": "bar"})},
+	)().MustExecute()
+
+	var rowsAffected int
+	v := db.Values([]string{"name", "new_name"}, [][]interface{}{{"foo", "foo2"}, {"bar", "bar2"}, {"baz", "baz2"}})
+	authors.NewSQLWithValues("UPDATE authors SET name = v.new_name FROM "+v.Offset(1).String()+
+		" WHERE authors.name = v.name AND authors.id > $1", append([]interface{}{0}, v.Values()...)...).MustExecute(&rowsAffected)
+	t.Int("values update", rowsAffected, 2)
+	var names []string
+	authors.Select("name", "ORDER BY name").MustQuery(&names)
+	t.String("values names", fmt.Sprint(names), "[bar2 foo2]")
+}
+
+func testQuoteIdentifier(t test, conn db.DB) {
+	m := db.NewModelTable("", conn, logger.StandardLogger)
+	t.String("quote identifier", m.QuoteIdentifier("order"), `"order"`)
+	q, ok := conn.(db.QuoteIdentifier)
+	t.Bool("adapter implements quote identifier", ok)
+	if ok {
+		t.String("adapter quote identifier", q.QuoteIdentifier(`a"b`), `"a""b"`)
+	}
+	var order int
+	m.NewSQLWithValues("SELECT 1 AS " + m.QuoteIdentifier("order")).MustQueryRow(&order)
+	t.Int("quoted identifier", order, 1)
+}
+
+func testUpdateIfChanged(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	authors.NewSQLWithValues(authors.DropSchema()).MustExecute()
+	authors.NewSQLWithValues(authors.Schema()).MustExecute()
+	authors.Insert(authors.Changes(db.RawChanges{"Name": "foo"}))().MustExecute()
+	var rowsAffected int
+	authors.UpdateIfChanged(authors.Changes(db.RawChanges{"Name": "foo"}))("WHERE id = $1", 1).MustExecute(&rowsAffected)
+	t.Int("update if changed no-op", rowsAffected, 0)
+	authors.UpdateIfChanged(authors.Changes(db.RawChanges{"Name": "bar"}))("WHERE id = $1", 1).MustExecute(&rowsAffected)
+	t.Int("update if changed", rowsAffected, 1)
+	authors.UpdateIfChanged(authors.Changes(db.RawChanges{"DeletedAt": nil}))().MustExecute(&rowsAffected)
+	t.Int("update if changed null", rowsAffected, 0)
+}
+
+func testBatchInsertReturning(t test, conn db.DB) {
+	authors := db.NewModel(author{}, conn, logger.StandardLogger)
+	books := db.NewModel(book{}, conn, logger.StandardLogger)
+	for _, m := range []*db.Model{authors, books} {
+		m.NewSQLWithValues(m.DropSchema()).MustExecute()
+		m.NewSQLWithValues(m.Schema()).MustExecute()
+	}
+	authors.Insert(authors.Changes(db.RawChanges{"Name": "first"}))().MustExecute()
+	names := []string{"c", "a", "d", "b"}
+	rows := [][]db.Changes{}
+	for _, name := range names {
+		rows = append(rows, []db.Changes{authors.Changes(db.RawChanges{"Name": name})})
+	}
+	var ids []int
+	authors.BatchInsert(rows...)("RETURNING id").MustQuery(&ids)
+	t.String("batch insert returning ids", fmt.Sprint(ids), "[2 3 4 5]")
+	bookRows := [][]db.Changes{}
+	for _, id := range ids {
+		bookRows = append(bookRows, []db.Changes{books.Changes(db.RawChanges{"AuthorId": id})})
+	}
+	books.BatchInsert(bookRows...)().MustExecute()
+	var authorNames []string
+	books.Select("authors.name", "JOIN authors ON authors.id = books.author_id ORDER BY books.id").MustQuery(&authorNames)
+	t.String("batch insert returning order", strings.Join(authorNames, ""), strings.Join(names, ""))
+}
+
+func testSoftDelete(t test, conn db.DB) {
+	m := db.NewModel(account{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	m.Insert(m.Changes(db.RawChanges{
+		"Email":     "foo@example.com",
+		"DeletedAt": time.Now(),
+	}))().MustExecute()
+	m.Insert(m.Changes(db.RawChanges{
+		"Email": "bar@example.com",
+	}))().MustExecute()
+	active := m.SoftDelete()
+	t.Int("soft delete count", active.MustCount(), 1)
+	t.Int("soft delete count all", m.MustCount(), 2)
+	t.Bool("soft delete deleted email not taken", !active.MustExists("WHERE email = $1", "foo@example.com"))
+	t.Bool("soft delete active email taken", active.MustExists("WHERE email = $1", "bar@example.com"))
+	t.Bool("soft delete deleted email exists", m.MustExists("WHERE email = $1", "foo@example.com"))
+}
+
+func testPrepare(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	if _, ok := conn.(db.PrepareNamed); !ok {
+		t.Bool("prepare not supported", m.Prepare("foo", "SELECT 1") == db.ErrPrepareNotSupported)
+		return
+	}
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	m.Insert(m.Changes(db.RawChanges{"Name": "foo"}))().MustExecute()
+	m.Insert(m.Changes(db.RawChanges{"Name": "bar"}))().MustExecute()
+
+	if err := m.Prepare("furk_find_by_name", "SELECT id, name, deleted_at FROM authors WHERE name = $1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"foo", "bar", "foo"} {
+		var a author
+		m.Exec("furk_find_by_name", name).MustQuery(&a)
+		t.String("prepared query row", a.Name, name)
+	}
+	var authors []author
+	m.Exec("furk_find_by_name", "bar").MustQuery(&authors)
+	t.Int("prepared query", len(authors), 1)
+	var a author
+	t.Bool("prepared no rows", m.IsNoRows(m.Exec("furk_find_by_name", "baz").Query(&a)))
+	t.Bool("prepared invalid query", m.Prepare("furk_invalid", "SELECT foo FROM") != nil)
+	t.Bool("deallocate", m.Deallocate("furk_find_by_name") == nil)
+	t.Bool("deallocated", errors.Is(m.Exec("furk_find_by_name", "foo").Query(&authors), db.ErrPreparedNotFound))
+}
+
+func testAutoReturning(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	var a author
+	m.Insert(m.Changes(db.RawChanges{"Name": "foo"}))().MustQuery(&a)
+	t.Int("auto returning id", a.Id, 1)
+	t.String("auto returning name", a.Name, "foo")
+	var authors []author
+	m.BatchInsert(
+		[]db.Changes{m.Changes(db.RawChanges{"Name": "bar"})},
+		[]db.Changes{m.Changes(db.RawChanges{"Name": "baz"})},
+	)().MustQuery(&authors)
+	t.Int("auto returning authors", len(authors), 2)
+	t.Int("auto returning last id", authors[1].Id, 3)
+	r, ok := conn.(db.Returning)
+	t.Bool("supports returning", !ok || r.SupportsReturning())
+	m2 := db.NewModel(author{}, noReturningDB{conn}, logger.StandardLogger)
+	m2.Insert(m2.Changes(db.RawChanges{"Name": "lastval"}))().MustQuery(&a)
+	t.Int("lastval id", a.Id, 4)
+	t.String("lastval name", a.Name, "lastval")
+
+	// columns of the table are not in the order of the fields
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues("CREATE TABLE authors (deleted_at timestamptz, name text, id SERIAL PRIMARY KEY)").MustExecute()
+	m.Insert(m.Changes(db.RawChanges{"Name": "qux"}))("RETURNING *").MustQueryRowStruct(&a)
+	t.Int("query row struct id", a.Id, 1)
+	t.String("query row struct name", a.Name, "qux")
+}
+
+func testInsertTimeZone(t test, conn db.DB) {
+	m := db.NewModel(legacyEvent{}, conn, logger.StandardLogger, time.UTC)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	local := time.Date(2021, 1, 1, 3, 0, 0, 0, time.FixedZone("UTC+8", 8*60*60))
+	var id int
+	m.Insert(m.Changes(db.RawChanges{
+		"Date": local,
+	}))("RETURNING id").MustQueryRow(&id)
+	var text string
+	m.Select("date", "WHERE id = $1", id).MustQueryRow(&text)
+	t.String("insert time zone text", text, "31/12/2020")
+}
+
+func testPaginate(t test, conn db.DB) {
+	m := db.NewModel(legacyEvent{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+	for i := 1; i <= 5; i++ {
+		m.Insert(m.Changes(db.RawChanges{
+			"Date": time.Date(2021, 1, i, 0, 0, 0, 0, time.UTC),
+		}))().MustExecute()
+	}
+	var events []legacyEvent
+	count, pages, err := m.Paginate(&events, 2, 2, "WHERE id > $1 ORDER BY id DESC", 0)
+	t.Bool("paginate no error", err == nil)
+	t.Int("paginate count", count, 5)
+	t.Int("paginate pages", pages, 3)
+	t.Int("paginate rows", len(events), 2)
+	t.Int("paginate first id", events[0].Id, 3)
+}
+
+func testBoolAsInt(t test, conn db.DB) {
+	m := db.NewModel(legacyFlag{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	var f legacyFlag
+	m.Insert(m.Changes(db.RawChanges{
+		"Enabled": true,
+	}))().ReturningAll().MustQuery(&f)
+	t.Bool("bool as int enabled", f.Enabled)
+	var n int
+	m.Select("enabled", "WHERE id = $1", f.Id).MustQueryRow(&n)
+	t.Int("bool as int value", n, 1)
+	m.Update(m.Changes(db.RawChanges{
+		"Enabled": false,
+	}))("WHERE id = $1", f.Id).MustExecute()
+	m.Find("WHERE id = $1", f.Id).MustQuery(&f)
+	t.Bool("bool as int disabled", !f.Enabled)
+}
+
+func testComplexType(t test, conn db.DB) {
+	m := db.NewModel(shipment{}, conn, logger.StandardLogger)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	var s shipment
+	s.Address.City = "foo"
+	s.Tags = []string{"a", "b"}
+	m.Insert(m.Changes(db.RawChanges{
+		"Address": s.Address,
+		"Tags":    s.Tags,
+	}))().MustQuery(&s)
+	var got shipment
+	m.Find("WHERE id = $1", s.Id).MustQuery(&got)
+	t.String("complex type struct", got.Address.City, "foo")
+	t.String("complex type slice", fmt.Sprint(got.Tags), "[a b]")
+	var city string
+	m.Select("address->>'City'", "WHERE id = $1", s.Id).MustQueryRow(&city)
+	t.String("complex type jsonb", city, "foo")
+}
+
+func testQueryCache(t test, conn db.DB) {
+	m := db.NewModel(author{}, conn, logger.StandardLogger).SetQueryCache(time.Minute)
+	m.NewSQLWithValues(m.DropSchema()).MustExecute()
+	m.NewSQLWithValues(m.Schema()).MustExecute()
+
+	t.Int("query cache count", m.MustCount(), 0)
+	other := db.NewModel(author{}, conn)
+	other.Insert(other.Changes(db.RawChanges{"Name": "foo"}))().MustExecute()
+	t.Int("query cache stale count", m.MustCount(), 0)
+	m.Insert(m.Changes(db.RawChanges{"Name": "bar"}))().MustExecute()
+	t.Int("query cache invalidated count", m.MustCount(), 2)
 }
 
 func (t *test) Bool(name string, b bool) {
@@ -1,6 +1,12 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -34,8 +40,161 @@ type (
 		CreatedAt time.Time
 		UpdatedAt time.Time
 	}
+
+	address struct {
+		Street string
+		Zip    *int
+		Since  time.Time
+	}
+
+	shipment struct {
+		Id          int
+		Origin      address  `composite:"address"`
+		Destination *address `composite:"address"`
+		Comment     string
+	}
+
+	setting struct {
+		Id      int
+		Options map[string]string  `dataType:"hstore"`
+		Extra   map[string]*string `dataType:"hstore"`
+	}
+
+	legacyEvent struct {
+		Id       int
+		Date     time.Time  `timeLayout:"02/01/2006"`
+		Canceled *time.Time `timeLayout:"2006-01-02 15:04"`
+	}
+
+	legacyFlag struct {
+		Id      int
+		Enabled bool  `boolAsInt:""`
+		Hidden  *bool `boolAsInt:""`
+	}
+
+	invoice struct {
+		Id       int
+		TenantId int
+		Amount   int
+	}
+
+	author struct {
+		Id        int
+		Name      string
+		DeletedAt *time.Time
+	}
+
+	book struct {
+		Id        int
+		AuthorId  int
+		DeletedAt *time.Time
+	}
+
+	review struct {
+		Id      int
+		Writer  int        `references:"authors"`
+		Removed *time.Time `column:"deleted_at"`
+	}
+
+	ticket struct {
+		Id       int
+		Status   string `json:"status"`
+		Priority *int   `json:"priority"`
+	}
+
+	testLogger struct {
+		logs []string
+	}
+
+	testRow struct {
+		values []interface{}
+		err    error
+	}
+
+	testRows struct {
+		testRow
+		columns []string
+	}
+
+	// testDB returns the rows for every query
+	testDB struct {
+		rows    [][]interface{}
+		queries []string
+	}
+
+	// testTxDB begins the transaction
+	testTxDB struct {
+		testDB
+		tx *testTx
+	}
+
+	// testTx returns batch of the rows for every query
+	testTx struct {
+		rows    [][]interface{}
+		batch   int
+		queries []string
+		rowsErr error
+	}
+
+	// testCopyDB saves the rows to copy
+	testCopyDB struct {
+		testDB
+		tableName string
+		columns   []string
+		rows      [][]interface{}
+	}
+
+	// testQuoteDB quotes identifiers with backticks
+	testQuoteDB struct {
+		testDB
+	}
+
+	// testPrepareDB runs prepared statements on testDB
+	testPrepareDB struct {
+		testDB
+		statements map[string]string
+	}
+
+	// testTxConn is a connection which is a transaction
+	testTxConn struct {
+		testDB
+	}
+
+	// testNoReturningDB doesn't support RETURNING
+	testNoReturningDB struct {
+		testDB
+		tx Tx
+	}
+
+	// testLastInsertIdTx returns the id of the inserted row from the result
+	testLastInsertIdTx struct {
+		testTx
+	}
+
+	// testMetricsHook saves all observations
+	testMetricsHook struct {
+		observations []string
+	}
+
+	testRowsIterator struct {
+		rows [][]interface{}
+		row  int
+		err  error
+	}
+
+	testResult int64
+
+	testLastInsertIdResult int64
 )
 
+var errTestNoRows = errors.New("no rows")
+
+type testCodeError string
+
+func (e testCodeError) Error() string {
+	return "error " + string(e)
+}
+
 func TestModel(_t *testing.T) {
 	t := test{_t, 0}
 
@@ -109,13 +268,95 @@ func TestModel(_t *testing.T) {
 	}
 	t.String(f.Name, "Name")
 	t.String(m1.Find().String(), "SELECT id, name, password FROM admins")
+	t.String(m1.Find().OrderBy("Name").String(), "SELECT id, name, password FROM admins ORDER BY name")
+	t.String(m1.Find("WHERE id > $1", 1).OrderBy("name", Desc, NullsLast).OrderBy("Id", NullsFirst).String(),
+		"SELECT id, name, password FROM admins WHERE id > $1 ORDER BY name DESC NULLS LAST, id NULLS FIRST")
+	t.String(m1.Find().OrderBy("Name", "; DROP TABLE admins", Asc).String(), "SELECT id, name, password FROM admins ORDER BY name ASC")
+	t.String(m1.Find().OrderBy("bad").String(), "SELECT id, name, password FROM admins")
+	s1 := m1.Find("WHERE id > $1", 1).Limit(10).OrderBy("Id", Desc).Offset(20).Limit(30)
+	t.String(s1.String(), "SELECT id, name, password FROM admins WHERE id > $1 ORDER BY id DESC LIMIT $2 OFFSET $3")
+	t.String(fmt.Sprint(s1.values), "[1 30 20]")
+	t.String(m1.Find().Offset(5).String(), "SELECT id, name, password FROM admins OFFSET $1")
+	t.String(m1.Find("WHERE id > $1 LIMIT 10 OFFSET 5", 1).OrderBy("Id", Desc).String(),
+		"SELECT id, name, password FROM admins WHERE id > $1 ORDER BY id DESC LIMIT 10 OFFSET 5")
+	t.String(m1.Find("WHERE name IN (SELECT name FROM users LIMIT 1) FOR UPDATE").OrderBy("Id").String(),
+		"SELECT id, name, password FROM admins WHERE name IN (SELECT name FROM users LIMIT 1) ORDER BY id FOR UPDATE")
+	t.String(m1.Find().OrderByRaw("CASE name WHEN 'admin' THEN 0 ELSE 1 END").OrderBy("Id", Desc).OrderByRaw(" ").Limit(1).String(),
+		"SELECT id, name, password FROM admins ORDER BY CASE name WHEN 'admin' THEN 0 ELSE 1 END, id DESC LIMIT $1")
+	t.String(m1.Scoped(2).Find(Where{}.Eq("name", "foo")).Limit(0).String(),
+		"SELECT id, name, password FROM admins WHERE admins.tenant_id = $2 AND (name = $1) LIMIT $3")
+	w := Where{}.Eq("name", "foo").AnyEq("id", []int{1, 2})
+	t.String(m1.Find(w).String(), "SELECT id, name, password FROM admins WHERE name = $1 AND id = ANY($2)")
+	t.String(fmt.Sprint(m1.Find(w).values), "[foo [1 2]]")
+	t.String(m1.Select("COUNT(*)", w.Any("name", "LIKE", []string{"a%"}), "extra").String(),
+		"SELECT COUNT(*) FROM admins WHERE name = $1 AND id = ANY($2) AND name LIKE ANY($3)")
+	t.String(fmt.Sprint(m1.Select("COUNT(*)", w.Any("name", "LIKE", []string{"a%"}), "extra").values), "[foo [1 2] [a%] extra]")
+	w = Where{}.Matches("name", "^a").IMatches("password", "x$").SimilarTo("name", "%(b|d)%")
+	t.String(m1.Find(w).String(), "SELECT id, name, password FROM admins WHERE name ~ $1 AND password ~* $2 AND name SIMILAR TO $3")
+	t.String(fmt.Sprint(m1.Find(w).values), "[^a x$ %(b|d)%]")
+	w = Where{}.Eq("name", "foo").Exists("SELECT 1 FROM users WHERE users.id = admins.id AND users.phone = $1", "1").
+		NotExists("SELECT 1 FROM users WHERE users.id = admins.id AND users.name IN ($1, $2)", "a", "b")
+	t.String(m1.Find(w).String(), "SELECT id, name, password FROM admins WHERE name = $1 AND "+
+		"EXISTS (SELECT 1 FROM users WHERE users.id = admins.id AND users.phone = $2) AND "+
+		"NOT EXISTS (SELECT 1 FROM users WHERE users.id = admins.id AND users.name IN ($3, $4))")
+	t.String(fmt.Sprint(m1.Find(w).values), "[foo 1 a b]")
+	t.String(m1.Delete(Where{}).String(), "DELETE FROM admins")
 	t.String(m1.Delete().String(), "DELETE FROM admins")
 	t.String(m1.Delete("WHERE id = $1", 1).String(),
 		"DELETE FROM admins WHERE id = $1")
+	t.String(m1.DeleteUsing("users", "WHERE admins.id = users.id AND users.name = $1", "foo").String(),
+		"DELETE FROM admins USING users WHERE admins.id = users.id AND users.name = $1")
+	t.String(m1.DeleteUsing("users", Where{}.Eq("users.name", "foo")).String(),
+		"DELETE FROM admins USING users WHERE users.name = $1")
 	t.String(m1.Insert(c)().String(), "INSERT INTO admins (name) VALUES ($1)")
+	t.String(m1.Insert(m1.Changes(RawChanges{"Id": Default}), c, m1.Changes(RawChanges{"Password": "x"}))().String(),
+		"INSERT INTO admins (id, name, password) VALUES (DEFAULT, $1, $2)")
+	t.String(m1.Insert(m1.Changes(RawChanges{"Name": Default}), c)().String(), "INSERT INTO admins (name) VALUES ($1)")
+	t.String(m1.Insert(c, m1.Changes(RawChanges{"Name": Raw("lower('FOO')")}))().String(),
+		"INSERT INTO admins (name) VALUES (lower('FOO'))")
+	t.String(m1.Upsert([]string{"Id"}, m1.Changes(RawChanges{"Id": 1}), c)().String(),
+		"INSERT INTO admins (id, name) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name")
+	t.String(m1.Upsert([]string{"id"}, c)("WHERE admins.id > $1 RETURNING id", 1).String(),
+		"INSERT INTO admins (name) VALUES ($2) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name WHERE admins.id > $1 RETURNING id")
+	t.String(m1.UpsertPartial([]string{"Id", "Password"}, "name IS NOT NULL", c)().String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT (id, password) WHERE name IS NOT NULL DO UPDATE SET name = EXCLUDED.name")
+	t.String(m1.InsertOnConstraint("admins_name_key", c)("RETURNING id").String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT ON CONSTRAINT admins_name_key DO UPDATE SET name = EXCLUDED.name RETURNING id")
+	t.String(m1.Upsert([]string{"Name"}, c)().String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT (name) DO NOTHING")
+	t.String(m1.Upsert([]string{"Name"}, c)("RETURNING id").String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id")
+	t.Nil(m1.Upsert([]string{"Name"}, c)("WHERE admins.id > $1 RETURNING id", 1).err, ErrWhereWithoutUpdate)
+	t.Nil(m1.Upsert([]string{"Id"}, c)("WHERE admins.id > $1 RETURNING id", 1).err, nil)
+	t.String(m1.Scoped(1).Upsert([]string{"Id"}, c)("WHERE admins.id > $1", 2).String(),
+		"INSERT INTO admins (name, tenant_id) VALUES ($2, $3) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name, "+
+			"tenant_id = EXCLUDED.tenant_id WHERE admins.tenant_id = $4 AND (admins.id > $1)")
+	t.String(m1.InsertDoNothing([]string{"Id"}, c)("RETURNING id").String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT (id) DO NOTHING RETURNING id")
+	t.String(m1.InsertDoNothing(nil, c)().String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT DO NOTHING")
+	t.String(m1.BatchInsert([]Changes{c}, []Changes{m1.Changes(RawChanges{"Name": Raw("'bar'")})})("RETURNING id").String(),
+		"INSERT INTO admins (name) VALUES ($1), ('bar') RETURNING id")
+	t.String(m1.BatchInsert([]Changes{c}, []Changes{c, m1.Changes(RawChanges{"Password": "x"})})().String(),
+		"INSERT INTO admins (name, password) VALUES ($1, DEFAULT), ($2, $3)")
+	t.String(m1.BatchUpsert([]string{"Id"}, []Changes{m1.Changes(RawChanges{"Id": 1})}, []Changes{m1.Changes(RawChanges{"Id": 2})})(
+		"RETURNING id, (xmax = 0) AS inserted").String(),
+		"INSERT INTO admins (id) VALUES ($1), ($2) ON CONFLICT (id) DO NOTHING RETURNING id, (xmax = 0) AS inserted")
+	t.String(m1.Insert(c)().ReturningAll().String(), "INSERT INTO admins (name) VALUES ($1) RETURNING id, name, password")
+	t.String(m1.Delete("WHERE id = $1", 1).ReturningAll().String(), "DELETE FROM admins WHERE id = $1 RETURNING id, name, password")
 	t.String(m1.Update(c)().String(), "UPDATE admins SET name = $1")
 	t.String(m1.Update(c)("WHERE id = $1", 1).String(),
 		"UPDATE admins SET name = $2 WHERE id = $1")
+	t.String(m1.UpdateFrom("users", c)("WHERE admins.id = users.id AND users.phone = $1", "1").String(),
+		"UPDATE admins SET name = $2 FROM users WHERE admins.id = users.id AND users.phone = $1")
+	t.String(m1.UpdateFrom("(VALUES ($1::int)) AS v (id)", c)("WHERE admins.id = v.id", 1).String(),
+		"UPDATE admins SET name = $2 FROM (VALUES ($1::int)) AS v (id) WHERE admins.id = v.id")
+	updateFrom := m1.UpdateFrom("users", c)
+	updateFrom("WHERE admins.id = users.id")
+	t.String(updateFrom("WHERE admins.id = users.id").String(),
+		"UPDATE admins SET name = $1 FROM users WHERE admins.id = users.id")
+	t.String(m1.Update(c)(Where{}.All("id", "<>", []int{1})).String(),
+		"UPDATE admins SET name = $2 WHERE id <> ALL($1)")
 
 	m2 := NewModel(category{})
 	t.String(m2.tableName, "categories")
@@ -126,6 +367,8 @@ func TestModel(_t *testing.T) {
 	})
 	t.String(m2.Insert(m2c)().String(), "INSERT INTO categories (meta) VALUES ($1)")
 	t.String(m2.Insert(m2c)().values[0].(string), `{"picture":"https://hello/world"}`)
+	t.String(m2.Upsert([]string{"Id"}, m2c)().String(),
+		"INSERT INTO categories (meta) VALUES ($1) ON CONFLICT (id) DO UPDATE SET meta = COALESCE(categories.meta, '{}'::jsonb) || EXCLUDED.meta")
 	t.String(m2.Update(m2c)().String(), "UPDATE categories SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $1)")
 	t.String(m2.Update(m2c)().values[0].(string), `"https://hello/world"`)
 	t.String(m2.Update(m2c)("WHERE id = $1", 1).String(),
@@ -140,6 +383,27 @@ func TestModel(_t *testing.T) {
 	})
 	t.String(m2.Insert(m2c2)().String(), "INSERT INTO categories (meta) VALUES ($1)")
 	t.String(m2.Insert(m2c2)().values[0].(string), `{"names":[{"key":"en_US","value":"Category"}]}`)
+	t.String(m2.Find().String(), "SELECT id, created_at, updated_at, meta FROM categories")
+	t.String(m2.Update(m2.Changes(RawChanges{"Id": 1}))().ReturningAll().String(),
+		"UPDATE categories SET id = $1 RETURNING id, created_at, updated_at, meta")
+	t.String(m2.FindExcept([]string{"meta"}, "WHERE id = $1", 1).String(), "SELECT id, created_at, updated_at FROM categories WHERE id = $1")
+	t.String(m2.FindExcept([]string{"other"}).String(), "SELECT id, created_at, updated_at, meta FROM categories")
+	whole := m2.JsonbWhole("meta", map[string]string{"picture": "https://hello/world"})
+	t.String(m2.Update(whole)("WHERE id = $1", 1).String(), "UPDATE categories SET meta = $2 WHERE id = $1")
+	t.String(m2.Update(whole)().values[0].(string), `{"picture":"https://hello/world"}`)
+	t.String(m2.Insert(whole)().String(), "INSERT INTO categories (meta) VALUES ($1)")
+	t.Int(len(m2.JsonbWhole("picture", "foo")), 0)
+	t.Int(len(m2.MustAssign(&category{}, whole)), 1)
+	for i := 0; i < 10; i++ {
+		t.String(m2.Insert(m2c, m2c2)().values[0].(string),
+			`{"names":[{"key":"en_US","value":"Category"}],"picture":"https://hello/world"}`)
+	}
+	mt := NewModelTable("things")
+	t.String(mt.Insert(Changes{
+		Field{ColumnName: "b", Jsonb: "meta"}: 1,
+		Field{ColumnName: "a", Jsonb: "meta"}: "x",
+	})().values[0].(string), `{"a":"x","b":1}`)
+	t.Nil(mt.Insert(Changes{Field{ColumnName: "c", Jsonb: "meta"}: make(chan int)})().err != nil, true)
 	t.String(m2.Update(m2c2)().String(), "UPDATE categories SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{names}', $1)")
 	t.String(m2.Update(m2c2)().values[0].(string), `[{"key":"en_US","value":"Category"}]`)
 	t.String(m2.Insert(
@@ -156,8 +420,2571 @@ func TestModel(_t *testing.T) {
 	m3 := NewModel(user{})
 	t.String(m3.tableName, "users")
 	t.Int(len(m3.modelFields), 4)
+
+	legacy := map[string]string{"Id": "user_id", "Name": "username"}
+	m4 := NewModel(user{}, ColumnMapper(func(name string) string {
+		return legacy[name]
+	}))
+	t.String(m4.Find().String(), "SELECT user_id, username, password, phone FROM users")
+	t.String(m4.Insert(m4.Changes(RawChanges{"Name": "foo"}))().String(), "INSERT INTO users (username) VALUES ($1)")
+	t.String(NewModel(user{}).Find().String(), "SELECT id, name, password, phone FROM users")
+}
+
+func TestLogger(_t *testing.T) {
+	t := test{_t, 0}
+
+	l1 := &testLogger{}
+	l2 := &testLogger{}
+	m := NewModel(admin{}, l1)
+	m.Find().log("SELECT 1", nil)
+	t.Int(len(l1.logs), 1)
+	m.Find().WithLogger(l2).log("SELECT 2", nil)
+	t.Int(len(l1.logs), 1)
+	t.Int(len(l2.logs), 1)
+	t.String(l2.logs[0], "\x1b[96mSELECT 2\x1b[0m")
+	m.Find().Silent().log("SELECT 3", nil)
+	t.Int(len(l1.logs), 1)
+	t.Int(len(l2.logs), 1)
+	m.Find().log("SELECT 4", []interface{}{1})
+	t.Int(len(l1.logs), 2)
+	t.String(l1.logs[1], "\x1b[96mSELECT 4\x1b[0m [1]")
+}
+
+func TestFindExcept(_t *testing.T) {
+	t := test{_t, 0}
+
+	now := time.Now()
+	m := NewModel(category{}, &testDB{rows: [][]interface{}{{1, now, now}}})
+	c := category{Picture: "foo"}
+	t.Nil(m.FindExcept([]string{"meta"}, "WHERE id = $1", 1).Query(&c), nil)
+	t.Int(c.Id, 1)
+	t.String(c.Picture, "foo")
+	var cs []category
+	t.Nil(m.FindExcept([]string{"meta"}).Query(&cs), nil)
+	t.Int(len(cs), 1)
+	t.Int(len(cs[0].Names), 0)
+}
+
+func TestSelectJsonbKeys(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(category{}, &testDB{rows: [][]interface{}{{"foo.png", "it's"}, {"bar.png", ""}}})
+	t.String(m.SelectJsonbKeys("meta", "picture", "it's", `"`)("WHERE id > $1", 1).String(),
+		`SELECT meta->>'picture' AS "picture", meta->>'it''s' AS "it's", meta->>'"' AS """" FROM categories WHERE id > $1`)
+	var pictures []struct {
+		Picture string
+		Title   string `column:"it's"`
+	}
+	t.Nil(m.SelectJsonbKeys("meta", "picture", "it's")().Query(&pictures), nil)
+	t.Int(len(pictures), 2)
+	t.String(pictures[0].Picture, "foo.png")
+	t.String(pictures[0].Title, "it's")
+	t.String(pictures[1].Picture, "bar.png")
+}
+
+func TestAllowValues(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(ticket{})
+	p := m.Permit("Status", "Priority").AllowValues("Status", "new", "paid", "cancelled")
+	t.Int(len(m.Permit("Status").AllowValues("Invalid", 1).Filter(`{"status":"foo"}`)), 1)
+	c := p.Filter(`{"status":"paid","priority":2}`)
+	t.Int(len(c), 2)
+	t.String(fmt.Sprint(c[*m.FieldByName("Status")]), "paid")
+	c = p.Filter(`{"status":"refunded","priority":2}`)
+	t.Int(len(c), 1)
+	t.Nil(c[*m.FieldByName("Status")], nil)
+	c = p.Filter(`{"status":"new"}`, `{"status":"bad"}`)
+	t.String(fmt.Sprint(c[*m.FieldByName("Status")]), "new")
+	t.Int(len(p.Filter(ticket{Status: "cancelled"})), 2)
+	t.Int(len(p.Filter(ticket{Status: "New"})), 1)
+	t.Int(len(p.Filter(RawChanges{"status": 1})), 0)
+
+	p2 := p.AllowValues("Priority", 1, 2, int64(3))
+	t.Int(len(p.Filter(`{"priority":5}`)), 1)
+	t.Int(len(p2.Filter(`{"priority":3}`)), 1)
+	t.Int(len(p2.Filter(`{"priority":5}`)), 0)
+	t.Int(len(p2.Filter(`{"priority":null}`)), 0)
+	t.Int(len(p.AllowValues("Priority", nil, 1).Filter(`{"priority":null}`)), 1)
+	t.Int(len(p.AllowValues("Priority").Filter(`{"priority":1}`)), 0)
+}
+
+func TestStrictFilter(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(ticket{})
+	p := m.Permit("Status")
+	c := p.Filter(`{"status":"new","priority":1,"admin":true}`)
+	t.Int(len(c), 1)
+	c, err := p.TryFilter(`{"status":"new","priority":1}`, RawChanges{"admin": true})
+	t.Nil(err, nil)
+	t.Int(len(c), 1)
+	_, err = p.TryFilter(`{"status":`)
+	t.Nil(err == nil, false)
+
+	s := p.Strict()
+	t.Nil(p.strict, false)
+	c, err = s.TryFilter(`{"status":"new"}`, map[string]interface{}{"status": "paid"})
+	t.Nil(err, nil)
+	t.String(c[*m.FieldByName("Status")].(string), "paid")
+	c, err = s.TryFilter(`{"status":"new","priority":1}`, RawChanges{"admin": true}, ticket{Priority: new(int)})
+	t.Nil(errors.Is(err, ErrUnpermittedFields), true)
+	t.String(err.Error(), "unpermitted fields: admin, priority")
+	t.Int(len(c), 1)
+	c = s.Filter(`{"status":"new","priority":1}`)
+	t.Int(len(c), 1)
+}
+
+func TestFilterWithMeta(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(ticket{})
+	p := m.Permit("Status", "Priority").AllowValues("Status", "new", "paid")
+	c, present, ignored := p.FilterWithMeta(`{"status":"new","priority":"high","admin":true}`, RawChanges{"id": 1})
+	t.Int(len(c), 1)
+	t.String(fmt.Sprint(present), "[status]")
+	t.String(fmt.Sprint(ignored), "[admin id priority]")
+	c, present, ignored = p.FilterWithMeta(`{"status":"refunded"}`, RawChanges{"status": "paid", "priority": nil})
+	t.Int(len(c), 2)
+	t.String(fmt.Sprint(present), "[priority status]")
+	t.String(fmt.Sprint(ignored), "[]")
+	_, present, ignored = p.FilterWithMeta(ticket{Status: "bad"}, `{`)
+	t.String(fmt.Sprint(present), "[priority]")
+	t.String(fmt.Sprint(ignored), "[status]")
+}
+
+func TestTransform(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(struct {
+		Email    string  `json:"email"`
+		Nickname *string `json:"nickname"`
+		Age      int     `json:"age"`
+	}{})
+	email, nickname, age := *m.FieldByName("Email"), *m.FieldByName("Nickname"), *m.FieldByName("Age")
+	p := m.Permit("Email", "Nickname", "Age").
+		Transform("Email", strings.ToLower).
+		Transform("Nickname", strings.TrimSpace).
+		Transform("Age", func(v interface{}) interface{} {
+			if age := v.(int); age < 0 {
+				return 0
+			}
+			return v
+		})
+	c := p.Filter(`{"email":"FOO@Example.COM","nickname":"  bar ","age":-1}`)
+	t.String(c[email].(string), "foo@example.com")
+	t.String(*c[nickname].(*string), "bar")
+	t.Int(c[age].(int), 0)
+	c = p.Filter(`{"nickname":null,"age":20}`)
+	t.Nil(c[nickname].(*string), (*string)(nil))
+	t.Int(c[age].(int), 20)
+	c = p.Filter(struct{ Email string }{" X@Y.COM"})
+	t.String(c[email].(string), " x@y.com")
+	c = m.Permit("Email").Filter(`{"email":"FOO"}`)
+	t.String(c[email].(string), "FOO")
+	c = p.Transform("Email", strings.TrimSpace).AllowValues("Email", "a@b.c").Filter(`{"email":" a@b.c "}`)
+	t.String(c[email].(string), "a@b.c")
+	c = p.Transform("Age", strings.TrimSpace).Filter(`{"age":1}`)
+	t.Int(c[age].(int), 1)
+
+	defer func() {
+		t.String(fmt.Sprint(recover()), "db: transformer must be a function with one argument and one return value")
+	}()
+	p.Transform("Email", "foo")
+}
+
+func TestComposite(_t *testing.T) {
+	t := test{_t, 0}
+
+	zip := 10001
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	from := address{Street: `1 "Main" St, \ A`, Zip: &zip, Since: since}
+	m := NewModel(shipment{})
+	t.String(m.Schema(), `CREATE TABLE shipments (
+	id SERIAL PRIMARY KEY,
+	origin address,
+	destination address,
+	comment text DEFAULT ''::text NOT NULL
+);
+`)
+	insert := m.Insert(m.Changes(RawChanges{"Origin": from}))()
+	t.String(insert.String(), "INSERT INTO shipments (origin) VALUES ($1)")
+	t.String(insert.values[0].(string), `("1 \"Main\" St, \\ A","10001","2020-01-02T03:04:05Z")`)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Destination": (*address)(nil)}))().values[0], nil)
+	update := m.Update(m.Changes(RawChanges{"Destination": &address{Street: "foo"}}))()
+	t.String(update.values[0].(string), `("foo",,"0001-01-01T00:00:00Z")`)
+
+	elements, err := parseComposite(`(,"",a b,"c ""d"" \\e",)`)
+	t.Nil(err, nil)
+	t.Int(len(elements), 5)
+	t.Nil(elements[0], (*string)(nil))
+	t.String(*elements[1], "")
+	t.String(*elements[2], "a b")
+	t.String(*elements[3], `c "d" \e`)
+	t.Nil(elements[4], (*string)(nil))
+	_, err = parseComposite(`("a)`)
+	t.Nil(err, ErrInvalidComposite)
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{
+		1,
+		[]byte(insert.values[0].(string)),
+		"(bar,,\"2020-01-02 11:04:05+08\")",
+		"x",
+	}}})
+	var s shipment
+	t.Nil(m.Find().Query(&s), nil)
+	t.String(s.Origin.Street, from.Street)
+	t.Int(*s.Origin.Zip, zip)
+	t.String(s.Origin.Since.UTC().String(), since.String())
+	t.String(s.Destination.Street, "bar")
+	t.Nil(s.Destination.Zip, (*int)(nil))
+	t.String(s.Destination.Since.UTC().String(), since.String())
+	t.String(s.Comment, "x")
+}
+
+func TestHstore(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(setting{})
+	t.String(m.Schema(), `CREATE TABLE settings (
+	id SERIAL PRIMARY KEY,
+	options hstore,
+	extra hstore
+);
+`)
+	foo := "foo"
+	options := m.Insert(m.Changes(RawChanges{
+		"Options": map[string]string{"b": `x "y" \z`, "a": "1"},
+	}))().values[0].(string)
+	t.String(options, `"a"=>"1", "b"=>"x \"y\" \\z"`)
+	extra := m.Insert(m.Changes(RawChanges{
+		"Extra": map[string]*string{"foo": &foo, "null": nil},
+	}))().values[0].(string)
+	t.String(extra, `"foo"=>"foo", "null"=>NULL`)
+	update := m.Update(m.Changes(RawChanges{"Options": map[string]string(nil)}))()
+	t.Nil(update.values[0], nil)
+
+	pairs, err := parseHstore(`"a"=>"1", b => NULL,"c,d"=>"=>"`)
+	t.Nil(err, nil)
+	t.Int(len(pairs), 3)
+	t.String(*pairs["a"], "1")
+	t.Nil(pairs["b"], (*string)(nil))
+	t.String(*pairs["c,d"], "=>")
+	_, err = parseHstore(`"a"=`)
+	t.Nil(err, ErrInvalidHstore)
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{
+		1,
+		[]byte(options),
+		extra,
+	}}})
+	var s setting
+	t.Nil(m.Find().Query(&s), nil)
+	t.Int(len(s.Options), 2)
+	t.String(s.Options["b"], `x "y" \z`)
+	t.String(*s.Extra["foo"], "foo")
+	t.Nil(s.Extra["null"], (*string)(nil))
+}
+
+func TestInsertAll(_t *testing.T) {
+	t := test{_t, 0}
+
+	ids, err := NewModel(admin{}).InsertAll([]Changes{{}})
+	t.Nil(err, ErrNoConnection)
+	conn := &testDB{}
+	m := NewModel(admin{}, conn)
+	ids, err = m.InsertAll(nil)
+	t.Nil(err, nil)
+	t.Int(len(ids), 0)
+	t.Int(len(conn.queries), 0)
+	ids, err = m.InsertAll([]Changes{m.Changes(RawChanges{"Name": "foo"})})
+	t.String(fmt.Sprint(err), "not supported")
+	t.Int(len(ids), 0)
+	ids, err = m.InsertAll([]Changes{
+		m.Changes(RawChanges{"Name": "foo", "Password": "bar"}),
+		m.Changes(RawChanges{"Name": "baz"}),
+	})
+	t.Nil(errors.Is(err, ErrMissingColumn), true)
+	t.String(fmt.Sprint(err), "missing column: password")
+	t.Int(len(ids), 0)
+	t.Int(len(conn.queries), 0)
+
+	tx := &testTx{}
+	table := NewModelTable("users", &testTxDB{tx: tx})
+	name, email := Field{Name: "name", ColumnName: "name"}, Field{Name: "email", ColumnName: "email"}
+	rows := make([]Changes, 40000) // 80000 parameters
+	for i := range rows {
+		rows[i] = Changes{name: "foo", email: "bar"}
+	}
+	_, err = table.InsertAll(rows)
+	t.Nil(err, nil)
+	t.Int(len(tx.queries), 3)
+	t.Int(strings.Count(tx.queries[0], "), ("), 32766)
+	t.Int(strings.Count(tx.queries[1], "), ("), 40000-32767-1)
+	t.String(tx.queries[2], "COMMIT")
+}
+
+func TestIdentityColumns(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(admin{})
+	t.String(m.Schema(), `CREATE TABLE admins (
+	id SERIAL PRIMARY KEY,
+	name text DEFAULT ''::text NOT NULL,
+	password text DEFAULT ''::text NOT NULL
+);
+`)
+	t.String(m.Insert(m.Changes(RawChanges{"Id": 1}))().String(), "INSERT INTO admins (id) VALUES ($1)")
+
+	UseIdentityColumns = true
+	defer func() {
+		UseIdentityColumns = false
+	}()
+	m = NewModel(admin{})
+	t.String(m.Schema(), `CREATE TABLE admins (
+	id bigint GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	name text DEFAULT ''::text NOT NULL,
+	password text DEFAULT ''::text NOT NULL
+);
+`)
+	c := m.Changes(RawChanges{"Id": 1, "Name": "foo"})
+	t.String(m.Insert(c)().String(), "INSERT INTO admins (name) VALUES ($1)")
+	t.String(m.Update(c)().String(), "UPDATE admins SET name = $1")
+	t.String(m.Upsert([]string{"Id"}, c)().String(),
+		"INSERT INTO admins (name) VALUES ($1) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name")
+}
+
+func TestUniqueConstraints(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(struct {
+		__TABLE_NAME__ string `members`
+
+		Id       int
+		TenantId int    `unique:"uq_tenant_email,uq_tenant_phone"`
+		Email    string `unique:"uq_tenant_email"`
+		Phone    string `unique:" uq_tenant_phone "`
+		Code     string `unique:"uq_code"`
+		Name     string `unique:""`
+		Nickname string `unique:"uq_code" jsonb:"meta"`
+	}{})
+	t.String(m.Schema(), `CREATE TABLE members (
+	id SERIAL PRIMARY KEY,
+	tenant_id bigint DEFAULT 0 NOT NULL,
+	email text DEFAULT ''::text NOT NULL,
+	phone text DEFAULT ''::text NOT NULL,
+	code text DEFAULT ''::text NOT NULL,
+	name text DEFAULT ''::text NOT NULL,
+	meta jsonb DEFAULT '{}'::jsonb NOT NULL,
+	CONSTRAINT uq_tenant_email UNIQUE (tenant_id, email),
+	CONSTRAINT uq_tenant_phone UNIQUE (tenant_id, phone),
+	CONSTRAINT uq_code UNIQUE (code)
+);
+`)
+}
+
+func TestSync(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1, false}, {3, true}}}
+	m := NewModel(admin{}, conn)
+	statuses, err := m.Sync([]Changes{
+		m.Changes(RawChanges{"Id": 1, "Name": "foo"}),
+		m.Changes(RawChanges{"Id": 2, "Name": "bar"}),
+		m.Changes(RawChanges{"Id": 3, "Name": "baz"}),
+	}, []string{"Id"}, []string{"name"})
+	t.Nil(err, nil)
+	t.String(strings.Join(statuses, ","), "updated,unchanged,inserted")
+	t.Int(len(conn.queries), 1)
+	t.Nil(strings.Contains(conn.queries[0], " ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name "+
+		"WHERE (admins.name) IS DISTINCT FROM (EXCLUDED.name) RETURNING admins.id, (xmax = 0)"), true)
+
+	hook := &testMetricsHook{}
+	statuses, err = m.SetOptions(hook).Sync([]Changes{m.Changes(RawChanges{"Id": 1, "Name": "foo"})}, []string{"Id"}, []string{})
+	t.Nil(err, nil)
+	t.Nil(strings.Contains(conn.queries[1], " ON CONFLICT (id) DO NOTHING RETURNING "), true)
+	t.String(strings.Join(hook.observations, ","), "admins INSERT <nil>")
+	statuses, err = m.Sync(nil, []string{"Id"}, nil)
+	t.Int(len(statuses), 0)
+	t.Int(len(conn.queries), 2)
+
+	type event struct {
+		Day     time.Time
+		Enabled *bool
+		Name    string
+	}
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	day := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	conn = &testDB{rows: [][]interface{}{{day.In(loc), &yes, true}}}
+	e := NewModel(event{}, conn)
+	statuses, err = e.Sync([]Changes{
+		e.Changes(RawChanges{"Day": day, "Enabled": &no, "Name": "foo"}),
+		e.Changes(RawChanges{"Day": day, "Enabled": &yes, "Name": "bar"}),
+	}, []string{"Day", "Enabled"}, []string{"Name"})
+	t.Nil(err, nil)
+	t.String(strings.Join(statuses, ","), "unchanged,inserted")
+}
+
+func TestInsertTimeZone(_t *testing.T) {
+	t := test{_t, 0}
+
+	type event struct {
+		Id        int
+		StartsAt  time.Time
+		EndsAt    *time.Time
+		Day       time.Time `timeLayout:"2006-01-02 15:04"`
+		CreatedAt time.Time `jsonb:"meta"`
+	}
+	loc := time.FixedZone("UTC+8", 8*60*60)
+	local := time.Date(2021, 1, 2, 3, 4, 5, 0, loc)
+	m := NewModel(event{})
+	t.Nil(m.Insert(m.Changes(RawChanges{"StartsAt": local}))().values[0].(time.Time).Location(), loc)
+	m = NewModel(event{}, time.UTC)
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"StartsAt": local}))().values), "[2021-01-01 19:04:05 +0000 UTC]")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"StartsAt": Cast(local, "timestamp")}))().values), "[2021-01-01 19:04:05 +0000 UTC]")
+	t.String(fmt.Sprint(m.Update(m.Changes(RawChanges{"EndsAt": &local}))().values), "[2021-01-01 19:04:05 +0000 UTC]")
+	t.Nil(local.Location(), loc)
+	t.Nil(m.Update(m.Changes(RawChanges{"EndsAt": (*time.Time)(nil)}))().values[0], (*time.Time)(nil))
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Day": local}))().values), "[2021-01-01 19:04]")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"CreatedAt": local}))().values), `[{"created_at":"2021-01-01T19:04:05Z"}]`)
+	t.String(fmt.Sprint(m.Update(m.Changes(RawChanges{"CreatedAt": local}))().values), `["2021-01-01T19:04:05Z"]`)
+	t.String(fmt.Sprint(m.SetInsertTimeZone(nil).Insert(m.Changes(RawChanges{"Day": local}))().values), "[2021-01-02 03:04]")
+}
+
+func TestTimeLayout(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(legacyEvent{})
+	t.String(m.Schema(), `CREATE TABLE legacy_events (
+	id SERIAL PRIMARY KEY,
+	date text DEFAULT ''::text NOT NULL,
+	canceled text DEFAULT ''::text
+);
+`)
+	date := time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)
+	t.String(m.Insert(m.Changes(RawChanges{"Date": date}))().values[0].(string), "31/12/2021")
+	t.String(m.Update(m.Changes(RawChanges{"Canceled": &date}))().values[0].(string), "2021-12-31 00:00")
+	t.Nil(m.Update(m.Changes(RawChanges{"Canceled": (*time.Time)(nil)}))().values[0], nil)
+	t.String(m.Update(m.Changes(RawChanges{"Date": "raw"}))().values[0].(string), "raw")
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, []byte("31/12/2021"), "2021-12-31 09:30"}}})
+	var e legacyEvent
+	t.Nil(m.Find().Query(&e), nil)
+	t.String(e.Date.String(), date.String())
+	t.String(e.Canceled.String(), date.Add(9*time.Hour+30*time.Minute).String())
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, "bad", nil}}})
+	t.Nil(m.Find().Query(&e) != nil, true)
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, "01/01/2022", ""}}})
+	t.Nil(m.Find().Query(&e), nil)
+	t.Nil(e.Canceled, (*time.Time)(nil))
+}
+
+func TestBoolAsInt(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(legacyFlag{})
+	t.String(m.Schema(), `CREATE TABLE legacy_flags (
+	id SERIAL PRIMARY KEY,
+	enabled smallint DEFAULT 0 NOT NULL,
+	hidden smallint DEFAULT 0
+);
+`)
+	yes := true
+	t.Nil(m.Insert(m.Changes(RawChanges{"Enabled": true}))().values[0], 1)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Enabled": false}))().values[0], 0)
+	t.Nil(m.Update(m.Changes(RawChanges{"Hidden": &yes}))().values[0], 1)
+	t.Nil(m.Update(m.Changes(RawChanges{"Hidden": (*bool)(nil)}))().values[0], nil)
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, int64(1), int16(0)}}})
+	var f legacyFlag
+	t.Nil(m.Find().Query(&f), nil)
+	t.Nil(f.Enabled, true)
+	t.Nil(*f.Hidden, false)
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, []byte("0"), nil}}})
+	t.Nil(m.Find().Query(&f), nil)
+	t.Nil(f.Enabled, false)
+	t.Nil(f.Hidden, (*bool)(nil))
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{1, "yes", nil}}})
+	t.Nil(m.Find().Query(&f) != nil, true)
+}
+
+func TestTableNameField(_t *testing.T) {
+	t := test{_t, 0}
+
+	type named struct {
+		__TABLE_NAME__ string `people`
+	}
+	type person struct {
+		named
+		Id int
+	}
+	type personPtr struct {
+		*named
+		Id int
+	}
+	type noName struct {
+		Id int
+	}
+	type badName struct {
+		__TABLE_NAME__ int
+		Id             int
+	}
+
+	conn := &testDB{rows: [][]interface{}{{1}}}
+	var p person
+	t.Nil(NewModel(person{}, conn).Find().Query(&p), nil)
+	t.String(p.__TABLE_NAME__, "people")
+	t.Int(p.Id, 1)
+	var pp personPtr
+	t.Nil(NewModel(personPtr{}, conn).Find().Query(&pp), nil)
+	t.Nil(pp.named, (*named)(nil))
+	t.Int(pp.Id, 1)
+	pp = personPtr{named: &named{}}
+	t.Nil(NewModel(personPtr{}, conn).Find().Query(&pp), nil)
+	t.String(pp.__TABLE_NAME__, "people")
+	var n noName
+	t.Nil(NewModel(noName{}, conn).Find().Query(&n), nil)
+	t.Int(n.Id, 1)
+	var b badName
+	t.Nil(NewModel(badName{}, conn).Find().Query(&b), nil)
+	t.Int(b.__TABLE_NAME__, 0)
+	t.Int(b.Id, 1)
+}
+
+func TestHooks(_t *testing.T) {
+	t := test{_t, 0}
+
+	defer func() {
+		beforeInsertHooks, beforeUpdateHooks = nil, nil
+	}()
+	errHook := errors.New("hook error")
+	calls := []string{}
+	OnBeforeInsert(func(m *Model, c Changes) error {
+		calls = append(calls, "insert 1 "+m.TableName())
+		for k, v := range m.Changes(RawChanges{"Password": "x"}) {
+			c[k] = v
+		}
+		return nil
+	})
+	OnBeforeInsert(func(m *Model, c Changes) error {
+		calls = append(calls, "insert 2 "+m.TableName())
+		for field := range c {
+			if field.Name == "Name" && c[field] == "bad" {
+				return errHook
+			}
+		}
+		return nil
+	})
+	OnBeforeUpdate(func(m *Model, c Changes) error {
+		calls = append(calls, "update "+m.TableName())
+		return errHook
+	})
+
+	conn := &testDB{}
+	m := NewModel(admin{}, conn)
+	c := m.Changes(RawChanges{"Name": "foo"})
+	t.String(m.Insert(m.Changes(RawChanges{"Password": "y"}))().String(), "INSERT INTO admins (password) VALUES ($1)")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Password": "y"}))().values), "[x]")
+	t.String(strings.Join(calls, ","), "insert 1 admins,insert 2 admins,insert 1 admins,insert 2 admins")
+	calls = nil
+	t.Int(len(m.BatchInsert([]Changes{c}, []Changes{c})().values), 4)
+	t.Int(len(calls), 4)
+	t.Nil(m.Insert(c)().Execute(), nil)
+	t.Int(len(conn.queries), 1)
+	bad := m.Changes(RawChanges{"Name": "bad"})
+	t.Nil(m.Insert(bad)().Execute(), errHook)
+	t.Nil(m.BatchInsert([]Changes{c}, []Changes{bad})().Execute(), errHook)
+	t.Nil(m.Upsert([]string{"Id"}, bad)().Execute(), errHook)
+	_, err := m.Sync([]Changes{bad}, []string{"Id"}, nil)
+	t.Nil(err, errHook)
+	t.Int(len(conn.queries), 1)
+	calls = nil
+	t.Nil(m.Update(c)().Execute(), errHook)
+	var ids []int
+	t.Nil(m.UpdateFrom("users", c)().Query(&ids), errHook)
+	t.String(strings.Join(calls, ","), "update admins,update admins")
+	t.Int(len(conn.queries), 1)
+}
+
+func TestScopedAlias(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	m := NewModel(struct {
+		__TABLE_NAME__ string `invoices AS i`
+
+		Id       int
+		TenantId int
+		Amount   int
+	}{}, conn)
+	s := m.Scoped(7)
+	t.String(s.Find("WHERE id = $1", 1).String(), "SELECT id, tenant_id, amount FROM invoices AS i WHERE i.tenant_id = $2 AND (id = $1)")
+	t.String(s.SoftDelete().Delete().String(), "DELETE FROM invoices AS i WHERE i.deleted_at IS NULL AND i.tenant_id = $1")
+	t.String(s.UpdateIfChanged(m.Changes(RawChanges{"Amount": 1}))().String(),
+		"UPDATE invoices AS i SET amount = $2 WHERE (i.amount IS DISTINCT FROM $2) AND (i.tenant_id = $1)")
+	_, err := s.Sync([]Changes{m.Changes(RawChanges{"Id": 1, "Amount": 1})}, []string{"Id"}, []string{"Amount"})
+	t.Nil(err, nil)
+	t.Int(len(conn.queries), 1)
+	t.Nil(strings.Contains(conn.queries[0], " ON CONFLICT (id) DO UPDATE SET amount = EXCLUDED.amount "+
+		"WHERE (i.amount) IS DISTINCT FROM (EXCLUDED.amount) AND i.tenant_id = $4 RETURNING i.id, (xmax = 0)"), true)
+}
+
+func TestScoped(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	m := NewModel(invoice{}, conn)
+	s := m.Scoped(7)
+	t.String(m.Find().String(), "SELECT id, tenant_id, amount FROM invoices")
+	t.String(s.Find().String(), "SELECT id, tenant_id, amount FROM invoices WHERE invoices.tenant_id = $1")
+	t.String(s.Find("WHERE id = $1 OR amount > $2 ORDER BY id LIMIT 1", 1, 2).String(),
+		"SELECT id, tenant_id, amount FROM invoices WHERE invoices.tenant_id = $3 AND (id = $1 OR amount > $2) ORDER BY id LIMIT 1")
+	t.String(fmt.Sprint(s.Find("WHERE id = $1", 1).values), "[1 7]")
+	t.String(s.Find("ORDER BY id").String(), "SELECT id, tenant_id, amount FROM invoices WHERE invoices.tenant_id = $1 ORDER BY id")
+	t.String(s.Find(Where{}.Eq("amount", 3)).String(),
+		"SELECT id, tenant_id, amount FROM invoices WHERE invoices.tenant_id = $2 AND (amount = $1)")
+	t.String(s.Select("COUNT(*)", "WHERE name = 'order by' AND id IN (SELECT id FROM x WHERE y = 1 LIMIT 1)").String(),
+		"SELECT COUNT(*) FROM invoices WHERE invoices.tenant_id = $1 AND (name = 'order by' AND id IN (SELECT id FROM x WHERE y = 1 LIMIT 1))")
+	t.String(m.ScopedBy("Amount", 1).Delete("RETURNING id").String(), "DELETE FROM invoices WHERE invoices.amount = $1 RETURNING id")
+	t.String(s.DeleteUsing("users", "WHERE invoices.id = users.id").String(),
+		"DELETE FROM invoices USING users WHERE invoices.tenant_id = $1 AND (invoices.id = users.id)")
+	t.String(m.Find().String(), "SELECT id, tenant_id, amount FROM invoices")
+
+	amount := m.Changes(RawChanges{"Amount": 1})
+	t.String(s.Insert(amount)("RETURNING id").String(), "INSERT INTO invoices (amount, tenant_id) VALUES ($1, $2) RETURNING id")
+	t.String(fmt.Sprint(s.Insert(amount)().values), "[1 7]")
+	t.String(fmt.Sprint(s.Insert(amount, m.Changes(RawChanges{"TenantId": 7}))().values), "[1 7]")
+	t.Nil(s.Insert(m.Changes(RawChanges{"TenantId": 8}))().Execute(), ErrOutOfScope)
+	tenantId, tenantIdField := 7, *m.FieldByName("TenantId")
+	t.Nil(s.Insert(Changes{tenantIdField: &tenantId})().err, nil)
+	t.Nil(s.Insert(Changes{tenantIdField: int64(7)})().err, nil)
+	t.Nil(s.Insert(Changes{tenantIdField: "7"})().err, ErrOutOfScope)
+	t.Nil(m.ScopedBy("TenantId", &tenantId).Insert(Changes{tenantIdField: 7})().err, nil)
+	t.Nil(m.Scoped(1).Insert(Changes{tenantIdField: "1"})().err, ErrOutOfScope)
+	t.String(fmt.Sprint(s.BatchInsert([]Changes{amount}, []Changes{amount})().values), "[1 7 1 7]")
+	t.String(s.Upsert([]string{"Id"}, amount)("RETURNING id").String(),
+		"INSERT INTO invoices (amount, tenant_id) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET amount = EXCLUDED.amount, tenant_id = EXCLUDED.tenant_id WHERE invoices.tenant_id = $3 RETURNING id")
+	t.String(s.Upsert([]string{"Amount", "TenantId"}, amount)().String(),
+		"INSERT INTO invoices (amount, tenant_id) VALUES ($1, $2) ON CONFLICT (amount, tenant_id) DO NOTHING")
+
+	t.String(s.Update(amount)("WHERE id = $1", 2).String(),
+		"UPDATE invoices SET amount = $3 WHERE invoices.tenant_id = $2 AND (id = $1)")
+	t.String(fmt.Sprint(s.Update(amount)("WHERE id = $1", 2).values), "[2 7 1]")
+	t.String(s.Update(amount)().String(), "UPDATE invoices SET amount = $2 WHERE invoices.tenant_id = $1")
+	t.Nil(s.Update(m.Changes(RawChanges{"TenantId": 8}))().Execute(), ErrOutOfScope)
+	t.Nil(s.Update(m.Changes(RawChanges{"TenantId": 7}))().Execute(), nil)
+	t.Nil(s.Delete().Execute(), nil)
+	t.String(strings.Join(conn.queries, "; "),
+		"UPDATE invoices SET tenant_id = $2 WHERE invoices.tenant_id = $1; DELETE FROM invoices WHERE invoices.tenant_id = $1")
+
+	t.String(addCondition("", "a = 1"), "WHERE a = 1")
+	t.String(addCondition("where\tb = 2", "a = 1"), "WHERE a = 1 AND (b = 2)")
+	t.String(addCondition("WHERE b = 2 GROUP BY c HAVING count(*) > 1", "a = 1"), "WHERE a = 1 AND (b = 2) GROUP BY c HAVING count(*) > 1")
+	t.String(addCondition("FOR UPDATE", "a = 1"), "WHERE a = 1 FOR UPDATE")
+	t.String(addCondition("WHERE b = '(' ORDER  BY b", "a = 1"), "WHERE a = 1 AND (b = '(') ORDER  BY b")
+	t.String(addCondition("WHERE forward = 1 OR \"limit\" = 2", "a = 1"), "WHERE a = 1 AND (forward = 1 OR \"limit\" = 2)")
+}
+
+func TestCascadeSoftDelete(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	authors := NewModel(author{}, conn)
+	books := NewModel(book{}, conn)
+	reviews := NewModel(review{}, conn)
+	t.String(authors.CascadeSoftDelete(books, reviews)("WHERE name = $1", "foo").String(),
+		"WITH parents AS (UPDATE authors SET deleted_at = now() WHERE authors.deleted_at IS NULL AND (name = $1) RETURNING authors.id), "+
+			"children1 AS (UPDATE books SET deleted_at = now() WHERE author_id IN (SELECT id FROM parents) AND deleted_at IS NULL), "+
+			"children2 AS (UPDATE reviews SET deleted_at = now() WHERE writer IN (SELECT id FROM parents) AND deleted_at IS NULL) "+
+			"SELECT id FROM parents")
+	t.String(authors.Scoped(1).CascadeSoftDelete()().String(),
+		"WITH parents AS (UPDATE authors SET deleted_at = now() WHERE authors.deleted_at IS NULL AND (authors.tenant_id = $1) RETURNING authors.id) "+
+			"SELECT id FROM parents")
+	t.String(NewModel(&author{}).CascadeSoftDelete(books)().String(),
+		"WITH parents AS (UPDATE authors SET deleted_at = now() WHERE authors.deleted_at IS NULL RETURNING authors.id), "+
+			"children1 AS (UPDATE books SET deleted_at = now() WHERE author_id IN (SELECT id FROM parents) AND deleted_at IS NULL) "+
+			"SELECT id FROM parents")
+	t.Nil(books.CascadeSoftDelete(authors)().Execute(), ErrNoForeignKey)
+	t.Nil(NewModelTable("authors", conn).CascadeSoftDelete(books)().Execute(), ErrNoForeignKey)
+	t.Int(len(conn.queries), 0)
+	t.Nil(NewModelTable("authors", conn).CascadeSoftDelete(reviews)().Execute(), nil)
+	t.Int(len(conn.queries), 1)
+}
+
+func TestOnly(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(invoice{})
+	o := m.Only()
+	t.String(m.Find().String(), "SELECT id, tenant_id, amount FROM invoices")
+	t.String(o.Find("WHERE id = $1", 1).String(), "SELECT id, tenant_id, amount FROM ONLY invoices WHERE id = $1")
+	t.String(o.Select("COUNT(*)").String(), "SELECT COUNT(*) FROM ONLY invoices")
+	t.String(o.Find().TableSample(Bernoulli, 10).String(), "SELECT id, tenant_id, amount FROM ONLY invoices TABLESAMPLE BERNOULLI (10)")
+	t.String(o.Scoped(1).Update(m.Changes(RawChanges{"Amount": 2}))().String(),
+		"UPDATE ONLY invoices SET amount = $2 WHERE invoices.tenant_id = $1")
+	t.String(o.Delete("WHERE id = $1", 1).String(), "DELETE FROM ONLY invoices WHERE id = $1")
+	t.String(o.DeleteUsing("users", "WHERE invoices.id = users.id").String(),
+		"DELETE FROM ONLY invoices USING users WHERE invoices.id = users.id")
+	t.String(o.Insert(m.Changes(RawChanges{"Amount": 2}))().String(), "INSERT INTO invoices (amount) VALUES ($1)")
+}
+
+func TestSoftDelete(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	authors := NewModel(author{}, conn)
+	s := authors.SoftDelete()
+	t.String(authors.Find().String(), "SELECT id, name, deleted_at FROM authors")
+	t.String(s.Find().String(), "SELECT id, name, deleted_at FROM authors WHERE authors.deleted_at IS NULL")
+	t.String(s.Select("COUNT(*)", "WHERE name = $1", "foo").String(),
+		"SELECT COUNT(*) FROM authors WHERE authors.deleted_at IS NULL AND (name = $1)")
+	t.String(s.Scoped(7).Select("1 AS one", "WHERE name = $1 LIMIT 1", "foo").String(),
+		"SELECT 1 AS one FROM authors WHERE authors.deleted_at IS NULL AND authors.tenant_id = $2 AND (name = $1) LIMIT 1")
+	t.String(NewModel(review{}, conn).SoftDelete().Delete().String(), "DELETE FROM reviews WHERE reviews.deleted_at IS NULL")
+
+	conn.rows = [][]interface{}{{1}}
+	t.Nil(s.MustExists("WHERE name = $1", "foo"), true)
+	t.Int(s.MustCount(), 1)
+	t.String(strings.Join(conn.queries, "; "),
+		"SELECT 1 AS one FROM authors WHERE authors.deleted_at IS NULL AND (name = $1); "+
+			"SELECT COUNT(*) FROM authors WHERE authors.deleted_at IS NULL")
+	t.String(s.CascadeSoftDelete()().String(),
+		"WITH parents AS (UPDATE authors SET deleted_at = now() WHERE authors.deleted_at IS NULL RETURNING authors.id) "+
+			"SELECT id FROM parents")
+
+	books := NewModel(book{}, conn)
+	t.String(s.Join("authors.name, books.id", books.SoftDelete(), "books.author_id = authors.id")("WHERE authors.name = $1", "foo").String(),
+		"SELECT authors.name, books.id FROM authors JOIN books ON (books.author_id = authors.id) AND books.deleted_at IS NULL "+
+			"WHERE authors.deleted_at IS NULL AND (authors.name = $1)")
+	t.String(authors.LeftJoin("authors.name, books.id", books, "books.author_id = authors.id")().String(),
+		"SELECT authors.name, books.id FROM authors LEFT JOIN books ON books.author_id = authors.id")
+	t.String(authors.LeftJoin("authors.name, reviews.id", NewModel(review{}).SoftDelete(), "reviews.writer = authors.id")().String(),
+		"SELECT authors.name, reviews.id FROM authors LEFT JOIN reviews ON (reviews.writer = authors.id) AND reviews.deleted_at IS NULL")
+	join := authors.Join("authors.name, b.id", NewModelTable("public.books AS b").SoftDelete(), "b.author_id = authors.id")
+	join()
+	t.String(join().String(),
+		"SELECT authors.name, b.id FROM authors JOIN public.books AS b ON (b.author_id = authors.id) AND b.deleted_at IS NULL")
+	t.String(authors.Join("authors.name", NewModelTable("public.books").Only().SoftDelete(), "books.author_id = authors.id")().String(),
+		"SELECT authors.name FROM authors JOIN ONLY public.books ON (books.author_id = authors.id) AND public.books.deleted_at IS NULL")
+}
+
+func TestJSON(_t *testing.T) {
+	t := test{_t, 0}
+
+	defer func(marshal func(interface{}) ([]byte, error), unmarshal func([]byte, interface{}) error) {
+		JSONMarshal, JSONUnmarshal = marshal, unmarshal
+	}(JSONMarshal, JSONUnmarshal)
+	var marshaled, unmarshaled int
+	JSONMarshal = func(v interface{}) ([]byte, error) {
+		marshaled += 1
+		return []byte(`{"custom":true}`), nil
+	}
+	JSONUnmarshal = func(data []byte, v interface{}) error {
+		unmarshaled += 1
+		return json.Unmarshal([]byte(`{"name":"custom"}`), v)
+	}
+
+	m := NewModel(category{})
+	t.String(m.Insert(m.Changes(RawChanges{"Picture": "foo"}))().values[0].(string), `{"picture":{"custom":true}}`)
+	t.Int(marshaled, 1)
+	m1 := NewModel(admin{})
+	c := m1.Permit("Name").Filter(`{"name":"foo"}`)
+	t.Int(unmarshaled, 1)
+	for f, v := range c {
+		t.String(f.Name+"="+v.(string), "Name=custom")
+	}
+	c = m1.Permit("Name").Filter(strings.NewReader(`{"name":"foo"}`))
+	t.Int(unmarshaled, 2)
+	for f, v := range c {
+		t.String(f.Name+"="+v.(string), "Name=custom")
+	}
+}
+
+func TestScanStruct(_t *testing.T) {
+	t := test{_t, 0}
+
+	var group struct {
+		Count  int
+		Status string
+		name   string
+	}
+	s := NewModel(admin{}).Select("status, COUNT(*) AS count", "GROUP BY status")
+	err := s.scan(reflect.ValueOf(&group).Elem(), testRows{testRow{values: []interface{}{"new", 2}}, []string{"status", "count"}})
+	t.Nil(err, nil)
+	t.String(group.Status, "new")
+	t.Int(group.Count, 2)
+	err = s.scan(reflect.ValueOf(&group).Elem(), testRow{values: []interface{}{3, "paid", "foo"}})
+	t.Nil(err, nil)
+	t.String(group.Status, "paid")
+	t.Int(group.Count, 3)
+	t.String(group.name, "foo")
+	// fields in order if any column has no field
+	err = s.scan(reflect.ValueOf(&group).Elem(), testRows{testRow{values: []interface{}{4, "new", "bar"}}, []string{"a", "b", "c"}})
+	t.Nil(err, nil)
+	t.Int(group.Count, 4)
+	t.String(group.name, "bar")
+
+	var createdAt time.Time
+	now := time.Now()
+	err = s.scan(reflect.ValueOf(&createdAt).Elem(), testRow{values: []interface{}{now}})
+	t.Nil(err, nil)
+	t.String(createdAt.String(), now.String())
+}
+
+func TestFindOrPrimary(_t *testing.T) {
+	t := test{_t, 0}
+
+	replica := &testDB{}
+	primary := &testDB{rows: [][]interface{}{{1, "foo", "bar"}}}
+	m := NewModel(admin{}, replica)
+	var a admin
+	t.Nil(m.FindOrPrimary(primary, &a, "WHERE id = $1", 1), nil)
+	t.Int(a.Id, 1)
+	t.Int(len(replica.queries), 1)
+	t.Int(len(primary.queries), 1)
+	var admins []admin
+	t.Nil(m.FindOrPrimary(primary, &admins), nil)
+	t.Int(len(admins), 1)
+	t.Int(len(replica.queries), 2)
+	t.Int(len(primary.queries), 2)
+
+	replica.rows = [][]interface{}{{2, "foo", "bar"}}
+	t.Nil(m.FindOrPrimary(primary, &a, "WHERE id = $1", 2), nil)
+	t.Int(a.Id, 2)
+	t.Int(len(replica.queries), 3)
+	t.Int(len(primary.queries), 2)
+
+	replica.rows = nil
+	t.Nil(m.FindOrPrimary(primary, &admins), nil) // pre-populated slice
+	t.Int(len(admins), 2)
+	t.Int(len(replica.queries), 4)
+	t.Int(len(primary.queries), 3)
+
+	primary.rows = nil
+	replica.rows = nil
+	t.Nil(errors.Is(m.FindOrPrimary(primary, &a, "WHERE id = $1", 3), errTestNoRows), true)
+}
+
+func TestQueryJSON(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{`[{"id":1,"name":"foo"}]`}}}
+	m := NewModel(admin{}, conn)
+	var b strings.Builder
+	t.Nil(m.Select("id, name", "WHERE id = $1 ORDER BY id", 1).QueryJSON(&b), nil)
+	t.String(b.String(), `[{"id":1,"name":"foo"}]`)
+	t.String(conn.queries[0], "WITH t AS (SELECT id, name FROM admins WHERE id = $1 ORDER BY id) SELECT COALESCE(json_agg(t), '[]')::text FROM t")
+	t.String(m.Select("id").String(), "SELECT id FROM admins")
+
+	b.Reset()
+	conn.rows = nil
+	t.Nil(errors.Is(m.Find().QueryJSON(&b), errTestNoRows), true)
+	t.String(b.String(), "")
+	t.Nil(NewModel(admin{}).Find().QueryJSON(&b), ErrNoConnection)
+}
+
+func TestStatementTimeout(_t *testing.T) {
+	t := test{_t, 0}
+
+	tx := &testTx{rows: [][]interface{}{{"a"}}, batch: 1}
+	m := NewModel(admin{}, &testTxDB{tx: tx})
+	var name string
+	t.Nil(m.Select("name").QueryRowInTransaction(&TxOptions{StatementTimeout: time.Microsecond}, &name), nil)
+	t.Nil(m.Select("name").QueryRowInTransaction(&TxOptions{StatementTimeout: 1500 * time.Microsecond}, &name), nil)
+	t.Nil(m.Select("name").QueryRowInTransaction(&TxOptions{StatementTimeout: time.Second}, &name), nil)
+	t.String(strings.Join(tx.queries, "; "), "SET LOCAL statement_timeout = 1; SELECT name FROM admins; COMMIT; "+
+		"SET LOCAL statement_timeout = 2; SELECT name FROM admins; COMMIT; "+
+		"SET LOCAL statement_timeout = 1000; SELECT name FROM admins; COMMIT")
+}
+
+func TestFetchSize(_t *testing.T) {
+	t := test{_t, 0}
+
+	tx := &testTx{rows: [][]interface{}{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}, batch: 2}
+	m := NewModel(admin{}, &testTxDB{tx: tx})
+	t.String(m.Select("name").FetchSize(2).String(), "SELECT name FROM admins")
+	cur, err := m.Select("name", "WHERE id > $1", 1).FetchSize(2).Cursor()
+	t.Nil(err, nil)
+	names := []string{}
+	for cur.Next() {
+		var name string
+		t.Nil(cur.Scan(&name), nil)
+		names = append(names, name)
+	}
+	t.Nil(cur.Err(), nil)
+	t.Nil(cur.Close(), nil)
+	t.String(strings.Join(names, ","), "a,b,c,d,e")
+	t.String(strings.Join(tx.queries, "; "), "DECLARE furk_fetch_cursor NO SCROLL CURSOR FOR SELECT name FROM admins WHERE id > $1; "+
+		"FETCH 2 FROM furk_fetch_cursor; FETCH 2 FROM furk_fetch_cursor; FETCH 2 FROM furk_fetch_cursor; COMMIT")
+
+	tx = &testTx{rows: [][]interface{}{{"a"}, {"b"}}, batch: 2}
+	cur, err = NewModel(admin{}, &testTxDB{tx: tx}).Select("name").FetchSize(2).Cursor()
+	t.Nil(err, nil)
+	for cur.Next() {
+	}
+	t.Nil(cur.Close(), nil)
+	t.Int(len(tx.queries), 4) // DECLARE, FETCH, FETCH (empty), COMMIT
+
+	errRows := errors.New("rows error")
+	tx = &testTx{rows: [][]interface{}{{"a"}}, batch: 2, rowsErr: errRows}
+	cur, err = NewModel(admin{}, &testTxDB{tx: tx}).Select("name").FetchSize(2).Cursor()
+	t.Nil(err, nil)
+	for cur.Next() {
+	}
+	t.Nil(errors.Is(cur.Close(), errRows), true)
+	t.String(tx.queries[len(tx.queries)-1], "ROLLBACK")
+
+	_, err = NewModel(admin{}, &testDB{}).Select("name").FetchSize(2).Cursor()
+	t.String(fmt.Sprint(err), "not supported")
+	cur, err = NewModel(admin{}, &testDB{rows: [][]interface{}{{"a"}}}).Select("name").FetchSize(0).Cursor()
+	t.Nil(err, nil)
+	t.Nil(cur.Close(), nil)
+}
+
+func TestEstimatedCount(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1000}}}
+	m := NewModel(admin{}, conn)
+	count, err := m.EstimatedCount()
+	t.Nil(err, nil)
+	t.Int(count, 1000)
+	t.Int(len(conn.queries), 1)
+	t.String(conn.queries[0], "SELECT (CASE WHEN c.reltuples < 0 THEN -1 WHEN c.relpages = 0 THEN c.reltuples "+
+		"ELSE c.reltuples / c.relpages * (pg_relation_size(c.oid) / current_setting('block_size')::int) END)::bigint "+
+		"FROM pg_class c WHERE c.oid = to_regclass($1)")
+
+	conn = &testDB{rows: [][]interface{}{{-1}}}
+	m.Scoped(1).SetConnection(conn).MustEstimatedCount()
+	t.Int(len(conn.queries), 2)
+	t.String(conn.queries[1], "SELECT COUNT(*) FROM admins")
+
+	conn = &testDB{rows: [][]interface{}{{0}}}
+	m.SetConnection(conn).MustEstimatedCount()
+	t.Int(len(conn.queries), 2) // never analyzed before PostgreSQL 14
+
+	_, err = NewModel(admin{}, &testDB{}).EstimatedCount()
+	t.Nil(errors.Is(err, errTestNoRows), true)
+}
+
+func TestAdvisoryLock(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{true}}}
+	t.Nil(AdvisoryLock(conn, 42), nil)
+	acquired, err := TryAdvisoryLock(conn, 42)
+	t.Nil(err, nil)
+	t.Nil(acquired, true)
+	t.Nil(AdvisoryUnlock(conn, 42), nil)
+	t.String(strings.Join(conn.queries, "; "),
+		"SELECT pg_advisory_lock($1); SELECT pg_try_advisory_lock($1); SELECT pg_advisory_unlock($1)")
+	conn.rows = [][]interface{}{{false}}
+	acquired, err = TryAdvisoryLock(conn, 42)
+	t.Nil(err, nil)
+	t.Nil(acquired, false)
+	t.Nil(AdvisoryUnlock(conn, 42), ErrAdvisoryLockNotHeld)
+	t.Nil(AdvisoryLock(nil, 42), ErrNoConnection)
+
+	tx := &testTx{}
+	called := false
+	t.Nil(WithAdvisoryLock(&testTxDB{tx: tx}, 42, func() error {
+		called = true
+		return nil
+	}), nil)
+	t.Nil(called, true)
+	t.String(strings.Join(tx.queries, "; "), "SELECT pg_advisory_xact_lock($1); COMMIT")
+	tx = &testTx{}
+	errFn := errors.New("fn error")
+	t.Nil(WithAdvisoryLock(&testTxDB{tx: tx}, 42, func() error {
+		return errFn
+	}), errFn)
+	t.String(strings.Join(tx.queries, "; "), "SELECT pg_advisory_xact_lock($1); ROLLBACK")
+	t.Nil(WithAdvisoryLock(nil, 42, nil), ErrNoConnection)
 }
 
+func TestCast(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(category{})
+	m2 := NewModel(admin{})
+	name := m2.Changes(RawChanges{"Name": Cast("foo", "citext")})
+	t.String(m2.Insert(name)().String(), "INSERT INTO admins (name) VALUES ($1::citext)")
+	t.String(fmt.Sprint(m2.Insert(name)().values), "[foo]")
+	t.String(m2.BatchInsert([]Changes{name}, []Changes{m2.Changes(RawChanges{"Name": "bar"})})().String(),
+		"INSERT INTO admins (name) VALUES ($1::citext), ($2)")
+	t.String(m2.Upsert([]string{"Id"}, name)().String(),
+		"INSERT INTO admins (name) VALUES ($1::citext) ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name")
+	t.String(m2.Update(name)("WHERE id = $1", 1).String(), "UPDATE admins SET name = $2::citext WHERE id = $1")
+	t.String(fmt.Sprint(m2.Update(name)("WHERE id = $1", 1).values), "[1 foo]")
+	u := m2.Update(m2.Changes(RawChanges{"Name": "bar"}), name)("WHERE id = $1", 1)
+	t.String(u.String(), "UPDATE admins SET name = $2::citext WHERE id = $1")
+	t.String(fmt.Sprint(u.values), "[1 foo]")
+	u = m2.Update(name, m2.Changes(RawChanges{"Name": "bar"}))()
+	t.String(u.String(), "UPDATE admins SET name = $1")
+	t.String(fmt.Sprint(u.values), "[bar]")
+
+	picture := m.Changes(RawChanges{"Picture": Cast("foo", "text")})
+	t.String(fmt.Sprint(m.Insert(picture)().values), `[{"picture":"foo"}]`)
+	t.String(fmt.Sprint(m.Update(picture)().values), `["foo"]`)
+
+	s := NewModel(setting{})
+	t.String(fmt.Sprint(s.Insert(s.Changes(RawChanges{"Options": Cast(map[string]string{"a": "1"}, "hstore")}))().values),
+		`["a"=>"1"]`)
+}
+
+func TestLatestPerGroup(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1, 7, 10}, {3, 8, 20}}}
+	m := NewModel(invoice{}, conn)
+	t.String(m.LatestPerGroup("TenantId", "id")().String(),
+		"SELECT DISTINCT ON (tenant_id) id, tenant_id, amount FROM invoices ORDER BY tenant_id, id DESC NULLS LAST")
+	t.String(m.LatestPerGroup("tenant_id", "Id")("WHERE amount > $1", 5).OrderBy("Amount").String(),
+		"SELECT DISTINCT ON (tenant_id) id, tenant_id, amount FROM invoices WHERE amount > $1 ORDER BY tenant_id, id DESC NULLS LAST, amount")
+	var invoices []invoice
+	t.Nil(m.LatestPerGroup("TenantId", "Id")().Query(&invoices), nil)
+	t.Int(len(invoices), 2)
+	t.Int(invoices[1].Id, 3)
+	t.Int(invoices[1].TenantId, 8)
+	t.Int(len(conn.queries), 1)
+	t.Nil(m.LatestPerGroup("Foo", "Id")().Query(&invoices), ErrUnknownColumn)
+	t.Nil(m.LatestPerGroup("TenantId", "Foo")().Query(&invoices), ErrUnknownColumn)
+	t.Int(len(conn.queries), 1)
+}
+
+func TestNull(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(category{})
+	m2 := NewModel(admin{})
+	u := m2.Update(m2.Changes(RawChanges{"Name": Null}))("WHERE id = $1", 1)
+	t.String(u.String(), "UPDATE admins SET name = NULL WHERE id = $1")
+	t.String(fmt.Sprint(u.values), "[1]")
+	u = m2.Update(m2.Changes(RawChanges{"Name": Null}), m2.Changes(RawChanges{"Password": "x"}))()
+	t.String(u.String(), "UPDATE admins SET name = NULL, password = $1")
+	t.String(fmt.Sprint(u.values), "[x]")
+	u = m2.Update(m2.Changes(RawChanges{"Name": "foo"}), m2.Changes(RawChanges{"Name": Null}))()
+	t.String(u.String(), "UPDATE admins SET name = NULL")
+	t.Int(len(u.values), 0)
+	t.String(m2.Update(m2.Changes(RawChanges{"Name": Default}))().String(), "UPDATE admins SET name = DEFAULT")
+	t.String(m2.Insert(m2.Changes(RawChanges{"Name": Null}))().String(), "INSERT INTO admins (name) VALUES (NULL)")
+
+	u = m.Update(m.Changes(RawChanges{"Picture": Null}))()
+	t.String(u.String(), "UPDATE categories SET meta = COALESCE(meta, '{}'::jsonb) - 'picture'")
+	t.Int(len(u.values), 0)
+	u = m.Update(m.Changes(RawChanges{"Picture": Null}), m.Changes(RawChanges{"CreatedAt": Null}))()
+	t.String(u.String(), "UPDATE categories SET created_at = NULL, meta = COALESCE(meta, '{}'::jsonb) - 'picture'")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Picture": Null}))().values), "[{}]")
+}
+
+func TestBulkJsonbUpdate(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1}, {2}, {3}}}
+	m := NewModel(category{}, conn)
+	u := m.Update(m.Changes(RawChanges{"Picture": "x.png"}))("WHERE id = ANY($1) AND created_at < $2", Array([]int{1, 2, 3}), "2021-01-01")
+	t.String(u.String(), "UPDATE categories SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $3) WHERE id = ANY($1) AND created_at < $2")
+	t.Int(len(u.values), 3)
+	t.String(fmt.Sprint(u.values[2]), `"x.png"`)
+	var rowsAffected int
+	t.Nil(u.Execute(&rowsAffected), nil)
+	t.Int(rowsAffected, 3)
+	u = m.Update(m.Changes(RawChanges{"Picture": "x.png", "Names": []map[string]string{{"en": "foo"}}}))("WHERE id > $1", 1)
+	t.Int(len(u.values), 3)
+	t.Nil(strings.Contains(u.String(), "jsonb_set(jsonb_set(COALESCE(meta, '{}'::jsonb), '{"), true)
+	t.Nil(strings.Count(u.String(), "$2")+strings.Count(u.String(), "$3"), 2)
+}
+
+func TestSnapshot(_t *testing.T) {
+	t := test{_t, 0}
+
+	tx := &testTx{rows: [][]interface{}{{2}}}
+	m := NewModel(admin{}, &testTxDB{tx: tx})
+	var count, max int
+	t.Nil(m.Snapshot(func(ctx context.Context, tx Tx) error {
+		if err := m.Select("COUNT(*)").QueryRowTx(tx, ctx, &count); err != nil {
+			return err
+		}
+		return m.Select("MAX(id)").QueryRowTx(tx, ctx, &max)
+	}), nil)
+	t.Int(count, 2)
+	t.Int(max, 2)
+	t.String(strings.Join(tx.queries, "; "), "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY; "+
+		"SELECT COUNT(*) FROM admins; SELECT MAX(id) FROM admins; ROLLBACK")
+
+	tx = &testTx{}
+	m = NewModel(admin{}, &testTxDB{tx: tx})
+	err := m.Snapshot(func(ctx context.Context, tx Tx) error {
+		return m.Select("COUNT(*)").QueryRowTx(tx, ctx, &count)
+	})
+	t.Nil(errors.Is(err, errTestNoRows), true)
+	t.String(strings.Join(tx.queries, "; "), "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY; "+
+		"SELECT COUNT(*) FROM admins; ROLLBACK")
+	t.String(fmt.Sprint(NewModel(admin{}, &testDB{}).Snapshot(nil)), "not supported")
+	t.Nil(NewModel(admin{}).Snapshot(nil), ErrNoConnection)
+}
+
+func TestPaginate(_t *testing.T) {
+	t := test{_t, 0}
+
+	type item struct {
+		Id int
+	}
+	tx := &testTx{rows: [][]interface{}{{5}, {3}, {4}}, batch: 2}
+	m := NewModel(item{}, &testTxDB{tx: tx})
+	items := []item{{Id: 100}}
+	count, pages, err := m.Paginate(&items, 2, 2, "WHERE id > $1 ORDER BY id DESC", 1)
+	t.Nil(err, nil)
+	t.Int(count, 5)
+	t.Int(pages, 3)
+	t.Int(len(items), 2)
+	t.String(strings.Join(tx.queries, "; "), "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY; "+
+		"SELECT COUNT(*) FROM items WHERE id > $1; "+
+		"SELECT id FROM items WHERE id > $1 ORDER BY id DESC LIMIT $2 OFFSET $3; ROLLBACK")
+
+	tx = &testTx{rows: [][]interface{}{{5}}}
+	m = NewModel(item{}, &testTxDB{tx: tx})
+	count, pages, err = m.Paginate(&items, 4, 2, "")
+	t.Nil(err, nil)
+	t.Int(count, 5)
+	t.Int(pages, 3)
+	t.Int(len(items), 0)
+	t.String(strings.Join(tx.queries, "; "), "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY; "+
+		"SELECT COUNT(*) FROM items; ROLLBACK")
+
+	_, _, err = m.Paginate(&item{}, 1, 2, "")
+	t.Nil(err, ErrInvalidPaginateTarget)
+	_, _, err = m.Paginate(items, 1, 2, "")
+	t.Nil(err, ErrInvalidPaginateTarget)
+
+	t.String(withoutOrderBy("WHERE a = 1 ORDER BY id FOR UPDATE"), "WHERE a = 1 FOR UPDATE")
+	t.String(withoutOrderBy("WHERE (SELECT 1 ORDER BY 1) = 1"), "WHERE (SELECT 1 ORDER BY 1) = 1")
+}
+
+func TestValues(_t *testing.T) {
+	t := test{_t, 0}
+
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	v := Values([]string{"id", "status", "paid", "paid_at", "amount"}, [][]interface{}{
+		{1, "paid", true, now, 1.5},
+		{2, Cast("new", "order_status"), false, nil},
+	})
+	t.String(v.String(), "(VALUES ($1::bigint, $2::text, $3::boolean, $4::timestamptz, $5::double precision), "+
+		"($6, $7::order_status, $8, $9, NULL)) AS v (id, status, paid, paid_at, amount)")
+	t.String(fmt.Sprint(v.Values()), "[1 paid true "+now.String()+" 1.5 2 new false <nil>]")
+	v = Values([]string{"id"}, [][]interface{}{{nil}, {3}}).As("ids").Offset(1)
+	t.String(v.String(), "(VALUES ($2), ($3)) AS ids (id)")
+	t.String(fmt.Sprint(v.Values()), "[<nil> 3]")
+}
+
+func TestCopyFrom(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testCopyDB{}
+	m := NewModel(category{}, conn)
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	count, err := m.CopyFrom([]string{"CreatedAt", "meta"}, []category{
+		{Id: 1, Picture: "a.png", CreatedAt: now},
+		{Id: 2, Names: []map[string]string{{"en": "b"}}},
+	})
+	t.Nil(err, nil)
+	t.Int(int(count), 2)
+	t.String(conn.tableName, "categories")
+	t.String(strings.Join(conn.columns, ","), "created_at,meta")
+	t.Int(len(conn.rows), 2)
+	t.String(fmt.Sprint(conn.rows[0]), `[2021-01-01 00:00:00 +0000 UTC {"names":null,"picture":"a.png"}]`)
+	t.String(fmt.Sprint(conn.rows[1][1]), `{"names":[{"en":"b"}],"picture":""}`)
+
+	count, err = NewModel(shipment{}, conn).CopyFrom([]string{"origin", "Comment"}, &shipment{
+		Origin:  address{Street: "Main St"},
+		Comment: "foo",
+	}, shipment{Comment: "bar"})
+	t.Nil(err, nil)
+	t.Int(int(count), 2)
+	t.String(strings.Join(conn.columns, ","), "origin,comment")
+	t.String(fmt.Sprint(conn.rows[0]), `[("Main St",,"0001-01-01T00:00:00Z") foo]`)
+
+	m2 := NewModel(struct {
+		__TABLE_NAME__ string `secrets`
+
+		Id     int
+		secret string `column:"secret"`
+	}{}, conn)
+	_, err = m2.CopyFrom([]string{"secret"}, struct {
+		__TABLE_NAME__ string
+		Id             int
+		secret         string
+	}{secret: "x"})
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(conn.rows), "[[x]]")
+
+	_, err = m.CopyFrom([]string{"Foo"})
+	t.Nil(err, ErrUnknownColumn)
+	_, err = m.CopyFrom([]string{"Id"}, 1)
+	t.Nil(err, ErrTypeAssertionFailed)
+	_, err = NewModel(category{}, &testDB{}).CopyFrom([]string{"Id"})
+	t.Nil(err, ErrCopyNotSupported)
+	_, err = NewModel(category{}).CopyFrom([]string{"Id"})
+	t.Nil(err, ErrNoConnection)
+}
+
+func TestLeftJoinLateral(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModelTable("orders")
+	items := NewModelTable("items")
+	top := items.Select("name", "WHERE items.order_id = orders.id AND price > $1 ORDER BY price DESC LIMIT $2", 10, 3)
+	s := m.LeftJoinLateral("orders.id, top.name", top, "top")("WHERE orders.status = $1 AND orders.id > $2", "paid", 1)
+	t.String(s.String(), "SELECT orders.id, top.name FROM orders LEFT JOIN LATERAL "+
+		"(SELECT name FROM items WHERE items.order_id = orders.id AND price > $1 ORDER BY price DESC LIMIT $2) top ON true "+
+		"WHERE orders.status = $3 AND orders.id > $4")
+	t.String(fmt.Sprint(s.values), "[10 3 paid 1]")
+	t.String(fmt.Sprint(top.values), "[10 3]")
+	s = m.LeftJoinLateral("*", NewModel(admin{}).Select("name").OrderBy("Name"), "i")()
+	t.String(s.String(), "SELECT * FROM orders LEFT JOIN LATERAL (SELECT name FROM admins ORDER BY name) i ON true")
+	t.Int(len(s.values), 0)
+	s = m.Scoped(1).LeftJoinLateral("*", items.Select("name", "WHERE id = ANY($1)", Array([]int{1})), "i")("WHERE id > $1", 2)
+	t.String(s.String(), "SELECT * FROM orders LEFT JOIN LATERAL (SELECT name FROM items WHERE id = ANY($1)) i ON true "+
+		"WHERE orders.tenant_id = $3 AND (id > $2)")
+	t.String(fmt.Sprint(s.values), "[[1] 2 1]")
+	s = m.LeftJoinLateral("*", items.Select("name", "WHERE id > $1", 1).Limit(2), "i")("WHERE id > $1", 3)
+	t.String(s.String(), "SELECT * FROM orders LEFT JOIN LATERAL (SELECT name FROM items WHERE id > $1 LIMIT $2) i ON true WHERE id > $3")
+	t.String(fmt.Sprint(s.values), "[1 2 3]")
+	t.Nil(m.LeftJoinLateral("*", items.Select("name").withError(ErrNoConnection), "i")().err, ErrNoConnection)
+}
+
+func TestSeedSQL(_t *testing.T) {
+	t := test{_t, 0}
+
+	deletedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	m := NewModel(author{})
+	sql, err := m.SeedSQL(author{Id: 1, Name: "it's"}, &author{Id: 2, Name: "Bob", DeletedAt: &deletedAt}, 1)
+	t.Nil(err, nil)
+	t.String(sql,
+		"INSERT INTO authors (id, name, deleted_at) VALUES ('1', 'it''s', NULL);\n"+
+			"INSERT INTO authors (id, name, deleted_at) VALUES ('2', 'Bob', '2021-01-02T03:04:05Z');\n")
+	sql, err = NewModel(category{}).SeedSQL(category{Id: 1, Picture: "a'b.png"})
+	t.Nil(err, nil)
+	t.String(sql,
+		"INSERT INTO categories (id, created_at, updated_at, meta) VALUES ('1', '0001-01-01T00:00:00Z', "+
+			`'0001-01-01T00:00:00Z', '{"names":null,"picture":"a''b.png"}');`+"\n")
+	sql, err = NewModel(shipment{}).SeedSQL(shipment{Id: 1, Origin: address{Street: "Main St"}})
+	t.Nil(err, nil)
+	t.String(sql,
+		`INSERT INTO shipments (id, origin, destination, comment) VALUES ('1', '("Main St",,"0001-01-01T00:00:00Z")', NULL, '');`+"\n")
+	sql, err = m.SeedSQL()
+	t.Nil(err, nil)
+	t.String(sql, "")
+
+	type file struct {
+		Id       int
+		Data     []byte
+		Tags     []string
+		Matrix   [][]int
+		Optional []*string
+	}
+	s := `it's "a" \`
+	sql, err = NewModel(file{}).SeedSQL(file{Id: 1, Data: []byte{1, 2, 255}, Tags: []string{"a b", s},
+		Matrix: [][]int{{1, 2}, {3, 4}}, Optional: []*string{nil, &s}})
+	t.Nil(err, nil)
+	t.String(sql, `INSERT INTO files (id, data, tags, matrix, optional) VALUES ('1', '\x0102ff', `+
+		`'{"a b","it''s \"a\" \\"}', '{{"1","2"},{"3","4"}}', '{NULL,"it''s \"a\" \\"}');`+"\n")
+	sql, err = NewModel(file{}).SeedSQL(file{Id: 2})
+	t.Nil(err, nil)
+	t.String(sql, "INSERT INTO files (id, data, tags, matrix, optional) VALUES ('2', NULL, NULL, NULL, NULL);\n")
+}
+
+func TestComplexType(_t *testing.T) {
+	t := test{_t, 0}
+
+	type address struct {
+		City string
+	}
+	type profile struct {
+		Id       int
+		Address  address
+		Previous *address
+		History  []address
+		Tags     []string
+		Scores   map[string]int
+		Raw      []byte
+		Birthday time.Time
+		Options  map[string]string `dataType:"hstore"`
+		Extra    []string          `jsonb:"meta"`
+	}
+	m := NewModel(profile{})
+	t.String(m.Schema(), `CREATE TABLE profiles (
+	id SERIAL PRIMARY KEY,
+	address jsonb,
+	previous jsonb,
+	history jsonb,
+	tags text DEFAULT ''::text NOT NULL,
+	scores jsonb,
+	raw text DEFAULT ''::text NOT NULL,
+	birthday timestamptz DEFAULT NOW() NOT NULL,
+	options hstore,
+	meta jsonb DEFAULT '{}'::jsonb NOT NULL
+);
+`)
+	s := m.Insert(m.Changes(RawChanges{
+		"Address": address{"foo"},
+		"History": []address{{"bar"}},
+		"Tags":    []string{"a", "b"},
+	}))()
+	t.String(s.String(), "INSERT INTO profiles (address, history, tags) VALUES ($1, $2, $3)")
+	t.String(fmt.Sprint(s.values), `[{"City":"foo"} [{"City":"bar"}] [a b]]`)
+
+	m.SetConnection(&testDB{rows: [][]interface{}{{
+		1, []byte(`{"City":"bar"}`), nil, `[{"City":"baz"}]`, []string{"c"}, `{"x":1}`, []byte("raw"), time.Time{}, nil, []byte(`{}`),
+	}}})
+	var p profile
+	t.Nil(m.Find().Query(&p), nil)
+	t.String(p.Address.City, "bar")
+	t.Nil(p.Previous, (*address)(nil))
+	t.String(fmt.Sprint(p.History), "[{baz}]")
+	t.String(fmt.Sprint(p.Tags), "[c]")
+	t.Int(p.Scores["x"], 1)
+	t.String(string(p.Raw), "raw")
+}
+
+func TestAggregate(_t *testing.T) {
+	t := test{_t, 0}
+
+	type item struct {
+		Name  string
+		Price int
+	}
+	var order struct {
+		Id       int
+		Items    []item `aggregate:""`
+		Customer *struct {
+			Name string
+		} `aggregate:""`
+	}
+	s := NewModelTable("orders").Select("orders.id, json_agg(items) AS items, NULL AS customer")
+	err := s.scan(reflect.ValueOf(&order).Elem(), testRows{testRow{values: []interface{}{
+		1, `[{"Name":"foo","Price":2},{"Name":"bar","Price":3}]`, nil,
+	}}, []string{"id", "items", "customer"}})
+	t.Nil(err, nil)
+	t.Int(order.Id, 1)
+	t.String(fmt.Sprint(order.Items), "[{foo 2} {bar 3}]")
+	t.Nil(order.Customer == nil, true)
+	err = s.scan(reflect.ValueOf(&order).Elem(), testRow{values: []interface{}{
+		2, []interface{}{map[string]interface{}{"Name": "baz"}}, []byte(`{"Name":"qux"}`),
+	}})
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(order.Items), "[{baz 0}]")
+	t.String(order.Customer.Name, "qux")
+	err = s.scan(reflect.ValueOf(&order).Elem(), testRow{values: []interface{}{3, "{", nil}})
+	t.Nil(err == nil, false)
+
+	type order2 struct {
+		Id    int
+		Items []item `aggregate:""`
+	}
+	m := NewModel(order2{})
+	t.String(m.Schema(), `CREATE TABLE order2s (
+	id SERIAL PRIMARY KEY,
+	items jsonb
+);
+`)
+	t.String(m.Insert(m.Changes(RawChanges{"Items": []item{{"foo", 1}}}))().String(),
+		"INSERT INTO order2s (items) VALUES ($1)")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Items": []item{{"foo", 1}}}))().values),
+		`[[{"Name":"foo","Price":1}]]`)
+	var o order2
+	err = m.NewSQLWithValues("").scan(reflect.ValueOf(&o).Elem(), testRow{values: []interface{}{1, `[{"Name":"a"}]`}})
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(o), "{1 [{a 0}]}")
+}
+
+func TestJsonbKey(_t *testing.T) {
+	t := test{_t, 0}
+
+	type profile struct {
+		Id        int
+		FirstName string `jsonb:"meta" jsonbKey:"firstName"`
+		LastName  string `jsonb:"meta" column:"surname" jsonbKey:"lastName"`
+	}
+	m := NewModel(profile{})
+	t.String(m.FieldByName("FirstName").ColumnName, "firstName")
+	t.String(m.FieldByName("LastName").ColumnName, "lastName")
+	t.String(m.FieldByName("LastName").JsonName, "LastName")
+	t.String(m.Update(m.Changes(RawChanges{"FirstName": "foo"}))().String(),
+		"UPDATE profiles SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{firstName}', $1)")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"FirstName": "foo", "LastName": "bar"}))().values),
+		`[{"firstName":"foo","lastName":"bar"}]`)
+	var p profile
+	err := m.Find().scan(reflect.ValueOf(&p).Elem(), testRow{values: []interface{}{1, []byte(`{"firstName":"a","lastName":"b"}`)}})
+	t.Nil(err, nil)
+	t.String(p.FirstName+" "+p.LastName, "a b")
+	t.String(m.SelectJsonbKeys("meta", "firstName")().String(), `SELECT meta->>'firstName' AS "firstName" FROM profiles`)
+
+	type plain struct {
+		Id        int
+		FirstName string `jsonbKey:"firstName"`
+	}
+	t.String(NewModel(plain{}).FieldByName("FirstName").ColumnName, "first_name")
+}
+
+func TestIsDirty(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(category{})
+	now := time.Now()
+	loaded := category{Id: 1, Picture: "a.png", CreatedAt: now}
+	current := loaded
+	current.CreatedAt = now.In(time.FixedZone("UTC+8", 8*3600))
+	dirty, columns := m.IsDirty(loaded, &current)
+	t.Nil(dirty, false)
+	t.Int(len(columns), 0)
+	current.Picture = "b.png"
+	current.UpdatedAt = now
+	dirty, columns = m.IsDirty(&loaded, current)
+	t.Nil(dirty, true)
+	t.String(fmt.Sprint(columns), "[updated_at meta]")
+	current = loaded
+	current.Names = []map[string]string{}
+	dirty, columns = m.IsDirty(loaded, current)
+	t.Nil(dirty, true)
+	t.String(fmt.Sprint(columns), "[meta]")
+
+	m2 := NewModel(ticket{})
+	one, another := 1, 1
+	dirty, _ = m2.IsDirty(ticket{Priority: &one}, ticket{Priority: &another})
+	t.Nil(dirty, false)
+	another = 2
+	dirty, columns = m2.IsDirty(ticket{Priority: &one}, ticket{Priority: &another})
+	t.Nil(dirty, true)
+	t.String(fmt.Sprint(columns), "[priority]")
+	_, columns = m2.IsDirty(ticket{Priority: &one}, ticket{Status: "new"})
+	t.String(fmt.Sprint(columns), "[status priority]")
+	dirty, _ = m2.IsDirty(ticket{}, 1)
+	t.Nil(dirty, false)
+
+	type event struct {
+		Id      int
+		Payload interface{} `dataType:"text"`
+	}
+	m3 := NewModel(event{})
+	dirty, _ = m3.IsDirty(event{}, event{})
+	t.Nil(dirty, false)
+	_, columns = m3.IsDirty(event{}, event{Payload: 1})
+	t.String(fmt.Sprint(columns), "[payload]")
+	_, columns = m3.IsDirty(event{Payload: now}, event{Payload: "now"})
+	t.String(fmt.Sprint(columns), "[payload]")
+	dirty, _ = m3.IsDirty(event{Payload: &one}, event{Payload: &another})
+	t.Nil(dirty, true)
+}
+
+func TestSave(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{int64(5)}}}
+	type note struct {
+		Id   int64
+		Body string `jsonb:"meta"`
+	}
+	m := NewModel(note{}, conn)
+	c := note{Body: "foo"}
+	t.Nil(m.Save(&c), nil)
+	t.Int(int(c.Id), 5)
+	t.String(conn.queries[0], "INSERT INTO notes (meta) VALUES ($1) RETURNING id")
+	c.Body = "bar"
+	t.Nil(m.Save(&c), nil)
+	t.String(conn.queries[1], "UPDATE notes SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{body}', $2) WHERE id = $1")
+	conn.rows = nil
+	t.Nil(m.Save(&c), errTestNoRows)
+	t.Nil(m.IsNoRows(m.Save(&c)), true)
+
+	t.Nil(m.Save(c), ErrMustBePointer)
+	t.Nil(m.Save(new(int)), ErrTypeAssertionFailed)
+	t.Nil(NewModel(struct{ Name string }{}, conn).Save(&struct{ Name string }{}), ErrNoPrimaryKey)
+	t.Nil(NewModel(note{}).Save(&c), ErrNoConnection)
+}
+
+func TestInsertStruct(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(invoice{}, &testDB{})
+	i := invoice{TenantId: 7, Amount: 100}
+	t.String(m.InsertStruct(i, "Amount")("RETURNING id").String(), "INSERT INTO invoices (amount) VALUES ($1) RETURNING id")
+	t.String(fmt.Sprint(m.InsertStruct(&i, "amount")().values), "[100]")
+	t.String(m.InsertStruct(invoice{Amount: 1})().String(), "INSERT INTO invoices (amount) VALUES ($1)")
+	t.Int(len(m.InsertStruct(i)().values), 2)
+	t.Nil(m.InsertStruct(i, "Foo")().Execute(), ErrUnknownColumn)
+	t.Nil(m.InsertStruct(1)().Execute(), ErrTypeAssertionFailed)
+
+	z := m.InsertZeroValues()
+	t.String(z.InsertStruct(invoice{Amount: 1})().String(), "INSERT INTO invoices (tenant_id, amount) VALUES ($1, $2)")
+	t.String(fmt.Sprint(z.InsertStruct(invoice{}, "TenantId")().values), "[0]")
+	t.Int(len(m.InsertStruct(invoice{Amount: 1})().values), 1)
+}
+
+func TestSelectInto(_t *testing.T) {
+	t := test{_t, 0}
+
+	createdAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	conn := &testDB{rows: [][]interface{}{{createdAt, []byte(`"bar.jpg"`)}}}
+	m := NewModel(category{}, conn)
+	c := category{Id: 1, Picture: "foo.jpg", Names: []map[string]string{{"en": "foo"}}}
+	t.Nil(m.SelectInto([]string{"CreatedAt", "Picture"}, &c, "WHERE id = $1", c.Id), nil)
+	t.String(conn.queries[0], "SELECT created_at, meta->'picture' FROM categories WHERE id = $1")
+	t.Int(c.Id, 1)
+	t.String(c.Picture, "bar.jpg")
+	t.String(fmt.Sprint(c.Names), "[map[en:foo]]")
+	t.Nil(c.CreatedAt.Equal(createdAt), true)
+	t.Nil(c.UpdatedAt.IsZero(), true)
+
+	conn.rows = [][]interface{}{{nil}}
+	t.Nil(m.SelectInto([]string{"Picture"}, &c), nil)
+	t.String(c.Picture, "")
+	t.Nil(m.SelectInto([]string{"Foo"}, &c), ErrUnknownColumn)
+	t.Nil(m.SelectInto([]string{"Id"}, c), ErrInvalidTarget)
+}
+
+func TestCountByGroup(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{"new", 3}, {"paid", 2}, {"", 1}}}
+	m := NewModel(ticket{}, conn)
+	counts, err := m.CountByGroup("Status")
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(counts), "map[:1 new:3 paid:2]")
+	t.Int(len(m.Scoped(1).MustCountByGroup("status", "WHERE id > $1", 2)), 3)
+	t.String(strings.Join(conn.queries, "; "),
+		"SELECT COALESCE(status::text, ''), COUNT(*) FROM tickets GROUP BY status; "+
+			"SELECT COALESCE(status::text, ''), COUNT(*) FROM tickets WHERE tickets.tenant_id = $2 AND (id > $1) GROUP BY status")
+	_, err = m.CountByGroup("Foo")
+	t.Nil(err, ErrUnknownColumn)
+}
+
+func TestInsertOrder(_t *testing.T) {
+	t := test{_t, 0}
+
+	type profile struct {
+		Id       int
+		Bio      string `jsonb:"extra"`
+		Name     string
+		Age      int
+		Nickname string `jsonb:"meta"`
+		Avatar   string `jsonb:"extra"`
+	}
+	m := NewModel(profile{})
+	for i := 0; i < 20; i++ {
+		s := m.Insert(m.Changes(RawChanges{
+			"Nickname": "foo",
+			"Avatar":   "a.png",
+			"Age":      20,
+			"Bio":      "bar",
+			"Name":     "foo",
+		}))()
+		t.String(s.String(), "INSERT INTO profiles (name, age, extra, meta) VALUES ($1, $2, $3, $4)")
+		t.String(fmt.Sprint(s.values), `[foo 20 {"bio":"bar","avatar":"a.png"} {"nickname":"foo"}]`)
+	}
+	t.String(m.Insert(m.Changes(RawChanges{"Age": 1}), m.Changes(RawChanges{"Name": "foo", "Id": 1}))().String(),
+		"INSERT INTO profiles (age, id, name) VALUES ($1, $2, $3)")
+	t.String(m.Insert(m.JsonbWhole("meta", nil), m.Changes(RawChanges{"Age": 1}), Changes{
+		Field{Name: "b", ColumnName: "b"}: 1,
+		Field{Name: "a", ColumnName: "a"}: 2,
+	})().String(), "INSERT INTO profiles (meta, age, a, b) VALUES ($1, $2, $3, $4)")
+}
+
+func TestPrepare(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testPrepareDB{}
+	conn.rows = [][]interface{}{{1}, {2}}
+	m := NewModelTable("orders", conn)
+	t.Nil(m.Prepare("findByStatus", "SELECT id FROM orders WHERE status = $1"), nil)
+	var ids []int
+	t.Nil(m.Exec("findByStatus", "new").Query(&ids), nil)
+	t.String(fmt.Sprint(ids), "[1 2]")
+	var id int
+	t.Nil(NewModelTable("users", conn).Exec("findByStatus", "new").QueryRow(&id), nil)
+	t.Int(id, 1)
+	var rowsAffected int
+	t.Nil(m.Exec("findByStatus", "new").Execute(&rowsAffected), nil)
+	t.Int(rowsAffected, 2)
+	t.String(strings.Join(conn.queries, "; "), strings.Repeat("; SELECT id FROM orders WHERE status = $1", 3)[2:])
+	t.String(m.Exec("findByStatus").String(), "EXECUTE findByStatus")
+
+	conn.rows = nil
+	t.Nil(errors.Is(m.Exec("findByStatus", "new").QueryRow(&id), errTestNoRows), true)
+	t.Nil(errors.Is(m.Exec("foo").Query(&ids), ErrPreparedNotFound), true)
+	t.Nil(m.Deallocate("findByStatus"), nil)
+	t.Nil(errors.Is(m.Exec("findByStatus", "new").Query(&ids), ErrPreparedNotFound), true)
+	t.Nil(m.Deallocate("findByStatus"), ErrPreparedNotFound)
+
+	t.Nil(m.Prepare("findByStatus", "SELECT 1"), nil)
+	t.Nil(conn.Close(), nil)
+	t.Nil(errors.Is(m.Exec("findByStatus").Execute(), ErrPreparedNotFound), true)
+
+	t.Nil(NewModelTable("orders", &testDB{}).Prepare("foo", "SELECT 1"), ErrPrepareNotSupported)
+	t.Nil(NewModelTable("orders", &testDB{}).Exec("foo").Execute(), ErrPrepareNotSupported)
+	t.Nil(NewModelTable("orders").Prepare("foo", "SELECT 1"), ErrNoConnection)
+
+	var prepared DB = preparedDB{&testQuoteDB{}, conn, "foo"}
+	t.String(prepared.(QuoteIdentifier).QuoteIdentifier("a"), "`a`")
+	t.String(Model{connection: preparedDB{conn, conn, "foo"}}.QuoteIdentifier("a"), `"a"`)
+	t.Nil(preparedDB{&testNoReturningDB{}, conn, "foo"}.SupportsReturning(), false)
+	t.Nil(preparedDB{conn, conn, "foo"}.SupportsReturning(), true)
+	_, err := preparedDB{conn, conn, "foo"}.CopyFrom(context.Background(), "orders", nil, nil)
+	t.Nil(err, ErrCopyNotSupported)
+	t.Nil(prepared.ErrNoRows(), errTestNoRows)
+}
+
+func TestUpdateOrder(_t *testing.T) {
+	t := test{_t, 0}
+
+	type profile struct {
+		Id       int
+		Bio      string `jsonb:"extra"`
+		Name     string
+		Age      int
+		Nickname string `jsonb:"meta"`
+		Avatar   string `jsonb:"extra"`
+	}
+	m := NewModel(profile{})
+	for i := 0; i < 20; i++ {
+		s := m.Update(m.Changes(RawChanges{
+			"Nickname": "foo",
+			"Avatar":   "a.png",
+			"Age":      20,
+			"Bio":      "bar",
+			"Name":     "foo",
+		}))("WHERE id = $1", 1)
+		t.String(s.String(), "UPDATE profiles SET name = $2, age = $3, "+
+			"extra = jsonb_set(jsonb_set(COALESCE(extra, '{}'::jsonb), '{bio}', $4), '{avatar}', $5), "+
+			"meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{nickname}', $6) WHERE id = $1")
+		t.String(fmt.Sprint(s.values), `[1 foo 20 "bar" "a.png" "foo"]`)
+	}
+	t.String(m.Update(m.Changes(RawChanges{"Age": 1}), m.Changes(RawChanges{"Name": "foo", "Id": 1}))().String(),
+		"UPDATE profiles SET age = $1, id = $2, name = $3")
+}
+
+func TestQueryRowStruct(_t *testing.T) {
+	t := test{_t, 0}
+
+	type note struct {
+		Id    int64
+		Body  string
+		Color string `jsonb:"meta"`
+	}
+	conn := &testDB{rows: [][]interface{}{{int64(5), "foo", []byte(`{"color":"red"}`)}}}
+	m := NewModel(note{}, conn)
+	var n note
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))("RETURNING *").QueryRowStruct(&n), nil)
+	t.Int(int(n.Id), 5)
+	t.String(n.Body, "foo")
+	t.String(n.Color, "red")
+	t.Nil(m.Update(m.Changes(RawChanges{"Body": "foo"}))("WHERE id = $1 returning  *", 5).QueryRowStruct(&n), nil)
+	t.Nil(m.Delete("WHERE id = $1 RETURNING id, body, meta", 5).QueryRowStruct(&n), nil)
+	t.String(strings.Join(conn.queries, "; "),
+		"INSERT INTO notes (body) VALUES ($1) RETURNING id, body, meta; "+
+			"UPDATE notes SET body = $2 WHERE id = $1 RETURNING id, body, meta; "+
+			"DELETE FROM notes WHERE id = $1 RETURNING id, body, meta")
+	var notes []note
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))("RETURNING *").QueryRowStruct(&notes), ErrInvalidTarget)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))("RETURNING *").QueryRowStruct(n), ErrInvalidTarget)
+
+	// some drivers return jsonb as string
+	conn.rows = [][]interface{}{{int64(6), "bar", `{"color":"blue"}`}}
+	t.Nil(m.Find().Query(&n), nil)
+	t.String(n.Color, "blue")
+	conn.rows = [][]interface{}{{int64(6), "bar", 1}}
+	t.Nil(errors.Is(m.Find().Query(&n), ErrTypeAssertionFailed), true)
+}
+
+func TestBatch(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(admin{})
+	batch := m.NewBatch(2)
+	batch.Add(m.Changes(RawChanges{"Name": "foo"})).Add(m.Changes(RawChanges{"Name": "bar", "Password": "x"}))
+	t.Int(batch.Len(), 2)
+	s := batch.Insert("RETURNING id")
+	t.String(s.String(), "INSERT INTO admins (name, password) VALUES ($1, DEFAULT), ($2, $3) RETURNING id")
+	t.String(fmt.Sprint(s.values), "[foo bar x]")
+	rows := batch.rows
+	t.Int(batch.Reset().Len(), 0)
+	t.Int(cap(batch.rows), cap(rows))
+	t.String(batch.Add(m.Changes(RawChanges{"Password": "y"})).Insert().String(),
+		"INSERT INTO admins (password) VALUES ($1)")
+	t.String(s.String(), "INSERT INTO admins (name, password) VALUES ($1, DEFAULT), ($2, $3) RETURNING id")
+}
+
+func TestQueryCache(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1, "foo", "x"}, {2, "bar", "y"}}}
+	m := NewModel(admin{}, conn).SetQueryCache(time.Minute)
+	var admins []admin
+	t.Nil(m.Find("WHERE id > $1", 0).Query(&admins), nil)
+	t.Int(len(admins), 2)
+	admins[0].Name = "changed"
+	var cached []admin
+	n, err := m.Find("WHERE id > $1", 0).QueryWithCount(&cached)
+	t.Nil(err, nil)
+	t.Int(n, 2)
+	t.String(cached[0].Name, "foo")
+	t.Int(len(conn.queries), 1) // hit
+
+	admins = nil
+	t.Nil(m.Find("WHERE id > $1", 1).Query(&admins), nil)
+	t.Int(len(conn.queries), 2) // different args
+	conn.rows = [][]interface{}{{"foo"}}
+	var name string
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.String(name, "foo")
+	t.Int(len(conn.queries), 3)
+
+	t.Nil(m.Update(m.Changes(RawChanges{"Name": "baz"}))("WHERE id = $1", 1).Execute(), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 5) // invalidated
+	t.Nil(m.Scoped(1).Delete("WHERE id = $1", 1).Execute(), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 7) // invalidated by copy of the Model
+
+	m.cache.ttl = time.Nanosecond
+	t.Nil(m.Select("name", "WHERE id = $1", 2).QueryRow(&name), nil)
+	time.Sleep(time.Millisecond)
+	t.Nil(m.Select("name", "WHERE id = $1", 2).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 9) // expired
+
+	t.Int(len(m.cache.entries), 2)
+	m.cache.entries[[32]byte{1}] = cacheEntry{expires: time.Now().Add(-time.Second)}
+	m.cache.swept = time.Time{}
+	t.Nil(m.Select("name", "WHERE id = $1", 3).QueryRow(&name), nil)
+	t.Int(len(m.cache.entries), 2) // expired entries are swept
+
+	m.cache.ttl = time.Minute
+	id := 5
+	t.Nil(m.Select("name", "WHERE id = $1", &id).QueryRow(&name), nil)
+	conn.rows = [][]interface{}{{"bar"}}
+	id = 6
+	t.Nil(m.Select("name", "WHERE id = $1", &id).QueryRow(&name), nil)
+	t.String(name, "bar")
+	t.Int(len(conn.queries), 12) // pointer compared by value
+	t.Nil(m.Select("name", "WHERE id = $1", 6).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 12)
+	ids := struct{ Id *int }{&id}
+	t.Nil(m.Select("name", "WHERE id = $1", ids).QueryRow(&name), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", ids).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 14) // not cached
+
+	for _, sql := range []string{
+		"SET statement_timeout = 0",
+		"WITH a AS (SELECT id FROM admins FOR UPDATE) SELECT count(*) FROM a",
+		"FETCH 10 FROM admins_cursor",
+	} {
+		t.Nil(m.NewSQLWithValues(sql).Execute(), nil)
+		t.Nil(m.Select("name", "WHERE id = $1", 6).QueryRow(&name), nil)
+	}
+	t.Int(len(conn.queries), 17) // read-only statements
+	t.Nil(m.NewSQLWithValues("WITH a AS (DELETE FROM admins RETURNING id) SELECT count(*) FROM a").Execute(), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 6).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 19) // invalidated by writable CTE
+	t.Nil(m.NewSQLWithValues("truncate admins").Execute(), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 6).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 21)
+
+	m.SetQueryCache(0)
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.Nil(m.Select("name", "WHERE id = $1", 1).QueryRow(&name), nil)
+	t.Int(len(conn.queries), 23)
+
+	tx := &testTxConn{}
+	tx.rows = [][]interface{}{{"foo"}}
+	mt := NewModel(admin{}, tx).SetQueryCache(time.Minute)
+	t.Nil(mt.Select("name").QueryRow(&name), nil)
+	t.Nil(mt.Select("name").QueryRow(&name), nil)
+	t.Int(len(tx.queries), 2) // connection is a transaction
+}
+
+func TestAutoReturning(_t *testing.T) {
+	t := test{_t, 0}
+
+	type note struct {
+		Id   int64
+		Body string
+	}
+	conn := &testDB{rows: [][]interface{}{{int64(5), "foo"}}}
+	m := NewModel(note{}, conn)
+	var n note
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))().Query(&n), nil)
+	t.Int(int(n.Id), 5)
+	t.String(n.Body, "foo")
+	var notes []note
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))().Query(&notes), nil)
+	t.Int(len(notes), 1)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))().ReturningAll().Query(&n), nil)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Body": "foo"}))("returning id, body").Query(&n), nil)
+	t.Nil(m.Update(m.Changes(RawChanges{"Body": "foo"}))().Query(&n), nil)
+	t.String(strings.Join(conn.queries, "; "),
+		"INSERT INTO notes (body) VALUES ($1) RETURNING id, body; "+
+			"INSERT INTO notes (body) VALUES ($1) RETURNING id, body; "+
+			"INSERT INTO notes (body) VALUES ($1) RETURNING id, body; "+
+			"INSERT INTO notes (body) VALUES ($1) returning id, body; "+
+			"UPDATE notes SET body = $1")
+
+	type counter struct {
+		Id int64
+	}
+	tx := &testTx{rows: [][]interface{}{{int64(7)}}}
+	conn2 := &testNoReturningDB{tx: tx}
+	m2 := NewModel(counter{}, conn2)
+	var c counter
+	t.Nil(m2.Insert(m2.Changes(RawChanges{"Id": Default}))().Query(&c), nil)
+	t.Int(int(c.Id), 7)
+	t.Int(len(conn2.queries), 0)
+	t.String(strings.Join(tx.queries, "; "), "INSERT INTO counters (id) VALUES (DEFAULT); "+
+		"SELECT lastval(); SELECT id FROM counters WHERE id = $1; COMMIT")
+
+	conn2.tx = &testLastInsertIdTx{testTx{rows: [][]interface{}{{int64(9), "foo"}}}}
+	m3 := NewModel(note{}, conn2)
+	t.Nil(m3.Insert(m3.Changes(RawChanges{"Body": "foo"}))().Query(&n), nil)
+	t.Int(int(n.Id), 9)
+	t.String(strings.Join(conn2.tx.(*testLastInsertIdTx).queries, "; "),
+		"INSERT INTO notes (body) VALUES ($1); SELECT id, body FROM notes WHERE id = $1; COMMIT")
+	t.Nil(m3.Insert(m3.Changes(RawChanges{"Body": "foo"}))().Query(&notes), nil)
+	t.String(conn2.queries[0], "INSERT INTO notes (body) VALUES ($1)")
+}
+
+func TestQueryWithCap(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{1}, {2}, {3}}}
+	m := NewModelTable("numbers", conn)
+	ids := []int{0}
+	t.Nil(m.Select("id").QueryWithCap(&ids, 10), nil)
+	t.String(fmt.Sprint(ids), "[0 1 2 3]")
+	t.Int(cap(ids), 11)
+	ids = make([]int, 0, 5)
+	t.Nil(m.Select("id").QueryWithCap(&ids, 3), nil)
+	t.Int(cap(ids), 5)
+	var ids2 []int
+	t.Nil(m.Select("id").QueryWithCap(&ids2, 0), nil)
+	t.String(fmt.Sprint(ids2), "[1 2 3]")
+}
+
+func benchmarkQueryWithCap(b *testing.B, capacity int) {
+	conn := &testDB{}
+	for i := 0; i < 10000; i++ {
+		conn.rows = append(conn.rows, []interface{}{i})
+	}
+	m := NewModelTable("numbers", conn)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		conn.queries = nil
+		var ids []int
+		if err := m.Select("id").QueryWithCap(&ids, capacity); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkQuery(b *testing.B) {
+	benchmarkQueryWithCap(b, 0)
+}
+
+func BenchmarkQueryWithCap(b *testing.B) {
+	benchmarkQueryWithCap(b, 10000)
+}
+
+func benchmarkBatchInsert(b *testing.B, reuse bool) {
+	m := NewModel(admin{})
+	batch := m.NewBatch(100)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if reuse {
+			batch.Reset()
+		} else {
+			batch = m.NewBatch(100)
+		}
+		for j := 0; j < 100; j++ {
+			batch.Add(m.Changes(RawChanges{"Name": "foo", "Password": "bar"}))
+		}
+		if s := batch.Insert(); s.err != nil {
+			b.Fatal(s.err)
+		}
+	}
+}
+
+func BenchmarkBatchInsert(b *testing.B) {
+	benchmarkBatchInsert(b, false)
+}
+
+func BenchmarkBatchInsertReset(b *testing.B) {
+	benchmarkBatchInsert(b, true)
+}
+
+type testStatus int
+
+const (
+	testStatusNew testStatus = iota
+	testStatusPaid
+)
+
+var testStatusNames = []string{"new", "paid"}
+
+func (s testStatus) String() string {
+	return testStatusNames[s]
+}
+
+func (s *testStatus) UnmarshalText(text []byte) error {
+	for i, name := range testStatusNames {
+		if name == string(text) {
+			*s = testStatus(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid status: %s", text)
+}
+
+func TestEnum(_t *testing.T) {
+	t := test{_t, 0}
+
+	type order struct {
+		Id       int
+		Status   testStatus  `enumAs:"text"`
+		Previous *testStatus `enumAs:"text"`
+		Code     testStatus  `enumAs:"int"`
+	}
+	m := NewModel(order{})
+	t.String(m.Schema(), `CREATE TABLE orders (
+	id SERIAL PRIMARY KEY,
+	status text DEFAULT ''::text NOT NULL,
+	previous text DEFAULT ''::text,
+	code integer DEFAULT 0 NOT NULL
+);
+`)
+	paid := testStatusPaid
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Status": testStatusPaid}))().values), "[paid]")
+	t.String(fmt.Sprint(m.Insert(m.Changes(RawChanges{"Previous": &paid}))().values), "[paid]")
+	t.Nil(m.Insert(m.Changes(RawChanges{"Previous": (*testStatus)(nil)}))().values[0], nil)
+	t.String(fmt.Sprint(m.Update(m.Changes(RawChanges{"Code": testStatusPaid}))().values), "[1]")
+
+	var o order
+	err := m.Find().scan(reflect.ValueOf(&o).Elem(), testRow{values: []interface{}{1, []byte("paid"), "new", testStatusPaid}})
+	t.Nil(err, nil)
+	t.Nil(o.Status, testStatusPaid)
+	t.Nil(*o.Previous, testStatusNew)
+	t.Nil(o.Code, testStatusPaid)
+	err = m.Find().scan(reflect.ValueOf(&o).Elem(), testRow{values: []interface{}{1, "new", nil, testStatusNew}})
+	t.Nil(err, nil)
+	t.Nil(o.Status, testStatusNew)
+	t.Nil(o.Previous == nil, true)
+	err = m.Find().scan(reflect.ValueOf(&o).Elem(), testRow{values: []interface{}{1, "bad", nil, testStatusNew}})
+	t.String(fmt.Sprint(err), "invalid status: bad")
+}
+
+func TestInsertIfNotExists(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{3}}}
+	m := NewModel(author{}, conn)
+	inserted, id, err := m.InsertIfNotExists([]string{"Name"}, m.Changes(RawChanges{"Name": "foo"}))
+	t.Nil(err, nil)
+	t.Nil(inserted, true)
+	t.Int(id, 3)
+	t.String(conn.queries[0], "INSERT INTO authors (name) VALUES ($1) ON CONFLICT (name) DO NOTHING RETURNING id")
+	conn.rows = nil
+	inserted, id, err = m.InsertIfNotExists([]string{"name"}, m.Changes(RawChanges{"Name": "foo"}))
+	t.Nil(err, nil)
+	t.Nil(inserted, false)
+	t.Int(id, 0)
+	_, _, err = NewModel(author{}).InsertIfNotExists([]string{"Name"}, m.Changes(RawChanges{"Name": "foo"}))
+	t.Nil(err, ErrNoConnection)
+}
+
+func TestQuoteIdentifier(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModelTable("products", &testDB{})
+	t.String(m.QuoteIdentifier("order"), `"order"`)
+	t.String(m.QuoteIdentifier(`a"b`), `"a""b"`)
+	t.String(NewModelTable("products").QuoteIdentifier("order"), `"order"`)
+	m = NewModelTable("products", &testQuoteDB{})
+	t.String(m.QuoteIdentifier("order"), "`order`")
+	t.String(m.QuoteIdentifier("a`b"), "`a``b`")
+	t.String(m.SelectJsonbKeys("meta", "size")().String(), "SELECT meta->>'size' AS `size` FROM products")
+}
+
+func TestInChunks(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	for i := 0; i < 1200; i++ {
+		conn.rows = append(conn.rows, []interface{}{i})
+	}
+	m := NewModelTable("numbers", conn)
+	var sizes []int
+	var sum int
+	err := m.Select("id").InChunks(500, func(ids []int) error {
+		sizes = append(sizes, len(ids))
+		for _, id := range ids {
+			sum += id
+		}
+		return nil
+	})
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(sizes), "[500 500 200]")
+	t.Int(sum, 1199*1200/2)
+
+	errStop := errors.New("stop")
+	sizes = nil
+	err = m.Select("id").InChunks(500, func(ids []int) error {
+		sizes = append(sizes, len(ids))
+		return errStop
+	})
+	t.Nil(err, errStop)
+	t.String(fmt.Sprint(sizes), "[500]")
+
+	conn.rows = nil
+	err = m.Select("id").InChunks(500, func(ids []int) error {
+		return errStop
+	})
+	t.Nil(err, nil)
+
+	t.Nil(m.Select("id").InChunks(0, func([]int) error { return nil }), ErrInvalidChunkFunc)
+	t.Nil(m.Select("id").InChunks(1, func(int) error { return nil }), ErrInvalidChunkFunc)
+	t.Nil(m.Select("id").InChunks(1, func([]int) {}), ErrInvalidChunkFunc)
+	t.Nil(m.Select("id").InChunks(1, nil), ErrInvalidChunkFunc)
+	t.Nil(NewModelTable("numbers").Select("id").InChunks(1, func([]int) error { return nil }), ErrNoConnection)
+}
+
+func TestLabel(_t *testing.T) {
+	t := test{_t, 0}
+
+	var labels []string
+	var errs []error
+	OnQuery(func(label string, duration time.Duration, err error) {
+		labels = append(labels, label)
+		errs = append(errs, err)
+	})
+	defer func() { queryHooks = nil }()
+
+	conn := &testDB{rows: [][]interface{}{{1}}}
+	m := NewModelTable("orders", conn)
+	var ids []int
+	t.Nil(m.Select("id").Label("orders.list").Query(&ids), nil)
+	var id int
+	t.Nil(m.Select("id").QueryRow(&id), nil)
+	t.Nil(m.Delete().Execute(), nil)
+	cur, err := m.Select("id").Label("orders.cursor").Cursor()
+	t.Nil(err, nil)
+	cur.Close()
+	conn.rows = nil
+	t.Nil(errors.Is(m.Select("id").QueryRow(&id), errTestNoRows), true)
+	t.Nil(m.Select("id").withError(ErrNoConnection).Label("never").QueryRow(&id), ErrNoConnection)
+	t.String(strings.Join(labels, ","), "orders.list,orders.select,orders.delete,orders.cursor,orders.select")
+	t.Nil(errs[0], nil)
+	t.Nil(errors.Is(errs[4], errTestNoRows), true)
+
+	tx := &testTx{}
+	labels = nil
+	t.Nil(m.NewSQLWithValues("UPDATE\norders SET a = 1").ExecTx(tx, context.Background()), nil)
+	t.String(strings.Join(labels, ","), "orders.update")
+}
+
+func TestMetricsHook(_t *testing.T) {
+	t := test{_t, 0}
+
+	hook := &testMetricsHook{}
+	conn := &testDB{rows: [][]interface{}{{1}}}
+	m := NewModel(author{}, conn, hook)
+	t.Nil(m.Insert(m.Changes(RawChanges{"Name": "foo"}))().Execute(), nil)
+	t.Nil(m.Select("id").Query(&[]int{}), nil)
+	conn.rows = nil
+	var a author
+	t.Nil(errors.Is(m.Find().Query(&a), errTestNoRows), true)
+	t.String(strings.Join(hook.observations, ","), "authors INSERT <nil>,authors SELECT <nil>,"+
+		"authors SELECT no rows (SQL: SELECT id, name, deleted_at FROM authors)")
+	m.SetMetricsHook(nil)
+	t.Nil(m.Delete().Execute(), nil)
+	t.Int(len(hook.observations), 3)
+}
+
+func TestUpdateIfChanged(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModel(ticket{})
+	s := m.UpdateIfChanged(m.Changes(RawChanges{"status": "paid"}))("WHERE id = $1", 1)
+	t.String(s.String(), "UPDATE tickets SET status = $2 WHERE (tickets.status IS DISTINCT FROM $2) AND (id = $1)")
+	t.String(fmt.Sprint(s.values), "[1 paid]")
+	s = m.UpdateIfChanged(m.Changes(RawChanges{"status": Cast("paid", "text")}), m.Changes(RawChanges{"Id": Raw("id")}))()
+	t.String(s.String(), "UPDATE tickets SET status = $1::text, id = id WHERE (tickets.status IS DISTINCT FROM $1::text)")
+	s = m.UpdateIfChanged(m.Changes(RawChanges{"Id": Raw("id")}))("RETURNING id")
+	t.String(s.String(), "UPDATE tickets SET id = id RETURNING id")
+
+	m2 := NewModel(category{})
+	s = m2.UpdateIfChanged(m2.Changes(RawChanges{"Picture": "a.png"}))("RETURNING id")
+	t.String(s.String(), "UPDATE categories SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $1) "+
+		"WHERE (categories.meta IS DISTINCT FROM jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $1)) RETURNING id")
+	s = m2.Scoped(2).UpdateIfChanged(m2.Changes(RawChanges{"Picture": "a.png"}))()
+	t.String(s.String(), "UPDATE categories SET meta = jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $2) "+
+		"WHERE (categories.meta IS DISTINCT FROM jsonb_set(COALESCE(meta, '{}'::jsonb), '{picture}', $2)) AND (categories.tenant_id = $1)")
+}
+
+func TestTableSample(_t *testing.T) {
+	t := test{_t, 0}
+
+	m := NewModelTable("orders")
+	s := m.Select("AVG(amount)", "WHERE status = $1", "paid").TableSample(Bernoulli, 1)
+	t.String(s.String(), "SELECT AVG(amount) FROM orders TABLESAMPLE BERNOULLI (1) WHERE status = $1")
+	t.Nil(s.err, nil)
+	s = NewModel(admin{}).Find().TableSample("system", 0.5).OrderBy("Id")
+	t.String(s.String(), "SELECT id, name, password FROM admins TABLESAMPLE SYSTEM (0.5) ORDER BY id")
+	t.Nil(m.Select("*").TableSample(System, 1).TableSample(System, 1).err, ErrInvalidTableSample)
+	t.Nil(m.Select("*").TableSample("RANDOM", 1).err, ErrInvalidTableSample)
+	t.Nil(m.Select("*").TableSample(System, 101).err, ErrInvalidTableSample)
+	t.Nil(m.Delete().TableSample(System, 1).err, ErrInvalidTableSample)
+}
+
+func TestBatchInsertReturning(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{3}, {4}}}
+	m := NewModel(author{}, conn)
+	var ids []int
+	err := m.BatchInsert(
+		[]Changes{m.Changes(RawChanges{"Name": "foo"})},
+		[]Changes{m.Changes(RawChanges{"Name": "bar"})},
+	)("RETURNING id").Query(&ids)
+	t.Nil(err, nil)
+	t.String(fmt.Sprint(ids), "[3 4]")
+	t.String(conn.queries[0], "INSERT INTO authors (name) VALUES ($1), ($2) RETURNING id")
+}
+
+func TestWhereFilter(_t *testing.T) {
+	t := test{_t, 0}
+
+	type orderFilter struct {
+		Status      string
+		UserId      *int
+		Ids         []int `column:"id"`
+		CreatedAtGt time.Time
+		AmountLte   int
+		StatusNe    string
+		Name        string `op:"ilike"`
+		Skipped     string `column:"-"`
+		secret      string
+	}
+	m := NewModel(struct {
+		__TABLE_NAME__ string `orders`
+
+		Id        int
+		Status    string `column:"state"`
+		UserId    int
+		CreatedAt time.Time
+	}{})
+	w := m.WhereFilter(orderFilter{Status: "new", Skipped: "x", secret: "y"})
+	t.String(w.String(), "WHERE state = $1")
+	zero := 0
+	now := time.Now()
+	w = m.WhereFilter(&orderFilter{
+		UserId:      &zero,
+		Ids:         []int{1, 2},
+		CreatedAtGt: now,
+		AmountLte:   10,
+		StatusNe:    "paid",
+		Name:        "%foo%",
+	})
+	t.String(w.String(), "WHERE user_id = $1 AND id = ANY($2) AND created_at > $3 AND amount <= $4 AND state <> $5 AND name ILIKE $6")
+	t.String(fmt.Sprint(w.Values()[1:]), fmt.Sprint([]interface{}{Array([]int{1, 2}), now, 10, "paid", "%foo%"}))
+	t.String(m.WhereFilter(orderFilter{}).String(), "")
+	t.String(m.WhereFilter(1).String(), "")
+	t.String(m.Find(m.WhereFilter(orderFilter{Status: "new"})).String(), "SELECT id, state, user_id, created_at FROM orders WHERE state = $1")
+
+	conn := &testDB{rows: [][]interface{}{{1, "new", 2, now}}}
+	m.SetConnection(conn)
+	var orders []struct {
+		Id        int
+		State     string
+		UserId    int
+		CreatedAt time.Time
+	}
+	err := m.FindWhere(orderFilter{Status: "new"}, &orders)
+	t.Nil(err, nil)
+	t.String(orders[0].State, "new")
+	t.String(conn.queries[0], "SELECT id, state, user_id, created_at FROM orders WHERE state = $1")
+
+	defer func() {
+		t.String(fmt.Sprint(recover()), "db: invalid operator foo of field Name")
+	}()
+	m.WhereFilter(struct {
+		Name string `op:"foo"`
+	}{"x"})
+}
+
+func TestReadOnly(_t *testing.T) {
+	t := test{_t, 0}
+
+	type record struct {
+		Id        int
+		TenantId  int `readonly:""`
+		Name      string
+		CreatedAt time.Time `readonly:""`
+		Source    string    `jsonb:"meta" readonly:""`
+	}
+	m := NewModel(record{})
+	t.Nil(m.FieldByName("TenantId").ReadOnly, true)
+	t.Nil(m.FieldByName("Name").ReadOnly, false)
+	createdAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	changes := m.Changes(RawChanges{"TenantId": 1, "CreatedAt": createdAt, "Source": "web"})
+	name := m.Changes(RawChanges{"Name": "foo"})
+	t.String(m.Update(changes, name)("WHERE id = $1", 1).String(), "UPDATE records SET name = $2 WHERE id = $1")
+	t.String(fmt.Sprint(m.Update(changes, name)("WHERE id = $1", 1).values), "[1 foo]")
+	t.String(m.UpdateIfChanged(changes, name)().String(),
+		"UPDATE records SET name = $1 WHERE (records.name IS DISTINCT FROM $1)")
+	conn := &testDB{}
+	m = NewModel(record{}, conn)
+	t.Nil(m.Update(changes)("WHERE id = $1", 1).Execute(), ErrNothingToUpdate)
+	t.Nil(m.UpdateIfChanged(changes)().Execute(), ErrNothingToUpdate)
+	t.Int(len(conn.queries), 0)
+	t.String(m.Insert(m.Changes(RawChanges{"TenantId": 1}))().String(), "INSERT INTO records (tenant_id) VALUES ($1)")
+	t.String(m.Upsert([]string{"Id"}, m.Changes(RawChanges{"Id": 1}), m.Changes(RawChanges{"TenantId": 1}))().String(),
+		"INSERT INTO records (id, tenant_id) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING")
+}
+
+func TestQueryWithCount(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	m := NewModelTable("numbers", conn)
+	var ids []int
+	t.Nil(m.Select("id").Query(&ids), nil)
+	t.Int(len(ids), 0)
+	n, err := m.Select("id").QueryWithCount(&ids)
+	t.Nil(err, nil)
+	t.Int(n, 0)
+
+	conn.rows = [][]interface{}{{1}, {2}, {3}}
+	n, err = m.Select("id").QueryWithCount(&ids)
+	t.Nil(err, nil)
+	t.Int(n, 3)
+
+	cur, err := m.Select("id").Cursor()
+	t.Nil(err, nil)
+	t.Int(cur.Count(), 0)
+	for cur.Next() {
+	}
+	t.Int(cur.Count(), 3)
+	t.Nil(cur.Close(), nil)
+
+	conn.rows = [][]interface{}{{1, "a"}, {2, "b"}, {3, "c"}}
+	names := map[int]string{}
+	n, err = m.Select("id, name").QueryWithCount(&names)
+	t.Nil(err, nil)
+	t.Int(n, 3)
+	t.Int(len(names), 3)
+
+	conn.rows = [][]interface{}{{map[string]string{"a": "b"}}}
+	var attrs map[string]string
+	t.Nil(m.Select("attrs", "WHERE id = $1", 1).QueryRow(&attrs), nil)
+	t.String(attrs["a"], "b")
+}
+
+func TestReturningMap(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{rows: [][]interface{}{{"a", 1}, {"b", 2}}}
+	m := NewModelTable("orders", conn)
+	insert := m.NewSQLWithValues("INSERT INTO orders (trade_number) VALUES ($1), ($2) RETURNING trade_number, id", "a", "b")
+	var tradeNumberToId map[string]int
+	t.Nil(insert.QueryRow(&tradeNumberToId), nil)
+	t.String(fmt.Sprint(tradeNumberToId), "map[a:1 b:2]")
+	tradeNumberToId = nil
+	t.Nil(insert.Execute(&tradeNumberToId), nil)
+	t.String(fmt.Sprint(tradeNumberToId), "map[a:1 b:2]")
+	tradeNumberToId = nil
+	t.Nil(m.Delete("RETURNING trade_number, id").Execute(&tradeNumberToId), nil)
+	t.Int(len(tradeNumberToId), 2)
+	t.String(conn.queries[2], "DELETE FROM orders RETURNING trade_number, id")
+
+	tx := &testTx{rows: [][]interface{}{{"c", 3}, {"d", 4}}, batch: 2}
+	txConn := &testTxDB{tx: tx}
+	tradeNumberToId = nil
+	t.Nil(NewModelTable("orders", txConn).NewSQLWithValues("INSERT INTO orders (trade_number) "+
+		"VALUES ($1), ($2) RETURNING trade_number, id", "c", "d").ExecuteInTransaction(&TxOptions{
+		StatementTimeout: time.Second,
+	}, &tradeNumberToId), nil)
+	t.String(fmt.Sprint(tradeNumberToId), "map[c:3 d:4]")
+}
+
+func TestQueryRowOrNil(_t *testing.T) {
+	t := test{_t, 0}
+
+	conn := &testDB{}
+	m := NewModel(admin{}, conn)
+	var name string
+	found, err := m.Select("name", "WHERE id = $1", 1).QueryRowOrNil(&name)
+	t.Nil(found, false)
+	t.Nil(err, nil)
+	err = m.Select("name", "WHERE id = $1", 1).QueryRow(&name)
+	t.Nil(m.IsNoRows(err), true)
+	t.Nil(m.IsNoRows(nil), false)
+	t.Nil(m.IsNoRows(errors.New("other")), false)
+	t.Nil(IsNoRows(err), false)
+	t.Nil(IsNoRows(fmt.Errorf("%w (SQL: SELECT 1)", sql.ErrNoRows)), true)
+	t.Nil(IsNoRows(nil), false)
+
+	err = fmt.Errorf("%w (SQL: INSERT)", testCodeError("23505"))
+	t.Nil(m.ErrHasCode(err, "23505"), true)
+	t.Nil(m.ErrHasCode(err, "23503"), false)
+	t.Nil(m.ErrHasCode(nil, "23505"), false)
+	t.Nil(NewModel(admin{}).ErrHasCode(err, "23505"), false)
+
+	getters := errCodeGetters
+	RegisterErrGetCode(conn.ErrGetCode)
+	t.Nil(IsUniqueViolation(err), true)
+	t.Nil(IsErrorCode(err, "23505"), true)
+	t.Nil(IsErrorCode(err, "23503"), false)
+	t.Nil(IsUniqueViolation(errors.New("23505")), false)
+	t.Nil(IsUniqueViolation(nil), false)
+	errCodeGetters = getters
+	t.Nil(IsUniqueViolation(err), false)
+
+	conn.rows = [][]interface{}{{1}}
+	var id int
+	found, err = m.Select("id", "WHERE id = $1", 1).QueryRowOrNil(&id)
+	t.Nil(found, true)
+	t.Nil(err, nil)
+	t.Int(id, 1)
+}
+
+func (r testRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return fmt.Errorf("expected %d destination arguments in Scan, not %d", len(r.values), len(dest))
+	}
+	for i, d := range dest {
+		if scanner, ok := d.(sql.Scanner); ok {
+			if err := scanner.Scan(r.values[i]); err != nil {
+				return err
+			}
+			continue
+		}
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(r.values[i]))
+	}
+	return nil
+}
+
+func (r testRows) Columns() ([]string, error) {
+	return r.columns, nil
+}
+
+func (d *testDB) Close() error {
+	return nil
+}
+
+func (d *testDB) Exec(query string, args ...interface{}) (Result, error) {
+	d.queries = append(d.queries, query)
+	return testResult(len(d.rows)), nil
+}
+
+func (d *testDB) Query(query string, args ...interface{}) (Rows, error) {
+	d.queries = append(d.queries, query)
+	return &testRowsIterator{rows: d.rows, row: -1}, nil
+}
+
+func (d *testDB) QueryRow(query string, args ...interface{}) Row {
+	d.queries = append(d.queries, query)
+	if len(d.rows) == 0 {
+		return testRow{err: errTestNoRows}
+	}
+	return testRow{values: d.rows[0]}
+}
+
+func (d *testDB) BeginTx(ctx context.Context, isolationLevel string) (Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func (d *testDB) ErrNoRows() error {
+	return errTestNoRows
+}
+
+func (d *testDB) ErrGetCode(err error) string {
+	var e testCodeError
+	if errors.As(err, &e) {
+		return string(e)
+	}
+	return "unknown"
+}
+
+func (d *testDB) Stats() Stats {
+	return Stats{}
+}
+
+func (d *testQuoteDB) QuoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+func (h *testMetricsHook) ObserveQuery(table, verb string, duration time.Duration, err error) {
+	h.observations = append(h.observations, fmt.Sprint(table, " ", verb, " ", err))
+}
+
+func (d *testCopyDB) CopyFrom(ctx context.Context, tableName string, columns []string, rows [][]interface{}) (int64, error) {
+	d.tableName, d.columns, d.rows = tableName, columns, rows
+	return int64(len(rows)), nil
+}
+
+func (d *testPrepareDB) PrepareNamed(name, query string) error {
+	if d.statements == nil {
+		d.statements = map[string]string{}
+	}
+	d.statements[name] = query
+	return nil
+}
+
+func (d *testPrepareDB) ExecNamed(name string, args ...interface{}) (Result, error) {
+	query, ok := d.statements[name]
+	if !ok {
+		return nil, ErrPreparedNotFound
+	}
+	return d.Exec(query, args...)
+}
+
+func (d *testPrepareDB) QueryNamed(name string, args ...interface{}) (Rows, error) {
+	query, ok := d.statements[name]
+	if !ok {
+		return nil, ErrPreparedNotFound
+	}
+	return d.Query(query, args...)
+}
+
+func (d *testPrepareDB) DeallocateNamed(name string) error {
+	if _, ok := d.statements[name]; !ok {
+		return ErrPreparedNotFound
+	}
+	delete(d.statements, name)
+	return nil
+}
+
+func (d *testPrepareDB) Close() error {
+	d.statements = nil
+	return nil
+}
+
+func (d *testNoReturningDB) SupportsReturning() bool {
+	return false
+}
+
+func (d *testNoReturningDB) BeginTx(ctx context.Context, isolationLevel string) (Tx, error) {
+	return d.tx, nil
+}
+
+func (tx *testLastInsertIdTx) ExecContext(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	tx.queries = append(tx.queries, query)
+	return testLastInsertIdResult(9), nil
+}
+
+func (r testLastInsertIdResult) RowsAffected() (int64, error) {
+	return 1, nil
+}
+
+func (r testLastInsertIdResult) LastInsertId() (int64, error) {
+	return int64(r), nil
+}
+
+func (d *testTxConn) ExecContext(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	return d.Exec(query, args...)
+}
+
+func (d *testTxConn) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return d.Query(query, args...)
+}
+
+func (d *testTxConn) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	return d.QueryRow(query, args...)
+}
+
+func (d *testTxConn) Commit(ctx context.Context) error {
+	return nil
+}
+
+func (d *testTxConn) Rollback(ctx context.Context) error {
+	return nil
+}
+
+func (d *testTxDB) BeginTx(ctx context.Context, isolationLevel string) (Tx, error) {
+	return d.tx, nil
+}
+
+func (tx *testTx) ExecContext(ctx context.Context, query string, args ...interface{}) (Result, error) {
+	tx.queries = append(tx.queries, query)
+	return testResult(0), nil
+}
+
+func (tx *testTx) QueryContext(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	tx.queries = append(tx.queries, query)
+	n := tx.batch
+	if n > len(tx.rows) {
+		n = len(tx.rows)
+	}
+	rows := tx.rows[:n]
+	tx.rows = tx.rows[n:]
+	return &testRowsIterator{rows: rows, row: -1, err: tx.rowsErr}, nil
+}
+
+func (tx *testTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) Row {
+	tx.queries = append(tx.queries, query)
+	if len(tx.rows) == 0 {
+		return testRow{err: errTestNoRows}
+	}
+	return testRow{values: tx.rows[0]}
+}
+
+func (tx *testTx) Commit(ctx context.Context) error {
+	tx.queries = append(tx.queries, "COMMIT")
+	return nil
+}
+
+func (tx *testTx) Rollback(ctx context.Context) error {
+	tx.queries = append(tx.queries, "ROLLBACK")
+	return nil
+}
+
+func (r *testRowsIterator) Close() error {
+	return nil
+}
+
+func (r *testRowsIterator) Err() error {
+	return r.err
+}
+
+func (r *testRowsIterator) Next() bool {
+	r.row++
+	return r.row < len(r.rows)
+}
+
+func (r *testRowsIterator) Scan(dest ...interface{}) error {
+	return testRow{values: r.rows[r.row]}.Scan(dest...)
+}
+
+func (r testResult) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+func (l *testLogger) Debug(args ...interface{}) {
+	l.logs = append(l.logs, strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+func (l *testLogger) Info(args ...interface{})     {}
+func (l *testLogger) Notice(args ...interface{})   {}
+func (l *testLogger) Warning(args ...interface{})  {}
+func (l *testLogger) Error(args ...interface{})    {}
+func (l *testLogger) Critical(args ...interface{}) {}
+func (l *testLogger) Fatal(args ...interface{})    {}
+
 func (t *test) String(got, expected string) {
 	t.Helper()
 	if got == expected {
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrInvalidPaginateTarget = errors.New("target must be pointer of a slice")
+)
+
+// Paginate puts rows of the page (starts from 1) into the target, which must
+// be pointer of a slice (its elements are replaced), and returns number of
+// all rows matching the conditions and number of pages. Conditions can have
+// WHERE and ORDER BY clauses, but not LIMIT or OFFSET. The rows and the count
+// are queried in one snapshot (see Snapshot()), so they are consistent even
+// if the table is being changed.
+//  var orders []models.Order
+//  count, pages, err := m.Paginate(&orders, 2, 20, "WHERE status = $1 ORDER BY id DESC", "new")
+func (m Model) Paginate(target interface{}, page, perPage int, conditions string, args ...interface{}) (count, pages int, err error) {
+	rt := reflect.TypeOf(target)
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Slice {
+		err = ErrInvalidPaginateTarget
+		return
+	}
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 1
+	}
+	v := reflect.ValueOf(target).Elem()
+	values := append([]interface{}{conditions}, args...)
+	countValues := append([]interface{}{withoutOrderBy(conditions)}, args...)
+	err = m.Snapshot(func(ctx context.Context, tx Tx) error {
+		if err := m.Select("COUNT(*)", countValues...).QueryRowTx(tx, ctx, &count); err != nil {
+			return err
+		}
+		offset := (page - 1) * perPage
+		results := reflect.MakeSlice(v.Type(), 0, 0)
+		if offset < count {
+			s := m.Find(values...).Limit(perPage).Offset(offset)
+			rows, err := s.QueryTx(tx, ctx)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				rv := reflect.New(v.Type().Elem()).Elem()
+				if err := s.scan(rv, rows); err != nil {
+					return s.wrapError(err)
+				}
+				results = reflect.Append(results, rv)
+			}
+			if err := rows.Err(); err != nil {
+				return s.wrapError(err)
+			}
+		}
+		v.Set(results)
+		return nil
+	})
+	if err == nil {
+		pages = (count + perPage - 1) / perPage
+	}
+	return
+}
+
+// withoutOrderBy removes the top-level ORDER BY clause from the conditions.
+func withoutOrderBy(conditions string) string {
+	start := -1
+	for _, i := range topLevelWords(conditions) {
+		if start == -1 {
+			if hasKeywordAt(conditions, i, "ORDER BY") {
+				start = i
+			}
+			continue
+		}
+		if isClauseAfterWhere(conditions, i) {
+			return strings.TrimSpace(conditions[:start] + conditions[i:])
+		}
+	}
+	if start == -1 {
+		return conditions
+	}
+	return strings.TrimSpace(conditions[:start])
+}
@@ -2,6 +2,9 @@ package pgx
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"sync"
 
 	"github.com/caiguanhao/furk/db"
 	"github.com/jackc/pgx/v4"
@@ -11,6 +14,9 @@ import (
 type (
 	DB struct {
 		*pgxpool.Pool
+
+		statementsMu sync.Mutex
+		statements   map[string]string // queries of prepared statements
 	}
 
 	Tx struct {
@@ -23,9 +29,25 @@ type (
 
 	Rows struct {
 		pgx.Rows
+
+		release func() // releases the acquired connection
+	}
+
+	// Options can be used in OpenWithOptions.
+	Options struct {
+		// Name of the application shown in pg_stat_activity. It is sent
+		// as a startup parameter, so every connection of the pool has it,
+		// unlike "SET application_name" which only changes the session of
+		// one connection.
+		ApplicationName string
 	}
 )
 
+func init() {
+	db.RegisterNoRowsError(pgx.ErrNoRows)
+	db.RegisterErrGetCode(new(DB).ErrGetCode)
+}
+
 // MustOpen is like Open but panics if connect operation fails.
 func MustOpen(conn string) db.DB {
 	c, err := Open(conn)
@@ -35,20 +57,131 @@ func MustOpen(conn string) db.DB {
 	return c
 }
 
+// MustOpenWithOptions is like OpenWithOptions but panics if connect
+// operation fails.
+func MustOpenWithOptions(conn string, options Options) db.DB {
+	c, err := OpenWithOptions(conn, options)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 // Open creates and establishes one connection to database.
 func Open(conn string) (db.DB, error) {
-	pool, err := pgxpool.Connect(context.Background(), conn)
+	return OpenWithOptions(conn, Options{})
+}
+
+// OpenWithOptions is like Open but with options.
+func OpenWithOptions(conn string, options Options) (db.DB, error) {
+	config, err := pgxpool.ParseConfig(conn)
 	if err != nil {
 		return nil, err
 	}
-	return &DB{pool}, nil
+	if options.ApplicationName != "" {
+		config.ConnConfig.RuntimeParams["application_name"] = options.ApplicationName
+	}
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{Pool: pool}, nil
 }
 
 func (d *DB) Close() error {
+	d.statementsMu.Lock()
+	d.statements = nil
+	d.statementsMu.Unlock()
 	d.Pool.Close()
 	return nil
 }
 
+// PrepareNamed checks the query by preparing it on one connection of the
+// pool and saves it with the name. Connections of the pool prepare the
+// query when they first execute the statement of the name (pgx names the
+// statement after the query and skips preparing if it is already prepared
+// on the connection), so every connection has it.
+func (d *DB) PrepareNamed(name, query string) error {
+	ctx := context.Background()
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+	if _, err := conn.Conn().Prepare(ctx, query, query); err != nil {
+		return err
+	}
+	d.statementsMu.Lock()
+	defer d.statementsMu.Unlock()
+	if d.statements == nil {
+		d.statements = map[string]string{}
+	}
+	d.statements[name] = query
+	return nil
+}
+
+// acquire acquires a connection of the pool with the statement of the name
+// prepared, returns the name of the statement on the connection.
+func (d *DB) acquire(ctx context.Context, name string) (*pgxpool.Conn, string, error) {
+	d.statementsMu.Lock()
+	query, ok := d.statements[name]
+	d.statementsMu.Unlock()
+	if !ok {
+		return nil, "", db.ErrPreparedNotFound
+	}
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := conn.Conn().Prepare(ctx, query, query); err != nil {
+		conn.Release()
+		return nil, "", err
+	}
+	return conn, query, nil
+}
+
+func (d *DB) ExecNamed(name string, args ...interface{}) (db.Result, error) {
+	ctx := context.Background()
+	conn, statement, err := d.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+	re, err := conn.Exec(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	return Result{
+		rowsAffected: re.RowsAffected(),
+	}, nil
+}
+
+func (d *DB) QueryNamed(name string, args ...interface{}) (db.Rows, error) {
+	ctx := context.Background()
+	conn, statement, err := d.acquire(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, statement, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &Rows{Rows: rows, release: conn.Release}, nil
+}
+
+// DeallocateNamed forgets the query of the name, statements prepared on the
+// connections are released when the connections are closed.
+func (d *DB) DeallocateNamed(name string) error {
+	d.statementsMu.Lock()
+	defer d.statementsMu.Unlock()
+	if _, ok := d.statements[name]; !ok {
+		return db.ErrPreparedNotFound
+	}
+	delete(d.statements, name)
+	return nil
+}
+
 func (d *DB) Exec(query string, args ...interface{}) (db.Result, error) {
 	re, err := d.Pool.Exec(context.Background(), query, args...)
 	if err != nil {
@@ -64,7 +197,7 @@ func (d *DB) Query(query string, args ...interface{}) (db.Rows, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Rows{rows}, nil
+	return &Rows{Rows: rows}, nil
 }
 
 func (d *DB) QueryRow(query string, args ...interface{}) db.Row {
@@ -85,13 +218,39 @@ func (d *DB) ErrNoRows() error {
 	return pgx.ErrNoRows
 }
 
+// QuoteIdentifier quotes the identifier using pgx's Identifier.Sanitize().
+func (d *DB) QuoteIdentifier(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
 func (d *DB) ErrGetCode(err error) string {
-	if e, ok := err.(interface{ SQLState() string }); ok { // github.com/jackc/pgconn
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) { // github.com/jackc/pgconn
 		return e.SQLState()
 	}
 	return "unknown"
 }
 
+// CopyFrom inserts rows into the table with the COPY protocol, which is much
+// faster than INSERT for large number of rows. Table name can be qualified
+// with the schema name like "public.users". pgxpool.Pool's CopyFrom can be
+// called with d.Pool.CopyFrom().
+func (d *DB) CopyFrom(ctx context.Context, tableName string, columns []string, rows [][]interface{}) (int64, error) {
+	return d.Pool.CopyFrom(ctx, pgx.Identifier(strings.Split(tableName, ".")), columns, pgx.CopyFromRows(rows))
+}
+
+// Stats returns statistics of the connection pool, pgxpool.Stat can be
+// obtained with d.Pool.Stat().
+func (d *DB) Stats() db.Stats {
+	s := d.Pool.Stat()
+	return db.Stats{
+		MaxOpen: int(s.MaxConns()),
+		Open:    int(s.TotalConns()),
+		InUse:   int(s.AcquiredConns()),
+		Idle:    int(s.IdleConns()),
+	}
+}
+
 func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (db.Result, error) {
 	re, err := t.Tx.Exec(ctx, query, args...)
 	if err != nil {
@@ -107,7 +266,7 @@ func (t *Tx) QueryContext(ctx context.Context, query string, args ...interface{}
 	if err != nil {
 		return nil, err
 	}
-	return &Rows{rows}, nil
+	return &Rows{Rows: rows}, nil
 }
 
 func (t *Tx) QueryRowContext(ctx context.Context, query string, args ...interface{}) db.Row {
@@ -128,5 +287,18 @@ func (r Result) RowsAffected() (int64, error) {
 
 func (r *Rows) Close() error {
 	r.Rows.Close()
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
 	return nil
 }
+
+func (r *Rows) Columns() ([]string, error) {
+	fields := r.Rows.FieldDescriptions()
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = string(field.Name)
+	}
+	return columns, nil
+}
@@ -2,10 +2,30 @@ package pq
 
 import (
 	"database/sql"
+	"strings"
 
 	"github.com/caiguanhao/furk/db"
 	"github.com/caiguanhao/furk/db/standard"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+type (
+	// DB is standard.DB with lib/pq specific features (arrays are
+	// converted with pq.Array() and identifiers are quoted with
+	// pq.QuoteIdentifier()). Open() returns *DB instead of *standard.DB,
+	// so use conn.(*pq.DB).DB to get the *standard.DB.
+	DB struct {
+		*standard.DB
+	}
+
+	// Options can be used in OpenWithOptions.
+	Options struct {
+		// Name of the application shown in pg_stat_activity. It is added
+		// to the connection string, so every connection of the pool has
+		// it, unlike "SET application_name" which only changes the session
+		// of one connection.
+		ApplicationName string
+	}
 )
 
 // MustOpen is like Open but panics if connect operation fails.
@@ -17,8 +37,34 @@ func MustOpen(conn string) db.DB {
 	return c
 }
 
-// Open creates and establishes one connection to database.
+// MustOpenWithOptions is like OpenWithOptions but panics if connect
+// operation fails.
+func MustOpenWithOptions(conn string, options Options) db.DB {
+	c, err := OpenWithOptions(conn, options)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Open creates and establishes one connection to database. The connection
+// is *DB (not *standard.DB).
 func Open(conn string) (db.DB, error) {
+	return OpenWithOptions(conn, Options{})
+}
+
+// OpenWithOptions is like Open but with options.
+func OpenWithOptions(conn string, options Options) (db.DB, error) {
+	if options.ApplicationName != "" {
+		if strings.HasPrefix(conn, "postgres://") || strings.HasPrefix(conn, "postgresql://") {
+			var err error
+			conn, err = pq.ParseURL(conn)
+			if err != nil {
+				return nil, err
+			}
+		}
+		conn += " application_name=" + quote(options.ApplicationName)
+	}
 	c, err := sql.Open("postgres", conn)
 	if err != nil {
 		return nil, err
@@ -26,5 +72,22 @@ func Open(conn string) (db.DB, error) {
 	if err := c.Ping(); err != nil {
 		return nil, err
 	}
-	return &standard.DB{c}, nil
+	return &DB{&standard.DB{c}}, nil
+}
+
+// Convert Go slice to PostgreSQL array using lib/pq's pq.Array().
+func (d *DB) ConvertArray(slice interface{}) interface{} {
+	return pq.Array(slice)
+}
+
+// QuoteIdentifier quotes the identifier using lib/pq's pq.QuoteIdentifier().
+func (d *DB) QuoteIdentifier(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+// quote value in connection string
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
 }
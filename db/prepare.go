@@ -0,0 +1,160 @@
+package db
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrPrepareNotSupported = errors.New("prepared statements are not supported by the connection")
+	ErrPreparedNotFound    = errors.New("prepared statement not found")
+)
+
+type (
+	// preparedDB executes the prepared statement instead of the query,
+	// optional interfaces of the DB are forwarded.
+	preparedDB struct {
+		DB
+		prepared PrepareNamed
+		name     string
+	}
+
+	preparedRow struct {
+		rows   Rows
+		err    error
+		noRows error
+	}
+)
+
+// Prepare creates a prepared statement of the query with the name on the
+// connection, so hot queries are parsed and planned once and executed by
+// name with Exec(). A statement with the same name is replaced. Prepared
+// statements belong to the connection (not the Model), they can be used by
+// other Models of the same connection and are released by Deallocate() or
+// Close() of the connection. The connection must implement PrepareNamed
+// (like pq and pgx), otherwise ErrPrepareNotSupported is returned.
+//  m.Prepare("findByStatus", "SELECT id, status FROM orders WHERE status = $1")
+//  m.Exec("findByStatus", "new").MustQuery(&orders)
+func (m Model) Prepare(name, query string) error {
+	if m.connection == nil {
+		return ErrNoConnection
+	}
+	p, ok := m.connection.(PrepareNamed)
+	if !ok {
+		return ErrPrepareNotSupported
+	}
+	m.NewSQLWithValues(query).log("PREPARE "+name+" AS "+query, nil)
+	return p.PrepareNamed(name, query)
+}
+
+// Exec returns a statement which executes the prepared statement of the
+// name (see Prepare()) with the arguments, use it like other statements,
+// for example, Query(), QueryRow() or Execute(). ErrPreparedNotFound is
+// returned if no statement is prepared with the name. Clauses like
+// OrderBy() can't be added and the statement can't be executed in a
+// transaction.
+func (m Model) Exec(name string, args ...interface{}) SQLWithValues {
+	s := m.NewSQLWithValues("EXECUTE "+name, args...)
+	if m.connection == nil {
+		return s
+	}
+	p, ok := m.connection.(PrepareNamed)
+	if !ok {
+		return s.withError(ErrPrepareNotSupported)
+	}
+	model := *s.model
+	model.connection = preparedDB{m.connection, p, name}
+	s.model = &model
+	return s
+}
+
+// Deallocate releases the prepared statement of the name.
+func (m Model) Deallocate(name string) error {
+	if m.connection == nil {
+		return ErrNoConnection
+	}
+	p, ok := m.connection.(PrepareNamed)
+	if !ok {
+		return ErrPrepareNotSupported
+	}
+	m.NewSQLWithValues("").log("DEALLOCATE "+name, nil)
+	return p.DeallocateNamed(name)
+}
+
+func (d preparedDB) Exec(query string, args ...interface{}) (Result, error) {
+	return d.prepared.ExecNamed(d.name, args...)
+}
+
+func (d preparedDB) Query(query string, args ...interface{}) (Rows, error) {
+	return d.prepared.QueryNamed(d.name, args...)
+}
+
+func (d preparedDB) QueryRow(query string, args ...interface{}) Row {
+	rows, err := d.prepared.QueryNamed(d.name, args...)
+	return preparedRow{rows, err, d.ErrNoRows()}
+}
+
+func (r preparedRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	defer r.rows.Close()
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return r.noRows
+	}
+	if err := r.rows.Scan(dest...); err != nil {
+		return err
+	}
+	return r.rows.Close()
+}
+
+func (d preparedDB) ConvertParameters(query string, args []interface{}) (string, []interface{}) {
+	if c, ok := d.DB.(ConvertParameters); ok {
+		return c.ConvertParameters(query, args)
+	}
+	return query, args
+}
+
+func (d preparedDB) ConvertArray(array interface{}) interface{} {
+	if c, ok := d.DB.(ConvertArray); ok {
+		return c.ConvertArray(array)
+	}
+	return array
+}
+
+func (d preparedDB) QuoteIdentifier(name string) string {
+	return Model{connection: d.DB}.QuoteIdentifier(name)
+}
+
+func (d preparedDB) SupportsReturning() bool {
+	if r, ok := d.DB.(Returning); ok {
+		return r.SupportsReturning()
+	}
+	return true
+}
+
+func (d preparedDB) CopyFrom(ctx context.Context, tableName string, columns []string, rows [][]interface{}) (int64, error) {
+	if c, ok := d.DB.(CopyFrom); ok {
+		return c.CopyFrom(ctx, tableName, columns, rows)
+	}
+	return 0, ErrCopyNotSupported
+}
+
+func (d preparedDB) PrepareNamed(name, query string) error {
+	return d.prepared.PrepareNamed(name, query)
+}
+
+func (d preparedDB) ExecNamed(name string, args ...interface{}) (Result, error) {
+	return d.prepared.ExecNamed(name, args...)
+}
+
+func (d preparedDB) QueryNamed(name string, args ...interface{}) (Rows, error) {
+	return d.prepared.QueryNamed(name, args...)
+}
+
+func (d preparedDB) DeallocateNamed(name string) error {
+	return d.prepared.DeallocateNamed(name)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// needsReturning returns true if the statement is an INSERT without
+// RETURNING and target is (pointer of a slice of) the struct of the Model.
+func (s SQLWithValues) needsReturning(target interface{}) bool {
+	if s.model.structType == nil || s.verb() != "INSERT" || s.hasReturning() {
+		return false
+	}
+	rt := reflect.TypeOf(target)
+	if rt == nil || rt.Kind() != reflect.Ptr {
+		return false
+	}
+	rt = rt.Elem()
+	if rt.Kind() == reflect.Slice {
+		rt = rt.Elem()
+	}
+	return rt == s.model.structType
+}
+
+// hasReturning returns true if the statement has a RETURNING clause.
+func (s SQLWithValues) hasReturning() bool {
+	if s.returning != "" {
+		return true
+	}
+	for _, i := range topLevelWords(s.sql) {
+		if hasKeywordAt(s.sql, i, "RETURNING") {
+			return true
+		}
+	}
+	return false
+}
+
+// isReturningMap returns true if the statement has a RETURNING clause and
+// dest has only one pointer of a map, so all returned rows are put into the
+// map.
+func (s SQLWithValues) isReturningMap(dest []interface{}) bool {
+	if len(dest) != 1 || !s.hasReturning() {
+		return false
+	}
+	rt := reflect.TypeOf(dest[0])
+	return rt != nil && rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Map
+}
+
+// queryInserted executes the INSERT statement and queries the inserted row
+// with its id in one transaction, for connections without RETURNING, so
+// lastval() is of the same session as the INSERT.
+func (s SQLWithValues) queryInserted(target interface{}) (n int, err error) {
+	column := s.model.columnName("Id")
+	if column == "" {
+		column = "id"
+	}
+	err = s.transaction(&TxOptions{}, func(ctx context.Context, tx Tx) error {
+		var id int64
+		err := func() (err error) {
+			defer s.observe(time.Now(), &err)
+			s.log(s.sql, s.values)
+			result, err := tx.ExecContext(ctx, s.sql, s.values...)
+			if err != nil {
+				return s.wrapError(err)
+			}
+			if r, ok := result.(interface{ LastInsertId() (int64, error) }); ok {
+				if id, err = r.LastInsertId(); err == nil {
+					return nil
+				}
+			}
+			s.log("SELECT lastval()", nil)
+			return s.wrapError(tx.QueryRowContext(ctx, "SELECT lastval()").Scan(&id))
+		}()
+		if err != nil {
+			return err
+		}
+		find := s.model.Find("WHERE "+column+" = $1", id)
+		defer find.observe(time.Now(), &err)
+		find.log(find.sql, find.values)
+		rv := reflect.Indirect(reflect.ValueOf(target))
+		err = find.wrapError(find.scan(rv, tx.QueryRowContext(ctx, find.sql, find.values...)))
+		return err
+	})
+	if err == nil {
+		n = 1
+	}
+	return
+}
+
+// MustQueryRowStruct is like QueryRowStruct but panics if query operation
+// fails.
+func (s SQLWithValues) MustQueryRowStruct(target interface{}) {
+	if err := s.QueryRowStruct(target); err != nil {
+		panic(err)
+	}
+}
+
+// QueryRowStruct is like Query but target must be pointer of a struct, the
+// first row (for example, from RETURNING) is scanned into the struct just
+// like Query(). "RETURNING *" is replaced with all columns of the Model (the
+// same columns as Find()), so the columns are in the order of the fields
+// even if the order of columns in the table is different.
+//  var order models.Order
+//  m.Insert(changes...)("RETURNING *").MustQueryRowStruct(&order)
+//  // INSERT INTO orders (status) VALUES ($1) RETURNING id, status, meta
+func (s SQLWithValues) QueryRowStruct(target interface{}) error {
+	rt := reflect.TypeOf(target)
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return ErrInvalidTarget
+	}
+	if s.model.structType != nil && rt.Elem() == s.model.structType {
+		for _, i := range topLevelWords(s.main) {
+			if !hasKeywordAt(s.main, i, "RETURNING") {
+				continue
+			}
+			rest := strings.TrimSpace(s.main[i+len("RETURNING"):])
+			if rest == "*" {
+				s.main = s.main[:i] + "RETURNING " + strings.Join(s.model.columns(), ", ")
+				s.build()
+			}
+			break
+		}
+	}
+	_, err := s.query(target, 0)
+	return err
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+var (
+	ErrNoPrimaryKey = errors.New("primary key (id) not found")
+)
+
+// Save inserts the object (pointer of a struct of the Model) if its primary
+// key ("id" column) is zero value, and the new id is put into the struct
+// with "RETURNING id", otherwise the row with the id is updated. Values of
+// all fields (including fields in jsonb columns) except the id and columns
+// with "GENERATED ALWAYS" are saved. If no rows are updated, the error of
+// no rows (see IsNoRows()) is returned.
+//  user := models.User{Name: "foo"}
+//  m.Save(&user) // INSERT INTO users (name) VALUES ($1) RETURNING id
+//  user.Name = "bar"
+//  m.Save(&user) // UPDATE users SET name = $2 WHERE id = $1
+func (m Model) Save(object interface{}) error {
+	rv := reflect.ValueOf(object)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return ErrMustBePointer
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return ErrTypeAssertionFailed
+	}
+	var idField *Field
+	changes := Changes{}
+	for _, field := range m.modelFields {
+		value, ok := fieldValue(rv, field)
+		if !ok {
+			continue
+		}
+		if field.Jsonb == "" && field.ColumnName == "id" {
+			f := field
+			idField = &f
+			continue
+		}
+		if field.Jsonb == "" && field.generatedAlways() {
+			continue
+		}
+		changes[field] = value
+	}
+	if idField == nil {
+		return ErrNoPrimaryKey
+	}
+	id := rv.FieldByName(idField.Name)
+	if id.IsZero() {
+		pointer := reflect.NewAt(id.Type(), unsafe.Pointer(id.UnsafeAddr())).Interface()
+		return m.Insert(changes)("RETURNING id").QueryRow(pointer)
+	}
+	var rowsAffected int64
+	err := m.Update(changes)("WHERE id = $1", id.Interface()).Execute(&rowsAffected)
+	if err == nil && rowsAffected == 0 && m.connection != nil {
+		err = m.connection.ErrNoRows()
+	}
+	return err
+}
+
+// InsertStruct is like Insert but the changes are values of the fields
+// (struct field names or column names) of the object (struct or pointer of
+// a struct of the Model). If no field names are provided, all fields except
+// ones of zero values are inserted (see InsertZeroValues()). Columns with
+// "GENERATED ALWAYS" are left out. ErrUnknownColumn is returned when the
+// statement is executed if any field name is unknown.
+//  // INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id
+//  m.InsertStruct(user, "Name", "Email")("RETURNING id").MustQueryRow(&user.Id)
+func (m Model) InsertStruct(object interface{}, fieldNames ...string) func(...string) SQLWithValues {
+	return func(args ...string) SQLWithValues {
+		rv, ok := addressableStruct(object)
+		if !ok {
+			return m.Insert()(args...).withError(ErrTypeAssertionFailed)
+		}
+		changes := Changes{}
+		found := map[string]bool{}
+		for _, field := range m.modelFields {
+			if len(fieldNames) > 0 {
+				var name string
+				for _, n := range fieldNames {
+					if n == field.Name || (field.Jsonb == "" && n == field.ColumnName) {
+						name = n
+						break
+					}
+				}
+				if name == "" {
+					continue
+				}
+				found[name] = true
+			}
+			if field.Jsonb == "" && field.generatedAlways() {
+				continue
+			}
+			value, ok := fieldValue(rv, field)
+			if !ok {
+				continue
+			}
+			if len(fieldNames) == 0 && rv.FieldByName(field.Name).IsZero() &&
+				(!m.zeroValues || (field.Jsonb == "" && field.ColumnName == "id")) {
+				continue
+			}
+			changes[field] = value
+		}
+		s := m.Insert(changes)(args...)
+		for _, name := range fieldNames {
+			if !found[name] {
+				return s.withError(ErrUnknownColumn)
+			}
+		}
+		return s
+	}
+}
+
+// InsertZeroValues returns a copy of the Model whose InsertStruct() without
+// field names inserts all fields of the struct (except the zero id),
+// including ones of zero values, instead of leaving them to the DEFAULT
+// values of the columns.
+//  // INSERT INTO invoices (tenant_id, amount) VALUES ($1, $2)
+//  m.InsertZeroValues().InsertStruct(models.Invoice{Amount: 1})().MustExecute()
+func (m Model) InsertZeroValues() *Model {
+	m.zeroValues = true
+	return &m
+}
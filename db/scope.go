@@ -0,0 +1,250 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrOutOfScope = errors.New("changes are out of scope")
+)
+
+// keywords of clauses after the WHERE clause
+var clausesAfterWhere = []string{
+	"GROUP BY", "HAVING", "WINDOW", "ORDER BY", "LIMIT", "OFFSET", "FETCH",
+	"FOR", "RETURNING", "UNION", "INTERSECT", "EXCEPT",
+}
+
+// Scoped is like ScopedBy("tenant_id", tenantId).
+//  tenant := db.NewModel(models.Order{}, conn).Scoped(tenantId)
+//  tenant.Find("WHERE id = $1", id).MustQuery(&order)
+//  // SELECT ... FROM orders WHERE orders.tenant_id = $2 AND (id = $1)
+func (m Model) Scoped(tenantId interface{}) *Model {
+	return m.ScopedBy("tenant_id", tenantId)
+}
+
+// ScopedBy returns a copy of the Model whose statements only see and change
+// rows with the value of the column (struct field name or column name).
+// The "column = $n" condition is added to the WHERE clause of statements
+// built by Find(), Select(), Count(), Exists(), Update(), Delete(), etc.
+// and the DO UPDATE clause of Upsert(), the placeholder is numbered after
+// all other arguments of the conditions. Insert(), BatchInsert(), etc. add
+// the column with the value to every row. If the changes of Insert() or
+// Update() have a different value of the column, ErrOutOfScope is returned
+// when the statement is executed. Statements created by NewSQLWithValues()
+// are not scoped.
+func (m Model) ScopedBy(column string, value interface{}) *Model {
+	if c := m.columnName(column); c != "" {
+		column = c
+	}
+	m.scopeColumn, m.scopeValue = column, value
+	return &m
+}
+
+// scope adds condition of the scope (and the condition to exclude soft
+// deleted rows) to the conditions, the placeholder is numbered after the
+// args.
+func (m Model) scope(conditions string, args []interface{}) (string, []interface{}) {
+	var condition string
+	if m.softDelete {
+		condition = m.tableRef() + "." + m.deletedAtColumn() + " IS NULL"
+	}
+	if m.scopeColumn != "" {
+		if condition != "" {
+			condition += " AND "
+		}
+		condition += fmt.Sprintf("%s.%s = $%d", m.tableRef(), m.scopeColumn, len(args)+1)
+		args = append(args[:len(args):len(args)], m.scopeValue)
+	}
+	if condition == "" {
+		return conditions, args
+	}
+	return addCondition(conditions, condition), args
+}
+
+// scopeChanges returns error if the column of the scope in the changes has
+// a different value, values are compared after pointers are dereferenced and
+// converted to the type of the struct field. If addScope is true, changes of
+// the column of the scope are added.
+func (m Model) scopeChanges(lotsOfChanges []Changes, addScope bool) ([]Changes, error) {
+	if m.scopeColumn == "" {
+		return lotsOfChanges, nil
+	}
+	field := Field{Name: m.scopeColumn, ColumnName: m.scopeColumn, JsonName: m.scopeColumn}
+	for _, f := range m.modelFields {
+		if f.Jsonb == "" && f.ColumnName == m.scopeColumn {
+			field = f
+			break
+		}
+	}
+	var rt reflect.Type
+	if st := m.structType; st != nil {
+		if st.Kind() == reflect.Ptr {
+			st = st.Elem()
+		}
+		if sf, ok := st.FieldByName(field.Name); ok {
+			rt = sf.Type
+		}
+	}
+	scopeValue := scopeValueOf(m.scopeValue, rt)
+	for _, changes := range lotsOfChanges {
+		for f, value := range changes {
+			if f.Jsonb != "" || f.ColumnName != m.scopeColumn {
+				continue
+			}
+			if !reflect.DeepEqual(scopeValueOf(uncast(value), rt), scopeValue) {
+				return nil, ErrOutOfScope
+			}
+		}
+	}
+	if !addScope {
+		return lotsOfChanges, nil
+	}
+	out := append(lotsOfChanges[:len(lotsOfChanges):len(lotsOfChanges)], Changes{field: m.scopeValue})
+	return out, nil
+}
+
+// scopeValueOf dereferences the value and converts it to the type (if it is
+// not a pointer itself) so that values like int64(1) and int(1) are equal,
+// values of different kinds (like 1 and "1") are never converted.
+func scopeValueOf(value interface{}, rt reflect.Type) interface{} {
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	for rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt != nil && rv.Type() != rt && sameKind(rv.Kind(), rt.Kind()) && rv.Type().ConvertibleTo(rt) {
+		rv = rv.Convert(rt)
+	}
+	return rv.Interface()
+}
+
+// sameKind returns true if both kinds are integers, floats, strings, etc.
+func sameKind(a, b reflect.Kind) bool {
+	kind := func(k reflect.Kind) reflect.Kind {
+		switch k {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return reflect.Int
+		case reflect.Float32:
+			return reflect.Float64
+		}
+		return k
+	}
+	return kind(a) == kind(b)
+}
+
+// addCondition adds condition to the WHERE clause of the conditions, which
+// may also have other clauses like ORDER BY. If there is no WHERE clause,
+// one is added before other clauses.
+//  addCondition("WHERE a = 1 OR b = 2 ORDER BY id", "c = 3")
+//  // WHERE c = 3 AND (a = 1 OR b = 2) ORDER BY id
+func addCondition(conditions, condition string) string {
+	start, end := -1, len(conditions)
+	for _, i := range topLevelWords(conditions) {
+		if start == -1 && hasKeywordAt(conditions, i, "WHERE") {
+			start = i
+			continue
+		}
+		if isClauseAfterWhere(conditions, i) {
+			end = i
+			break
+		}
+	}
+	before := strings.TrimSpace(conditions[:end])
+	after := strings.TrimSpace(conditions[end:])
+	var where string
+	if start == -1 {
+		where = before + " WHERE " + condition
+	} else {
+		body := strings.TrimSpace(conditions[start+len("WHERE") : end])
+		where = strings.TrimSpace(conditions[:start]) + " WHERE " + condition
+		if body != "" {
+			where += " AND (" + body + ")"
+		}
+	}
+	return strings.TrimSpace(strings.TrimSpace(where) + " " + after)
+}
+
+// topLevelWords returns start indexes of words which are not in quotes or
+// parentheses.
+func topLevelWords(s string) (indexes []int) {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"':
+			quote = c
+		case '(':
+			depth += 1
+		case ')':
+			depth -= 1
+		default:
+			if depth == 0 && isWordChar(c) && (i == 0 || !isWordChar(s[i-1])) {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return
+}
+
+func isClauseAfterOrderBy(s string, i int) bool {
+	for _, clause := range []string{"LIMIT", "OFFSET", "FETCH", "FOR"} {
+		if hasKeywordAt(s, i, clause) {
+			return true
+		}
+	}
+	return false
+}
+
+func isClauseAfterWhere(s string, i int) bool {
+	for _, clause := range clausesAfterWhere {
+		if hasKeywordAt(s, i, clause) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKeywordAt returns true if s has the keyword (case-insensitive, words are
+// separated by any white spaces) at index i.
+func hasKeywordAt(s string, i int, keyword string) bool {
+	for n, word := range strings.Fields(keyword) {
+		if n > 0 {
+			j := i
+			for j < len(s) && (s[j] == ' ' || s[j] == '\t' || s[j] == '\n' || s[j] == '\r') {
+				j += 1
+			}
+			if j == i {
+				return false
+			}
+			i = j
+		}
+		if len(s) < i+len(word) || !strings.EqualFold(s[i:i+len(word)], word) {
+			return false
+		}
+		i += len(word)
+	}
+	return i == len(s) || !isWordChar(s[i])
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '.' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SeedSQL generates INSERT statements (one for each object) with literal
+// values of all fields (except for columns with "GENERATED ALWAYS") of the
+// objects, which are structs or pointers of structs of the Model, useful for
+// generating fixture files without a database connection. Values of jsonb
+// columns are marshaled into JSON, values of other columns are in text
+// representation (see Composite in Schema()), strings are quoted with
+// single quotes, nil pointers are NULL. Objects that are not structs are
+// ignored. Error is returned if any jsonb column can't be marshaled. Never
+// execute generated SQL of untrusted objects on production databases.
+//  sql, err := m.SeedSQL(models.User{Id: 1, Name: "it's"})
+//  // INSERT INTO users (id, name) VALUES ('1', 'it''s');
+func (m Model) SeedSQL(objects ...interface{}) (string, error) {
+	var b strings.Builder
+	for _, object := range objects {
+		rv, ok := addressableStruct(object)
+		if !ok {
+			continue
+		}
+		columns := []string{}
+		values := []string{}
+		jsonbChanges := map[string]Changes{}
+		for _, field := range m.modelFields {
+			value, ok := fieldValue(rv, field)
+			if !ok {
+				continue
+			}
+			if field.Jsonb != "" {
+				if _, ok := jsonbChanges[field.Jsonb]; !ok {
+					jsonbChanges[field.Jsonb] = Changes{}
+				}
+				jsonbChanges[field.Jsonb][field] = value
+				continue
+			}
+			if field.generatedAlways() {
+				continue
+			}
+			columns = append(columns, field.ColumnName)
+			values = append(values, literal(field.convertValue(value)))
+		}
+		for _, jsonbColumn := range m.jsonbColumns {
+			if changes, ok := jsonbChanges[jsonbColumn]; ok {
+				object, err := m.jsonbObject(changes)
+				if err != nil {
+					return "", err
+				}
+				columns = append(columns, jsonbColumn)
+				values = append(values, literal(object))
+			}
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		b.WriteString("INSERT INTO " + m.tableName + " (" + strings.Join(columns, ", ") + ") VALUES (" +
+			strings.Join(values, ", ") + ");\n")
+	}
+	return b.String(), nil
+}
+
+// literal returns SQL literal of the value, NULL for nil.
+func literal(value interface{}) string {
+	if value == nil {
+		return "NULL"
+	}
+	text := textOf(reflect.ValueOf(value))
+	if text == nil {
+		return "NULL"
+	}
+	return "'" + strings.ReplaceAll(*text, "'", "''") + "'"
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	ErrNoForeignKey = errors.New("foreign key not found")
+)
+
+// CascadeSoftDelete builds a statement to soft delete rows matching the
+// conditions (by setting deleted_at to current time) and all rows of the
+// child models referencing these rows. Rows already soft deleted are left
+// untouched. Foreign key of a child model is the field with the
+// `references:"<table name>"` tag, or the field named after the struct of
+// the parent model plus Id (for example, AuthorId for Author). Everything
+// is done in one statement, so either all rows are soft deleted or none.
+// The statement returns ids of the soft deleted parent rows.
+//  type Book struct {
+//  	Id        int
+//  	Writer    int `references:"authors"`
+//  	DeletedAt *time.Time
+//  }
+//  var ids []int
+//  authors.CascadeSoftDelete(books, reviews)("WHERE id = $1", 1).MustQuery(&ids)
+func (m Model) CascadeSoftDelete(childModels ...*Model) func(...interface{}) SQLWithValues {
+	return func(values ...interface{}) SQLWithValues {
+		where, values := m.scope(splitConditions(values))
+		deletedAt := m.deletedAtColumn()
+		id := m.columnName("Id")
+		if id == "" {
+			id = "id"
+		}
+		if !m.softDelete {
+			where = addCondition(where, m.tableName+"."+deletedAt+" IS NULL")
+		}
+		ctes := []string{
+			"parents AS (UPDATE " + m.fromTable() + " SET " + deletedAt + " = now() " + where +
+				" RETURNING " + m.tableName + "." + id + ")",
+		}
+		var err error
+		for i, child := range childModels {
+			foreignKey := child.foreignKeyOf(m)
+			if foreignKey == "" {
+				err = ErrNoForeignKey
+				break
+			}
+			childDeletedAt := child.deletedAtColumn()
+			ctes = append(ctes, fmt.Sprintf("children%d AS (UPDATE %s SET %s = now() "+
+				"WHERE %s IN (SELECT %s FROM parents) AND %s IS NULL)",
+				i+1, child.tableName, childDeletedAt, foreignKey, id, childDeletedAt))
+		}
+		sql := "WITH " + strings.Join(ctes, ", ") + " SELECT " + id + " FROM parents"
+		return m.NewSQLWithValues(sql, values...).withError(err)
+	}
+}
+
+// SoftDelete returns a copy of the Model whose statements don't see soft
+// deleted rows. The "deleted_at IS NULL" condition is added to the WHERE
+// clause of statements built by Find(), Select(), Count(), Exists(),
+// Update(), Delete(), etc., just like the condition of ScopedBy(), so
+// uniqueness checks only consider active rows:
+//  users := db.NewModel(models.User{}, conn).SoftDelete()
+//  taken := users.MustExists("WHERE email = $1", email)
+//  // SELECT 1 AS one FROM users WHERE users.deleted_at IS NULL AND (email = $1)
+func (m Model) SoftDelete() *Model {
+	m.softDelete = true
+	return &m
+}
+
+// deletedAtColumn returns column name of the DeletedAt field, deleted_at is
+// returned if there's no such field.
+func (m Model) deletedAtColumn() string {
+	if c := m.columnName("DeletedAt"); c != "" {
+		return c
+	}
+	return "deleted_at"
+}
+
+// foreignKeyOf returns column name of the foreign key referencing the
+// parent model, empty string is returned if not found.
+func (m Model) foreignKeyOf(parent Model) string {
+	for _, f := range m.modelFields {
+		if f.Jsonb == "" && f.References == parent.tableName {
+			return f.ColumnName
+		}
+	}
+	rt := parent.structType
+	if rt == nil {
+		return ""
+	}
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	return m.columnName(ToColumnName(rt.Name()) + "_id")
+}
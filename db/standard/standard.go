@@ -3,6 +3,10 @@ package standard
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/caiguanhao/furk/db"
 )
@@ -17,10 +21,86 @@ type (
 	}
 )
 
+// prepared statements of each *sql.DB, they are not fields of DB so that DB
+// can still be created with &standard.DB{c}
+var (
+	statementsMu sync.Mutex
+	statements   = map[*sql.DB]map[string]*sql.Stmt{}
+)
+
+func init() {
+	db.RegisterErrGetCode(new(DB).ErrGetCode)
+}
+
+// Close closes prepared statements and the database.
 func (d *DB) Close() error {
+	statementsMu.Lock()
+	for _, stmt := range statements[d.DB] {
+		stmt.Close()
+	}
+	delete(statements, d.DB)
+	statementsMu.Unlock()
 	return d.DB.Close()
 }
 
+// PrepareNamed creates a prepared statement (sql.Stmt, which is prepared on
+// each connection of the pool when needed) of the query with the name, the
+// statement with the same name is closed and replaced.
+func (d *DB) PrepareNamed(name, query string) error {
+	stmt, err := d.DB.Prepare(query)
+	if err != nil {
+		return err
+	}
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+	if statements[d.DB] == nil {
+		statements[d.DB] = map[string]*sql.Stmt{}
+	}
+	if old, ok := statements[d.DB][name]; ok {
+		old.Close()
+	}
+	statements[d.DB][name] = stmt
+	return nil
+}
+
+func (d *DB) statement(name string) (*sql.Stmt, error) {
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+	stmt, ok := statements[d.DB][name]
+	if !ok {
+		return nil, db.ErrPreparedNotFound
+	}
+	return stmt, nil
+}
+
+func (d *DB) ExecNamed(name string, args ...interface{}) (db.Result, error) {
+	stmt, err := d.statement(name)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+func (d *DB) QueryNamed(name string, args ...interface{}) (db.Rows, error) {
+	stmt, err := d.statement(name)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+// DeallocateNamed closes the prepared statement of the name.
+func (d *DB) DeallocateNamed(name string) error {
+	statementsMu.Lock()
+	defer statementsMu.Unlock()
+	stmt, ok := statements[d.DB][name]
+	if !ok {
+		return db.ErrPreparedNotFound
+	}
+	delete(statements[d.DB], name)
+	return stmt.Close()
+}
+
 func (d *DB) Exec(query string, args ...interface{}) (db.Result, error) {
 	return d.DB.Exec(query, args...)
 }
@@ -55,13 +135,38 @@ func (d *DB) ErrNoRows() error {
 	return sql.ErrNoRows
 }
 
+// SupportsReturning returns false if the driver is known to not support the
+// RETURNING clause (MySQL), so inserted rows are queried with LastInsertId()
+// instead, see db.Returning.
+func (d *DB) SupportsReturning() bool {
+	return !strings.Contains(strings.ToLower(fmt.Sprintf("%T", d.DB.Driver())), "mysql")
+}
+
+// QuoteIdentifier quotes the identifier with double quotes.
+func (d *DB) QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
 func (d *DB) ErrGetCode(err error) string {
-	if e, ok := err.(interface{ Get(byte) string }); ok { // github.com/lib/pq
+	var e interface{ Get(byte) string }
+	if errors.As(err, &e) { // github.com/lib/pq
 		return e.Get('C')
 	}
 	return "unknown"
 }
 
+// Stats returns statistics of the connection pool, sql.DBStats can be
+// obtained with d.DB.Stats().
+func (d *DB) Stats() db.Stats {
+	s := d.DB.Stats()
+	return db.Stats{
+		MaxOpen: s.MaxOpenConnections,
+		Open:    s.OpenConnections,
+		InUse:   s.InUse,
+		Idle:    s.Idle,
+	}
+}
+
 func (t *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (db.Result, error) {
 	return t.Tx.ExecContext(ctx, query, args...)
 }
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"reflect"
+	"time"
+)
+
+type (
+	// timeLayoutScanner scans text in the layout into time.Time or
+	// *time.Time.
+	timeLayoutScanner struct {
+		target reflect.Value
+		layout string
+	}
+)
+
+func (s timeLayoutScanner) Scan(src interface{}) error {
+	var t time.Time
+	switch v := src.(type) {
+	case nil:
+		s.target.Set(reflect.Zero(s.target.Type()))
+		return nil
+	case time.Time:
+		t = v
+	case []byte, string:
+		var text string
+		if b, ok := v.([]byte); ok {
+			text = string(b)
+		} else {
+			text = v.(string)
+		}
+		if text == "" {
+			s.target.Set(reflect.Zero(s.target.Type()))
+			return nil
+		}
+		var err error
+		t, err = time.Parse(s.layout, text)
+		if err != nil {
+			return err
+		}
+	default:
+		return ErrTypeAssertionFailed
+	}
+	if s.target.Kind() == reflect.Ptr {
+		s.target.Set(reflect.New(s.target.Type().Elem()))
+		s.target.Elem().Set(reflect.ValueOf(t))
+	} else {
+		s.target.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+// SetInsertTimeZone sets the location which values of time.Time (or
+// *time.Time) in the changes of Insert(), Update(), Upsert(), etc. are
+// converted to before they are sent to the database, so all times are in
+// the same time zone regardless of the locations of the Go values. It is
+// useful for timestamp (without time zone) columns, text columns of fields
+// with "timeLayout" tag and fields in jsonb columns. By default, values are
+// sent as they are.
+//  m := db.NewModel(models.Event{}, conn)
+//  m.SetInsertTimeZone(time.UTC)
+func (m *Model) SetInsertTimeZone(loc *time.Location) *Model {
+	m.timeZone = loc
+	return m
+}
+
+// inTimeZone converts time.Time or *time.Time (also of Cast()) to the
+// location of SetInsertTimeZone(), other values are returned as they are.
+func (m Model) inTimeZone(value interface{}) interface{} {
+	if m.timeZone == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return v.In(m.timeZone)
+	case *time.Time:
+		if v != nil {
+			t := v.In(m.timeZone)
+			return &t
+		}
+	case cast:
+		v.value = m.inTimeZone(v.value)
+		return v
+	}
+	return value
+}
+
+// timeLayoutValue formats time.Time (or *time.Time) in the layout, zero time
+// is formatted as empty string. Other values are returned as they are.
+func timeLayoutValue(value interface{}, layout string) interface{} {
+	switch t := value.(type) {
+	case time.Time:
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(layout)
+	case *time.Time:
+		if t == nil {
+			return nil
+		}
+		return timeLayoutValue(*t, layout)
+	}
+	return value
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// TypeScriptInterface generates TypeScript interface of the Model from the
+// struct, so types of the frontend can be kept in sync with the Model. Keys
+// are the json names, fields in jsonb columns are included like other
+// fields, fields of pointers are optional. time.Time is Date, types
+// implementing encoding.TextMarshaler and decimal.Decimal are string,
+// other types implementing json.Marshaler are any.
+//  db.NewModel(models.Order{}).TypeScriptInterface()
+//  // export interface Order {
+//  // 	id: number;
+//  // 	status: string;
+//  // 	paid_at?: Date;
+//  // }
+func (m Model) TypeScriptInterface() string {
+	rt := m.structType
+	if rt != nil && rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	var name string
+	if rt != nil && rt.Name() != "" {
+		name = strings.ToUpper(rt.Name()[:1]) + rt.Name()[1:]
+	} else {
+		for _, s := range strings.Split(m.tableName, "_") {
+			if s != "" {
+				name += strings.ToUpper(s[:1]) + s[1:]
+			}
+		}
+	}
+	var b strings.Builder
+	b.WriteString("export interface " + name + " {\n")
+	for _, field := range m.modelFields {
+		if !field.Exported || field.JsonName == "" {
+			continue
+		}
+		tp := "any"
+		optional := ""
+		if rt != nil {
+			if f, ok := rt.FieldByName(field.Name); ok {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+					optional = "?"
+				}
+				tp = typeScriptType(ft)
+			}
+		}
+		b.WriteString("\t" + typeScriptKey(field.JsonName) + optional + ": " + tp + ";\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// typeScriptType returns TypeScript type of the Go type, nested structs are
+// object types.
+func typeScriptType(rt reflect.Type) string {
+	if rt == timeType {
+		return "Date"
+	}
+	if rt.String() == "decimal.Decimal" {
+		return "string"
+	}
+	if rt.Implements(textMarshalerType) || reflect.PtrTo(rt).Implements(textMarshalerType) {
+		return "string"
+	}
+	if rt.Implements(jsonMarshalerType) || reflect.PtrTo(rt).Implements(jsonMarshalerType) {
+		return "any"
+	}
+	switch rt.Kind() {
+	case reflect.Ptr:
+		return typeScriptType(rt.Elem()) + " | null"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return "string" // base64
+		}
+		tp := typeScriptType(rt.Elem())
+		if strings.Contains(tp, " | ") {
+			tp = "(" + tp + ")"
+		}
+		return tp + "[]"
+	case reflect.Map:
+		return "{ [key: string]: " + typeScriptType(rt.Elem()) + " }"
+	case reflect.Struct:
+		fields := []string{}
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Tag.Get("json")
+			if idx := strings.Index(name, ","); idx != -1 {
+				name = name[:idx]
+			}
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			optional := ""
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				optional = "?"
+			}
+			fields = append(fields, typeScriptKey(name)+optional+": "+typeScriptType(ft))
+		}
+		if len(fields) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(fields, "; ") + " }"
+	}
+	return "any"
+}
+
+// typeScriptKey quotes the key if it is not a valid identifier.
+func typeScriptKey(key string) string {
+	for i, c := range key {
+		if c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (i > 0 && c >= '0' && c <= '9') {
+			continue
+		}
+		k, _ := json.Marshal(key)
+		return string(k)
+	}
+	return key
+}
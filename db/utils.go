@@ -1,9 +1,13 @@
 package db
 
 import (
+	"encoding/json"
 	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
+	"unsafe"
 )
 
 var (
@@ -14,17 +18,36 @@ var (
 	// Function to convert table name to its plural form.
 	// By default, table name uses plural form.
 	Pluralizer func(string) string = DefaultPluralizer
+
+	// Functions to encode and decode JSON, for example, Filter() inputs and
+	// values of jsonb columns. By default uses encoding/json, you can replace
+	// them with faster or customized implementations.
+	JSONMarshal   func(interface{}) ([]byte, error) = json.Marshal
+	JSONUnmarshal func([]byte, interface{}) error   = json.Unmarshal
+
+	// If true, Schema() uses "bigint GENERATED ALWAYS AS IDENTITY PRIMARY
+	// KEY" instead of "SERIAL PRIMARY KEY" for integer id columns. It must
+	// be set before NewModel().
+	UseIdentityColumns bool
 )
 
 const (
 	tableNameField = "__TABLE_NAME__"
+
+	// maximum number of placeholder parameters of a statement in PostgreSQL
+	maxParameters = 65535
+)
+
+var (
+	rePosParam = regexp.MustCompile(`\$[0-9]+`)
 )
 
 // Get table name from a struct. If a struct has "TableName() string" function,
 // then the return value of the function will be used. If a struct has a field
 // named "__TABLE_NAME__", then value of the field tag will be used. Otherwise,
 // the name of the struct will be used. If name is empty, "error_no_table_name"
-// is returned.
+// is returned. When rows are scanned into the struct, the "__TABLE_NAME__"
+// field (if any) is set to the table name.
 // Examples:
 //  - type Product struct{}; func (_ Product) TableName() string { return "foobar" }; ToTableName(Product{}) == "foobar"
 //  - ToTableName(struct { __TABLE_NAME__ string `users` }{}) == "users"
@@ -55,6 +78,32 @@ func ToTableName(object interface{}) (name string) {
 	return
 }
 
+// setTableNameField sets the table name to the unexported "__TABLE_NAME__"
+// string field of the struct, which can also be in embedded structs. Nothing
+// is set if the struct doesn't have the field or the field is in an embedded
+// struct of nil pointer.
+func setTableNameField(rv reflect.Value, tableName string) {
+	sf, ok := rv.Type().FieldByName(tableNameField)
+	if !ok || sf.Type.Kind() != reflect.String {
+		return
+	}
+	f := rv
+	for _, i := range sf.Index {
+		if f.Kind() == reflect.Ptr {
+			if f.IsNil() {
+				return
+			}
+			f = f.Elem()
+		}
+		f = f.Field(i)
+	}
+	if !f.CanAddr() {
+		return
+	}
+	// unexported field can't be set without unsafe
+	reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().SetString(tableName)
+}
+
 // Function to convert struct name to name used in database, using the Columnizer function.
 func ToColumnName(in string) string {
 	return Columnizer(strings.TrimSpace(in))
@@ -104,3 +153,40 @@ func addSegment(inrune, segment []rune) []rune { // from govalidator
 	inrune = append(inrune, segment...)
 	return inrune
 }
+
+func stringsContain(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// renumber adds offset to every positional parameter (like $1) in the SQL.
+func renumber(sql string, offset int) string {
+	if offset == 0 {
+		return sql
+	}
+	return rePosParam.ReplaceAllStringFunc(sql, func(in string) string {
+		pos, _ := strconv.Atoi(strings.TrimPrefix(in, "$"))
+		return "$" + strconv.Itoa(pos+offset)
+	})
+}
+
+// joinRows joins rows of placeholders for the VALUES clause, like
+// "($1, $2), ($3, $4)".
+func joinRows(rows [][]string) string {
+	out := []string{}
+	for _, row := range rows {
+		out = append(out, "("+strings.Join(row, ", ")+")")
+	}
+	return strings.Join(out, ", ")
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type (
+	// ValuesList is a VALUES list which can be used as a table in FROM or
+	// JOIN, created by Values().
+	ValuesList struct {
+		alias   string
+		columns []string
+		rows    [][]interface{}
+		offset  int
+	}
+)
+
+// Values creates a VALUES list of the rows with the column names, which can
+// be joined or filtered against like a table, useful for bulk updates or
+// loading rows of many keys at once. Its String() is like "(VALUES ($1,
+// $2), ($3, $4)) AS v (id, status)" and Values() are the values of the rows
+// flattened for the placeholders. PostgreSQL infers types of the columns
+// from the first row, so placeholders of the first row are cast to types of
+// the Go values (for example, "$1::bigint" for int), use Cast() to cast to
+// other types. Rows with fewer values than the columns are filled with NULL.
+//  v := db.Values([]string{"id", "status"}, [][]interface{}{{1, "paid"}, {2, db.Cast("new", "order_status")}})
+//  // UPDATE orders SET status = v.status FROM (VALUES ($1::bigint, $2::text), ($3, $4::order_status)) AS v (id, status) WHERE orders.id = v.id
+//  m.NewSQLWithValues("UPDATE orders SET status = v.status FROM "+v.String()+" WHERE orders.id = v.id", v.Values()...).MustExecute()
+func Values(columns []string, rows [][]interface{}) ValuesList {
+	return ValuesList{alias: "v", columns: columns, rows: rows}
+}
+
+// As changes the alias of the VALUES list, default is "v".
+func (v ValuesList) As(alias string) ValuesList {
+	v.alias = alias
+	return v
+}
+
+// Offset numbers the placeholders after the offset, so the VALUES list can
+// be put after other placeholders, for example, Offset(1) numbers the
+// placeholders from $2.
+func (v ValuesList) Offset(offset int) ValuesList {
+	v.offset = offset
+	return v
+}
+
+// String returns the VALUES list with the alias and the column names.
+func (v ValuesList) String() string {
+	rows := [][]string{}
+	i := v.offset
+	for r, values := range v.rows {
+		row := []string{}
+		for c := range v.columns {
+			if c >= len(values) {
+				row = append(row, "NULL")
+				continue
+			}
+			i += 1
+			placeholder := "$" + strconv.Itoa(i)
+			if ct, ok := values[c].(cast); ok {
+				placeholder += "::" + ct.dataType
+			} else if dataType := valuesDataType(values[c]); r == 0 && dataType != "" {
+				placeholder += "::" + dataType
+			}
+			row = append(row, placeholder)
+		}
+		rows = append(rows, row)
+	}
+	return "(VALUES " + joinRows(rows) + ") AS " + v.alias + " (" + strings.Join(v.columns, ", ") + ")"
+}
+
+// Values returns values of the rows for the placeholders.
+func (v ValuesList) Values() (values []interface{}) {
+	for _, row := range v.rows {
+		for c := range v.columns {
+			if c < len(row) {
+				values = append(values, uncast(row[c]))
+			}
+		}
+	}
+	return
+}
+
+// valuesDataType returns data type of the Go value for the placeholder in
+// the first row of the VALUES list, empty string is returned if unknown.
+func valuesDataType(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	rt := reflect.TypeOf(value)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	switch rt {
+	case timeType:
+		return "timestamptz"
+	}
+	if rt.String() == "decimal.Decimal" {
+		return "numeric"
+	}
+	switch rt.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "bigint"
+	case reflect.Float32, reflect.Float64:
+		return "double precision"
+	case reflect.String:
+		return "text"
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return "bytea"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"strings"
+)
+
+type (
+	// Where builds conditions of the WHERE clause, it can be used as the
+	// first argument of Find(), Select(), Count(), Exists(), Delete() or
+	// the function returned by Update(). Conditions are joined with AND and
+	// placeholders are numbered from $1.
+	//  // SELECT ... FROM orders WHERE user_id = $1 AND status = ANY($2)
+	//  m.Find(db.Where{}.Eq("user_id", 1).AnyEq("status", []string{"new", "paid"})).MustQuery(&orders)
+	Where struct {
+		conditions []string
+		values     []interface{}
+	}
+
+	array struct {
+		value interface{}
+	}
+)
+
+// Array marks a Go slice to be bound as a PostgreSQL array. If the DB
+// implements ConvertArray (like pq and gopg), the slice is converted with
+// the driver's array support, otherwise (like pgx) it is bound as it is.
+//  m.Find("WHERE id = ANY($1)", db.Array([]int64{1, 2, 3})).MustQuery(&orders)
+func Array(slice interface{}) interface{} {
+	return array{slice}
+}
+
+// Eq adds "column = $n" condition.
+func (w Where) Eq(column string, value interface{}) Where {
+	return w.add(column+" = $1", value)
+}
+
+// AnyEq adds "column = ANY($n)" condition, the slice is bound as a
+// PostgreSQL array (see Array()). Unlike "column IN ($1, $2, ...)", only one
+// placeholder is used no matter how long the slice is, so the SQL statement
+// stays the same and you don't have to generate placeholders yourself. Note
+// that empty slice matches no rows.
+func (w Where) AnyEq(column string, slice interface{}) Where {
+	return w.Any(column, "=", slice)
+}
+
+// Any adds "column operator ANY($n)" condition, the slice is bound as a
+// PostgreSQL array (see Array()). Operator is not validated, don't use user
+// input as operator.
+//  db.Where{}.Any("name", "LIKE", []string{"a%", "b%"})
+func (w Where) Any(column, operator string, slice interface{}) Where {
+	return w.add(column+" "+operator+" ANY($1)", Array(slice))
+}
+
+// All adds "column operator ALL($n)" condition, the slice is bound as a
+// PostgreSQL array (see Array()). Operator is not validated, don't use user
+// input as operator. Note that empty slice matches all rows.
+//  db.Where{}.All("status", "<>", []string{"deleted", "banned"})
+func (w Where) All(column, operator string, slice interface{}) Where {
+	return w.add(column+" "+operator+" ALL($1)", Array(slice))
+}
+
+// Matches adds "column ~ $n" condition, which is true if the column matches
+// the POSIX regular expression pattern (case-sensitive). Regular expressions
+// from user input can take a long time to match (ReDoS), limit their lengths
+// or set statement_timeout if you have to use them.
+//  db.Where{}.Matches("email", `^[^@]+@example\.com$`)
+func (w Where) Matches(column, pattern string) Where {
+	return w.add(column+" ~ $1", pattern)
+}
+
+// IMatches is like Matches() but case-insensitive ("column ~* $n").
+func (w Where) IMatches(column, pattern string) Where {
+	return w.add(column+" ~* $1", pattern)
+}
+
+// SimilarTo adds "column SIMILAR TO $n" condition, the pattern is a SQL
+// regular expression which must match the whole value, for example
+// "%(b|d)%". Like Matches(), be careful with patterns from user input.
+func (w Where) SimilarTo(column, pattern string) Where {
+	return w.add(column+" SIMILAR TO $1", pattern)
+}
+
+// Exists adds "EXISTS (subquery)" condition, placeholders of the subquery
+// start from $1 and are renumbered after other conditions. It filters rows
+// by existence of related rows without a join (so no duplicate rows).
+//  // SELECT ... FROM orders WHERE status = $1 AND EXISTS (SELECT 1 FROM items WHERE items.order_id = orders.id AND items.price > $2)
+//  db.Where{}.Eq("status", "new").Exists("SELECT 1 FROM items WHERE items.order_id = orders.id AND items.price > $1", 100)
+func (w Where) Exists(subquery string, args ...interface{}) Where {
+	return w.add("EXISTS ("+subquery+")", args...)
+}
+
+// NotExists is like Exists() but adds "NOT EXISTS (subquery)" condition.
+func (w Where) NotExists(subquery string, args ...interface{}) Where {
+	return w.add("NOT EXISTS ("+subquery+")", args...)
+}
+
+// String returns the WHERE clause, empty string is returned if there are no
+// conditions.
+func (w Where) String() string {
+	if len(w.conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conditions, " AND ")
+}
+
+// Values returns values for the placeholders in the WHERE clause.
+func (w Where) Values() []interface{} {
+	return w.values
+}
+
+// add adds condition whose placeholders start from $1.
+func (w Where) add(condition string, values ...interface{}) Where {
+	w.conditions = append(w.conditions[:len(w.conditions):len(w.conditions)], renumber(condition, len(w.values)))
+	w.values = append(w.values[:len(w.values):len(w.values)], values...)
+	return w
+}
+
+// splitConditions returns conditions (string or Where) from the first value
+// and the rest values for the placeholders.
+func splitConditions(values []interface{}) (string, []interface{}) {
+	if len(values) > 0 {
+		switch w := values[0].(type) {
+		case string:
+			return w, values[1:]
+		case Where:
+			return w.String(), append(w.Values()[:len(w.values):len(w.values)], values[1:]...)
+		}
+	}
+	return "", values
+}